@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+)
+
+const defaultDeadLetterListLimit = 100
+
+var (
+	deadLetterListLimit int64
+	deadLetterRequeueID string
+
+	deadLetterCmd = &cobra.Command{
+		Use:   "dead-letter",
+		Short: "Inspect and requeue timelock documents that failed too many times",
+	}
+	deadLetterListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the most recent dead letters",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			command = ListDeadLettersCommand
+		},
+	}
+	deadLetterRequeueCmd = &cobra.Command{
+		Use:   "requeue <id>",
+		Short: "Move a dead letter back into the timelock queue",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			command = RequeueDeadLetterCommand
+			deadLetterRequeueID = args[0]
+		},
+	}
+)
+
+func setupDeadLetterCommands() {
+	deadLetterListCmd.Flags().Int64Var(&deadLetterListLimit, "limit", defaultDeadLetterListLimit, "maximum number of dead letters to list")
+	deadLetterCmd.AddCommand(deadLetterListCmd, deadLetterRequeueCmd)
+	rootCmd.AddCommand(deadLetterCmd)
+}
+
+func GetDeadLetterListLimit() int64 {
+	return deadLetterListLimit
+}
+
+func GetDeadLetterRequeueID() string {
+	return deadLetterRequeueID
+}
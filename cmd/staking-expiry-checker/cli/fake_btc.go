@@ -0,0 +1,29 @@
+package cli
+
+import "time"
+
+const defaultFakeBtcBlockInterval = 10 * time.Second
+
+var (
+	fakeBtc              bool
+	fakeBtcTip           int64
+	fakeBtcBlockInterval time.Duration
+)
+
+func setupFakeBtcFlags() {
+	rootCmd.Flags().BoolVar(&fakeBtc, "fake-btc", false, "serve the btc chain from an in-process fake bitcoind instead of the configured node, for development only")
+	rootCmd.Flags().Int64Var(&fakeBtcTip, "fake-btc-tip", 0, "initial tip height of the fake bitcoind")
+	rootCmd.Flags().DurationVar(&fakeBtcBlockInterval, "fake-btc-block-interval", defaultFakeBtcBlockInterval, "interval at which the fake bitcoind mines a block")
+}
+
+func IsFakeBtcEnabled() bool {
+	return fakeBtc
+}
+
+func GetFakeBtcTip() int64 {
+	return fakeBtcTip
+}
+
+func GetFakeBtcBlockInterval() time.Duration {
+	return fakeBtcBlockInterval
+}
@@ -12,10 +12,23 @@ const (
 	defaultConfigFileName = "config.yml"
 )
 
+// Command is the action selected on the command line.
+type Command int
+
+const (
+	StartServerCommand Command = iota
+	ListDeadLettersCommand
+	RequeueDeadLetterCommand
+)
+
 var (
 	cfgPath string
+	command = StartServerCommand
 	rootCmd = &cobra.Command{
 		Use: "start-server",
+		Run: func(cmd *cobra.Command, args []string) {
+			command = StartServerCommand
+		},
 	}
 )
 
@@ -28,6 +41,8 @@ func Setup() error {
 	defaultConfigPath := getDefaultConfigFile(homePath, defaultConfigFileName)
 
 	rootCmd.PersistentFlags().StringVar(&cfgPath, "config", defaultConfigPath, fmt.Sprintf("config file (default %s)", defaultConfigPath))
+	setupDeadLetterCommands()
+	setupFakeBtcFlags()
 	if err := rootCmd.Execute(); err != nil {
 		return err
 	}
@@ -42,3 +57,7 @@ func getDefaultConfigFile(homePath, filename string) string {
 func GetConfigPath() string {
 	return cfgPath
 }
+
+func GetCommand() Command {
+	return command
+}
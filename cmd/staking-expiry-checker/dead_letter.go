@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/db"
+)
+
+type deadLetterOutput struct {
+	ID             string          `json:"id"`
+	Document       json.RawMessage `json:"document"`
+	LastError      string          `json:"last_error"`
+	FailureCount   int64           `json:"failure_count"`
+	FirstFailedAt  string          `json:"first_failed_at"`
+	LastFailedAt   string          `json:"last_failed_at"`
+	DeadLetteredAt string          `json:"dead_lettered_at"`
+}
+
+// listDeadLetters prints the most recent dead letters as one JSON object per line.
+func listDeadLetters(ctx context.Context, dbClient db.DbInterface, limit int64) error {
+	deadLetters, err := dbClient.ListDeadLetters(ctx, limit)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	for _, deadLetter := range deadLetters {
+		output := deadLetterOutput{
+			ID:             deadLetter.ID.Hex(),
+			Document:       json.RawMessage(deadLetter.Document.String()),
+			LastError:      deadLetter.LastError,
+			FailureCount:   deadLetter.FailureCount,
+			FirstFailedAt:  formatUnix(deadLetter.FirstFailedAt),
+			LastFailedAt:   formatUnix(deadLetter.LastFailedAt),
+			DeadLetteredAt: formatUnix(deadLetter.DeadLetteredAt),
+		}
+		if err := encoder.Encode(output); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// requeueDeadLetter moves the dead letter with the given hex ID back into the queue.
+func requeueDeadLetter(ctx context.Context, dbClient db.DbInterface, idHex string) error {
+	id, err := primitive.ObjectIDFromHex(idHex)
+	if err != nil {
+		return fmt.Errorf("invalid dead letter ID %s: %w", idHex, err)
+	}
+
+	if err := dbClient.RequeueDeadLetter(ctx, id); err != nil {
+		return err
+	}
+	fmt.Printf("requeued dead letter %s\n", idHex)
+
+	return nil
+}
+
+func formatUnix(timestamp int64) string {
+	return time.Unix(timestamp, 0).UTC().Format(time.RFC3339)
+}
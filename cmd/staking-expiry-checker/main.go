@@ -11,10 +11,13 @@ import (
 	"github.com/babylonchain/staking-expiry-checker/internal/btcclient"
 	"github.com/babylonchain/staking-expiry-checker/internal/config"
 	"github.com/babylonchain/staking-expiry-checker/internal/db"
+	"github.com/babylonchain/staking-expiry-checker/internal/fakebtc"
+	"github.com/babylonchain/staking-expiry-checker/internal/leader"
 	"github.com/babylonchain/staking-expiry-checker/internal/observability/metrics"
 	"github.com/babylonchain/staking-expiry-checker/internal/poller"
 	"github.com/babylonchain/staking-expiry-checker/internal/queue"
 	"github.com/babylonchain/staking-expiry-checker/internal/services"
+	"github.com/babylonchain/staking-expiry-checker/internal/utils"
 )
 
 func init() {
@@ -38,32 +41,87 @@ func main() {
 		log.Fatal().Err(err).Msg(fmt.Sprintf("error while loading config file: %s", cfgPath))
 	}
 
-	// initialize metrics with the metrics port from config
-	metricsPort := cfg.Metrics.GetMetricsPort()
-	metrics.Init(metricsPort)
-
 	// create new db client
 	dbClient, err := db.New(ctx, cfg.Db)
 	if err != nil {
 		log.Fatal().Err(err).Msg("error while creating db client")
 	}
 
-	btcClient, err := btcclient.NewBtcClient(&cfg.Btc)
+	// operator commands only need the db and exit once done
+	switch cli.GetCommand() {
+	case cli.ListDeadLettersCommand:
+		if err := listDeadLetters(ctx, dbClient, cli.GetDeadLetterListLimit()); err != nil {
+			log.Fatal().Err(err).Msg("error while listing dead letters")
+		}
+		return
+	case cli.RequeueDeadLetterCommand:
+		if err := requeueDeadLetter(ctx, dbClient, cli.GetDeadLetterRequeueID()); err != nil {
+			log.Fatal().Err(err).Msg("error while requeueing dead letter")
+		}
+		return
+	}
+
+	// initialize metrics with the metrics port from config
+	metricsPort := cfg.Metrics.GetMetricsPort()
+	metrics.Init(metricsPort)
+
+	if cli.IsFakeBtcEnabled() {
+		fakeBtc := fakebtc.NewServer(cli.GetFakeBtcTip())
+		defer fakeBtc.Close()
+		fakeBtc.AutoMine(cli.GetFakeBtcBlockInterval())
+		fakeBtc.Configure(&cfg.Btc)
+		log.Warn().Str("endpoint", fakeBtc.Endpoint()).Int64("tip", fakeBtc.Tip()).
+			Msg("serving the btc chain from a fake bitcoind, for development only")
+	}
+
+	var btcClient btcclient.BtcInterface
+	btcClient, err = btcclient.New(&cfg.Btc)
 	if err != nil {
 		log.Fatal().Err(err).Msg("error while creating btc client")
 	}
+	// Backends learning about new blocks by themselves also signal them.
+	backendNotifier, _ := btcClient.(btcclient.BlockNotifier)
+	if cfg.Btc.TipCacheTTL > 0 {
+		btcClient = btcclient.NewCachedBtcClient(btcClient, cfg.Btc.TipCacheTTL)
+	}
 
-	qm, err := queue.NewQueueManager(&cfg.Queue)
+	qm, err := queue.NewQueueManager(&cfg.Queue, &cfg.Publisher)
 	if err != nil {
 		log.Fatal().Err(err).Msg("error while creating queue manager")
 	}
+	if cfg.Reorg.Enabled && cfg.Reorg.Compensation == config.ReorgCompensationEvent {
+		revertedQueue, err := queue.NewConfirmingQueue(&cfg.Queue, cfg.Reorg.EventQueueName, cfg.Publisher.ConfirmTimeout)
+		if err != nil {
+			log.Fatal().Err(err).Msg("error while creating expiry reverted event queue")
+		}
+		qm.SetExpiryRevertedQueue(revertedQueue)
+	}
+
+	instanceID := utils.NewInstanceID()
+	log.Info().Str("instance_id", instanceID).Msg("starting staking expiry checker")
+
+	var elector *leader.Elector
+	if cfg.LeaderElection.Enabled {
+		elector = leader.NewElector(&cfg.LeaderElection, dbClient, instanceID)
+	}
 
-	delegationService := services.NewService(dbClient, btcClient, qm)
+	delegationService := services.NewService(cfg, instanceID, dbClient, btcClient, qm, elector)
 	if err != nil {
 		log.Fatal().Err(err).Msg("error while creating delegation service")
 	}
+	// The btc backend may not be reachable yet, the poller retries anyway.
+	if err := delegationService.ReportCheckpointLag(ctx); err != nil {
+		log.Warn().Err(err).Msg("failed to report the processing checkpoint lag")
+	}
+
+	var blockNotifier btcclient.BlockNotifier
+	if cfg.Btc.ZmqBlockEndpoint != "" {
+		blockNotifier = btcclient.NewBlockSubscriber(cfg.Btc.ZmqBlockEndpoint)
+	} else if backendNotifier != nil {
+		blockNotifier = backendNotifier
+	}
 
-	p, err := poller.NewPoller(cfg.Poller.Interval, delegationService)
+	p, err := poller.NewPoller(cfg.Poller.Interval, delegationService, elector, blockNotifier)
 	if err != nil {
 		log.Fatal().Err(err).Msg("error while creating poller")
 	}
@@ -0,0 +1,177 @@
+package btcclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/observability/metrics"
+)
+
+const (
+	babylonTipPath       = "/babylon/btclightclient/v1/tip"
+	babylonMainChainPath = "/babylon/btclightclient/v1/mainchain"
+	babylonSyncingPath   = "/cosmos/base/tendermint/v1beta1/syncing"
+)
+
+// maxBabylonResponseSize bounds the responses read from the Babylon node.
+const maxBabylonResponseSize = 4 << 20
+
+// maxBabylonHashLookupDepth bounds the number of headers below the tip
+// requested to look up the hash of a block, as the main chain of the light
+// client is only served from the tip down.
+const maxBabylonHashLookupDepth = 1000
+
+// BabylonClient is a BtcInterface following the BTC light client of a Babylon
+// node through its REST API, so that expiries are decided on the chain view
+// of the protocol. The light client only tracks the headers, transaction
+// lookups are not supported. Requests failing with a network error, a rate
+// limit or a server error are retried.
+type BabylonClient struct {
+	*httpApi
+}
+
+// NewBabylonClient creates a client for the REST API of the Babylon node at
+// the given base URL, e.g. http://localhost:1317.
+func NewBabylonClient(baseURL string, cfg *config.HttpRetryConfig) *BabylonClient {
+	return &BabylonClient{
+		httpApi: newHttpApi("babylon", baseURL, cfg, maxBabylonResponseSize),
+	}
+}
+
+// babylonHeaderInfo is a header of the light client. Its 64 bit integers
+// are encoded as strings, like all of the REST API.
+type babylonHeaderInfo struct {
+	HeaderHex string `json:"header_hex"`
+	Height    uint64 `json:"height,string"`
+}
+
+// hash returns the hash of the header, derived from the header itself
+// rather than trusting the encoding of the hash in the response.
+func (h *babylonHeaderInfo) hash() (*chainhash.Hash, error) {
+	raw, err := hex.DecodeString(h.HeaderHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid header from babylon: %w", err)
+	}
+	var header wire.BlockHeader
+	if err := header.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, fmt.Errorf("invalid header from babylon: %w", err)
+	}
+	hash := header.BlockHash()
+	return &hash, nil
+}
+
+type babylonTipResponse struct {
+	Header *babylonHeaderInfo `json:"header"`
+}
+
+type babylonMainChainResponse struct {
+	Headers []babylonHeaderInfo `json:"headers"`
+}
+
+type babylonSyncingResponse struct {
+	Syncing bool `json:"syncing"`
+}
+
+func (c *BabylonClient) GetBlockCount(ctx context.Context) (int64, error) {
+	return metrics.RecordBtcClientMetrics[int64](classified(func() (int64, error) {
+		tip, err := c.getTip(ctx)
+		if err != nil {
+			return 0, err
+		}
+		return int64(tip.Height), nil
+	}))
+}
+
+// GetRawTransaction is not supported, the light client only tracks the headers.
+func (c *BabylonClient) GetRawTransaction(ctx context.Context, txHash *chainhash.Hash) (*wire.MsgTx, error) {
+	return nil, ErrUnsupported
+}
+
+// GetTxOut is not supported, the light client only tracks the headers.
+func (c *BabylonClient) GetTxOut(ctx context.Context, txHash *chainhash.Hash, index uint32) (*wire.TxOut, error) {
+	return nil, ErrUnsupported
+}
+
+// GetTxBlockHeight is not supported, the light client only tracks the headers.
+func (c *BabylonClient) GetTxBlockHeight(ctx context.Context, txHash *chainhash.Hash) (int64, error) {
+	return 0, ErrUnsupported
+}
+
+// GetTxOutSpendHeight is not supported, the light client only tracks the headers.
+func (c *BabylonClient) GetTxOutSpendHeight(ctx context.Context, txHash *chainhash.Hash, index uint32) (int64, error) {
+	return 0, ErrUnsupported
+}
+
+// GetBlockHash looks the height up in the main chain of the light client,
+// which is served from the tip down. Heights deeper than
+// maxBabylonHashLookupDepth below the tip are not supported.
+func (c *BabylonClient) GetBlockHash(ctx context.Context, height int64) (*chainhash.Hash, error) {
+	return metrics.RecordBtcClientMetrics[*chainhash.Hash](classified(func() (*chainhash.Hash, error) {
+		tip, err := c.getTip(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if height < 0 || uint64(height) > tip.Height {
+			return nil, fmt.Errorf("block height %d is above the babylon btc light client tip %d", height, tip.Height)
+		}
+		depth := tip.Height - uint64(height)
+		if depth >= maxBabylonHashLookupDepth {
+			return nil, fmt.Errorf("block height %d is %d blocks below the babylon btc light client tip: %w",
+				height, depth, ErrUnsupported)
+		}
+
+		query := url.Values{}
+		query.Set("pagination.limit", strconv.FormatUint(depth+1, 10))
+		var mainChain babylonMainChainResponse
+		if err := c.getJSON(ctx, babylonMainChainPath+"?"+query.Encode(), &mainChain); err != nil {
+			return nil, err
+		}
+		for _, header := range mainChain.Headers {
+			if header.Height == uint64(height) {
+				return header.hash()
+			}
+		}
+		// The tip moved on or the chain was reorged between the requests.
+		return nil, fmt.Errorf("block height %d not found in the babylon btc light client main chain", height)
+	}))
+}
+
+// GetSyncStatus reports the light client as syncing while the Babylon node
+// catches up with its own chain, as the light client then lags behind too.
+func (c *BabylonClient) GetSyncStatus(ctx context.Context) (*SyncStatus, error) {
+	return metrics.RecordBtcClientMetrics[*SyncStatus](classified(func() (*SyncStatus, error) {
+		var syncing babylonSyncingResponse
+		if err := c.getJSON(ctx, babylonSyncingPath, &syncing); err != nil {
+			return nil, err
+		}
+		tip, err := c.getTip(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &SyncStatus{
+			InitialBlockDownload: syncing.Syncing,
+			Blocks:               int64(tip.Height),
+			Headers:              int64(tip.Height),
+		}, nil
+	}))
+}
+
+func (c *BabylonClient) getTip(ctx context.Context) (*babylonHeaderInfo, error) {
+	var tip babylonTipResponse
+	if err := c.getJSON(ctx, babylonTipPath, &tip); err != nil {
+		return nil, err
+	}
+	if tip.Header == nil {
+		return nil, errors.New("babylon btc light client returned no tip")
+	}
+	return tip.Header, nil
+}
@@ -1,8 +1,16 @@
 package btcclient
 
 import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
-	"github.com/btcsuite/btcd/rpcclient"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
 
 	"github.com/babylonchain/staking-expiry-checker/internal/config"
 	"github.com/babylonchain/staking-expiry-checker/internal/observability/metrics"
@@ -10,36 +18,218 @@ import (
 )
 
 type BtcClient struct {
-	client *rpcclient.Client
+	client *rpcClient
 
 	params *chaincfg.Params
 	cfg    *config.BtcConfig
 }
 
-func NewBtcClient(cfg *config.BtcConfig) (*BtcClient, error) {
-	params := utils.GetBTCParams(cfg.NetParams)
+// New creates the client of the configured backend for the configured
+// endpoints. With several endpoints the nodes are combined into a MultiBtcClient,
+// except for the p2p backend, which syncs headers from all of them at once.
+func New(cfg *config.BtcConfig) (BtcInterface, error) {
+	endpoints := cfg.GetEndpoints()
+	if cfg.GetBackend() == config.BackendP2P {
+		// All endpoints are peers feeding the same header chain.
+		addresses := make([]string, 0, len(endpoints))
+		for _, endpoint := range endpoints {
+			addresses = append(addresses, endpoint.Endpoint)
+		}
+		client := NewP2PClient(addresses, utils.GetBTCParams(cfg.NetParams), &cfg.P2P)
+		go client.Start(context.Background())
+		return client, nil
+	}
+	if len(endpoints) == 1 {
+		return newClient(cfg, endpoints[0])
+	}
 
-	connCfg := &rpcclient.ConnConfig{
-		Host:         cfg.Endpoint,
-		HTTPPostMode: true,
-		User:         cfg.RpcUser,
-		Pass:         cfg.RpcPass,
-		DisableTLS:   cfg.DisableTLS,
-		Params:       params.Name,
+	nodes := make([]Node, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		client, err := newClient(cfg, endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create btc client for %s: %w", endpoint.Endpoint, err)
+		}
+		nodes = append(nodes, Node{Name: endpoint.Endpoint, Client: client})
 	}
 
-	rpcClient, err := rpcclient.New(connCfg, nil)
+	return NewMultiBtcClient(nodes, cfg), nil
+}
+
+// newClient creates the client of the configured backend for a single endpoint.
+func newClient(cfg *config.BtcConfig, endpoint config.BtcEndpointConfig) (BtcInterface, error) {
+	switch cfg.GetBackend() {
+	case config.BackendEsplora:
+		return NewEsploraClient(endpoint.Endpoint, &cfg.Esplora), nil
+	case config.BackendBabylon:
+		return NewBabylonClient(endpoint.Endpoint, &cfg.Babylon), nil
+	case config.BackendElectrum:
+		// The tip is only known once subscribed, starting right away makes
+		// the client usable on its own, a later Start returns immediately.
+		client := NewElectrumClient(endpoint, &cfg.Electrum)
+		go client.Start(context.Background())
+		return client, nil
+	default:
+		return newBtcClient(cfg, endpoint)
+	}
+}
+
+// NewBtcClient creates a client for the first configured endpoint.
+func NewBtcClient(cfg *config.BtcConfig) (*BtcClient, error) {
+	return newBtcClient(cfg, cfg.GetEndpoints()[0])
+}
+
+func newBtcClient(cfg *config.BtcConfig, endpoint config.BtcEndpointConfig) (*BtcClient, error) {
+	client, err := newRpcClient(endpoint, cfg.GetRequestTimeout())
 	if err != nil {
 		return nil, err
 	}
 
 	return &BtcClient{
-		client: rpcClient,
-		params: params,
+		client: client,
+		params: utils.GetBTCParams(cfg.NetParams),
 		cfg:    cfg,
 	}, nil
 }
 
-func (b *BtcClient) GetBlockCount() (int64, error) {
-	return metrics.RecordBtcClientMetrics[int64](b.client.GetBlockCount)
+func (b *BtcClient) GetBlockCount(ctx context.Context) (int64, error) {
+	return metrics.RecordBtcClientMetrics[int64](classified(func() (int64, error) {
+		var count int64
+		err := b.client.call(ctx, "getblockcount", nil, &count)
+		return count, err
+	}))
+}
+
+func (b *BtcClient) GetRawTransaction(ctx context.Context, txHash *chainhash.Hash) (*wire.MsgTx, error) {
+	return metrics.RecordBtcClientMetrics[*wire.MsgTx](classified(func() (*wire.MsgTx, error) {
+		// Transactions not belonging to the wallet of the node require its txindex.
+		var txHex string
+		if err := b.client.call(ctx, "getrawtransaction", []interface{}{txHash.String(), false}, &txHex); err != nil {
+			return nil, err
+		}
+		raw, err := hex.DecodeString(txHex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transaction: %w", err)
+		}
+		var tx wire.MsgTx
+		if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+			return nil, fmt.Errorf("invalid transaction: %w", err)
+		}
+		return &tx, nil
+	}))
+}
+
+func (b *BtcClient) GetTxOut(ctx context.Context, txHash *chainhash.Hash, index uint32) (*wire.TxOut, error) {
+	return metrics.RecordBtcClientMetrics[*wire.TxOut](classified(func() (*wire.TxOut, error) {
+		// Spends only seen in the mempool may still be replaced, they do not count.
+		var result *btcjson.GetTxOutResult
+		if err := b.client.call(ctx, "gettxout", []interface{}{txHash.String(), index, false}, &result); err != nil {
+			return nil, err
+		}
+		if result == nil {
+			return nil, nil
+		}
+		value, err := btcutil.NewAmount(result.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tx out value: %w", err)
+		}
+		pkScript, err := hex.DecodeString(result.ScriptPubKey.Hex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tx out script: %w", err)
+		}
+		return wire.NewTxOut(int64(value), pkScript), nil
+	}))
+}
+
+func (b *BtcClient) GetTxBlockHeight(ctx context.Context, txHash *chainhash.Hash) (int64, error) {
+	return metrics.RecordBtcClientMetrics[int64](classified(func() (int64, error) {
+		return b.txBlockHeight(ctx, txHash)
+	}))
+}
+
+// GetTxOutSpendHeight looks up the output in the UTXO set first, only for a
+// spent output the blocks following the confirmation of its transaction are
+// searched for the spend, as bitcoind does not index spends. The lookup of
+// the transaction requires the txindex of the node.
+func (b *BtcClient) GetTxOutSpendHeight(ctx context.Context, txHash *chainhash.Hash, index uint32) (int64, error) {
+	return metrics.RecordBtcClientMetrics[int64](classified(func() (int64, error) {
+		// Spends only seen in the mempool leave the output in the UTXO set.
+		var out *btcjson.GetTxOutResult
+		if err := b.client.call(ctx, "gettxout", []interface{}{txHash.String(), index, false}, &out); err != nil {
+			return 0, err
+		}
+		if out != nil {
+			return 0, ErrTxNotConfirmed
+		}
+
+		confirmedHeight, err := b.txBlockHeight(ctx, txHash)
+		if err != nil {
+			return 0, err
+		}
+		var tip int64
+		if err := b.client.call(ctx, "getblockcount", nil, &tip); err != nil {
+			return 0, err
+		}
+		txID := txHash.String()
+		for height := confirmedHeight + 1; height <= tip; height++ {
+			var hash string
+			if err := b.client.call(ctx, "getblockhash", []interface{}{height}, &hash); err != nil {
+				return 0, err
+			}
+			// Verbosity 2 includes the inputs of the transactions.
+			var block btcjson.GetBlockVerboseTxResult
+			if err := b.client.call(ctx, "getblock", []interface{}{hash, 2}, &block); err != nil {
+				return 0, err
+			}
+			for _, tx := range block.Tx {
+				for _, in := range tx.Vin {
+					if in.Txid == txID && in.Vout == index {
+						return height, nil
+					}
+				}
+			}
+		}
+		// The spending block was reorged out while searching, the output
+		// is looked up again later.
+		return 0, ErrTxNotConfirmed
+	}))
+}
+
+// txBlockHeight returns the height of the block including the transaction.
+func (b *BtcClient) txBlockHeight(ctx context.Context, txHash *chainhash.Hash) (int64, error) {
+	var tx btcjson.TxRawResult
+	if err := b.client.call(ctx, "getrawtransaction", []interface{}{txHash.String(), true}, &tx); err != nil {
+		return 0, err
+	}
+	if tx.BlockHash == "" {
+		return 0, ErrTxNotConfirmed
+	}
+	var header btcjson.GetBlockHeaderVerboseResult
+	if err := b.client.call(ctx, "getblockheader", []interface{}{tx.BlockHash, true}, &header); err != nil {
+		return 0, err
+	}
+	return int64(header.Height), nil
+}
+
+func (b *BtcClient) GetBlockHash(ctx context.Context, height int64) (*chainhash.Hash, error) {
+	return metrics.RecordBtcClientMetrics[*chainhash.Hash](classified(func() (*chainhash.Hash, error) {
+		var hash string
+		if err := b.client.call(ctx, "getblockhash", []interface{}{height}, &hash); err != nil {
+			return nil, err
+		}
+		return chainhash.NewHashFromStr(hash)
+	}))
+}
+
+func (b *BtcClient) GetSyncStatus(ctx context.Context) (*SyncStatus, error) {
+	return metrics.RecordBtcClientMetrics[*SyncStatus](classified(func() (*SyncStatus, error) {
+		var info btcjson.GetBlockChainInfoResult
+		if err := b.client.call(ctx, "getblockchaininfo", nil, &info); err != nil {
+			return nil, err
+		}
+		return &SyncStatus{
+			InitialBlockDownload: info.InitialBlockDownload,
+			Blocks:               int64(info.Blocks),
+			Headers:              int64(info.Headers),
+		}, nil
+	}))
 }
@@ -0,0 +1,119 @@
+package btcclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/observability/metrics"
+)
+
+// CachedBtcClient is a BtcInterface serving the tip height from a cache for
+// up to the TTL, so that several jobs can share the tip without each of them
+// querying the node. Concurrent calls on a cache miss share a single query,
+// which is not aborted when the caller that started it gives up waiting.
+type CachedBtcClient struct {
+	client BtcInterface
+	ttl    time.Duration
+	group  singleflight.Group
+
+	mu        sync.RWMutex
+	tip       int64
+	fetchedAt time.Time
+	// generation is bumped on every invalidation, a query started before
+	// it does not refill the cache with a tip that may be outdated.
+	generation uint64
+}
+
+func NewCachedBtcClient(client BtcInterface, ttl time.Duration) *CachedBtcClient {
+	return &CachedBtcClient{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+func (c *CachedBtcClient) GetBlockCount(ctx context.Context) (int64, error) {
+	c.mu.RLock()
+	tip, fetchedAt := c.tip, c.fetchedAt
+	c.mu.RUnlock()
+
+	if !fetchedAt.IsZero() && time.Since(fetchedAt) < c.ttl {
+		metrics.RecordBtcTipCacheHit(time.Since(fetchedAt))
+		return tip, nil
+	}
+
+	metrics.RecordBtcTipCacheMiss()
+	// The query is shared, only the request timeout of the node bounds it.
+	queryCtx := context.WithoutCancel(ctx)
+	results := c.group.DoChan("tip", func() (interface{}, error) {
+		c.mu.RLock()
+		generation := c.generation
+		c.mu.RUnlock()
+
+		tip, err := c.client.GetBlockCount(queryCtx)
+		if err != nil {
+			// Errors are not cached, the next call queries the node again.
+			return nil, err
+		}
+
+		c.mu.Lock()
+		if c.generation == generation {
+			c.tip = tip
+			c.fetchedAt = time.Now()
+		}
+		c.mu.Unlock()
+		return tip, nil
+	})
+
+	select {
+	case result := <-results:
+		if result.Err != nil {
+			return 0, result.Err
+		}
+		return result.Val.(int64), nil
+	case <-ctx.Done():
+		return 0, &Error{Class: ErrorClassTransient, Err: ctx.Err()}
+	}
+}
+
+// Invalidate drops the cached tip, e.g. when a new block was notified, so that
+// the next call queries the node. Calls waiting on a query started before are
+// still served its result, later calls start a new query.
+func (c *CachedBtcClient) Invalidate() {
+	c.mu.Lock()
+	c.fetchedAt = time.Time{}
+	c.generation++
+	c.mu.Unlock()
+	c.group.Forget("tip")
+}
+
+// GetRawTransaction is not cached, transactions are looked up rarely.
+func (c *CachedBtcClient) GetRawTransaction(ctx context.Context, txHash *chainhash.Hash) (*wire.MsgTx, error) {
+	return c.client.GetRawTransaction(ctx, txHash)
+}
+
+// GetTxOut is not cached, a spend has to be noticed as soon as possible.
+func (c *CachedBtcClient) GetTxOut(ctx context.Context, txHash *chainhash.Hash, index uint32) (*wire.TxOut, error) {
+	return c.client.GetTxOut(ctx, txHash, index)
+}
+
+func (c *CachedBtcClient) GetTxBlockHeight(ctx context.Context, txHash *chainhash.Hash) (int64, error) {
+	return c.client.GetTxBlockHeight(ctx, txHash)
+}
+
+func (c *CachedBtcClient) GetTxOutSpendHeight(ctx context.Context, txHash *chainhash.Hash, index uint32) (int64, error) {
+	return c.client.GetTxOutSpendHeight(ctx, txHash, index)
+}
+
+// GetBlockHash is not cached, the block at a height changes with reorgs.
+func (c *CachedBtcClient) GetBlockHash(ctx context.Context, height int64) (*chainhash.Hash, error) {
+	return c.client.GetBlockHash(ctx, height)
+}
+
+func (c *CachedBtcClient) GetSyncStatus(ctx context.Context) (*SyncStatus, error) {
+	return c.client.GetSyncStatus(ctx)
+}
@@ -0,0 +1,373 @@
+package btcclient
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/rs/zerolog/log"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/observability/metrics"
+)
+
+const (
+	electrumClientName      = "staking-expiry-checker"
+	electrumProtocolVersion = "1.4"
+	headersSubscribeMethod  = "blockchain.headers.subscribe"
+)
+
+// ErrElectrumNotConnected is returned while no subscription to the electrum server is up.
+var ErrElectrumNotConnected = errors.New("not connected to the electrum server")
+
+// ElectrumClient is a BtcInterface tracking the tip pushed by an Electrum
+// server (ElectrumX/Fulcrum) through blockchain.headers.subscribe. The tip is
+// served from memory and only while the subscription is up, so that a stale
+// tip is never mistaken for the current one. Every new tip is signalled on
+// the notifications channel, coalesced like the ones of the BlockSubscriber.
+type ElectrumClient struct {
+	endpoint      string
+	useTLS        bool
+	cfg           *config.ElectrumConfig
+	notifications chan struct{}
+	quit          chan struct{}
+	started       atomic.Bool
+	stopOnce      sync.Once
+
+	mu        sync.RWMutex
+	connected bool
+	tip       int64
+}
+
+type electrumRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      uint64        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+// electrumMessage is either the response to a request or a notification.
+type electrumMessage struct {
+	ID     *uint64         `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *electrumError  `json:"error"`
+}
+
+type electrumError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *electrumError) Error() string {
+	return fmt.Sprintf("electrum error %d: %s", e.Code, e.Message)
+}
+
+type electrumHeader struct {
+	Height int64  `json:"height"`
+	Hex    string `json:"hex"`
+}
+
+// NewElectrumClient creates a client for the server at the host:port of the
+// endpoint, connecting over TLS unless it is disabled. The client queries
+// nothing before it is started.
+func NewElectrumClient(endpoint config.BtcEndpointConfig, cfg *config.ElectrumConfig) *ElectrumClient {
+	return &ElectrumClient{
+		endpoint:      endpoint.Endpoint,
+		useTLS:        !endpoint.DisableTLS,
+		cfg:           cfg,
+		notifications: make(chan struct{}, 1),
+		quit:          make(chan struct{}),
+	}
+}
+
+func (c *ElectrumClient) GetBlockCount(ctx context.Context) (int64, error) {
+	return metrics.RecordBtcClientMetrics[int64](classified(func() (int64, error) {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		if !c.connected {
+			return 0, ErrElectrumNotConnected
+		}
+		return c.tip, nil
+	}))
+}
+
+// GetRawTransaction is not supported. The subscription only tracks the tip, lookups are not supported.
+func (c *ElectrumClient) GetRawTransaction(ctx context.Context, txHash *chainhash.Hash) (*wire.MsgTx, error) {
+	return nil, ErrUnsupported
+}
+
+// GetTxOut is not supported. The subscription only tracks the tip, lookups are not supported.
+func (c *ElectrumClient) GetTxOut(ctx context.Context, txHash *chainhash.Hash, index uint32) (*wire.TxOut, error) {
+	return nil, ErrUnsupported
+}
+
+// GetTxBlockHeight is not supported, electrum servers only look up
+// transactions by the script they pay to.
+func (c *ElectrumClient) GetTxBlockHeight(ctx context.Context, txHash *chainhash.Hash) (int64, error) {
+	return 0, ErrUnsupported
+}
+
+// GetTxOutSpendHeight is not supported, electrum servers only look up
+// transactions by the script they pay to.
+func (c *ElectrumClient) GetTxOutSpendHeight(ctx context.Context, txHash *chainhash.Hash, index uint32) (int64, error) {
+	return 0, ErrUnsupported
+}
+
+// GetBlockHash is not supported, the subscription only tracks the tip.
+func (c *ElectrumClient) GetBlockHash(ctx context.Context, height int64) (*chainhash.Hash, error) {
+	return nil, ErrUnsupported
+}
+
+// GetSyncStatus is not supported, electrum servers only report their tip.
+func (c *ElectrumClient) GetSyncStatus(ctx context.Context) (*SyncStatus, error) {
+	return nil, ErrUnsupported
+}
+
+// Notifications returns the channel signalled when the server pushed a new tip.
+func (c *ElectrumClient) Notifications() <-chan struct{} {
+	return c.notifications
+}
+
+// Start keeps a subscription to the server until the context is cancelled or
+// the client is stopped, reconnecting whenever the connection is lost.
+// Starting an already started client returns immediately.
+func (c *ElectrumClient) Start(ctx context.Context) {
+	if !c.started.CompareAndSwap(false, true) {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-c.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		err := c.subscribe(ctx)
+		c.setDisconnected()
+		if err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Str("endpoint", c.endpoint).Msg("electrum subscription failed, reconnecting")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.cfg.ReconnectInterval):
+		}
+	}
+}
+
+func (c *ElectrumClient) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.quit)
+	})
+}
+
+// subscribe connects to the server, subscribes to the headers and tracks the
+// pushed tips until the connection fails.
+func (c *ElectrumClient) subscribe(ctx context.Context) error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// Unblocks the reads once the client is stopped.
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	session := &electrumSession{conn: conn, reader: bufio.NewReader(conn)}
+
+	if err := conn.SetDeadline(time.Now().Add(c.cfg.RequestTimeout)); err != nil {
+		return err
+	}
+	if _, err := session.call(c.handleHeaders, "server.version", electrumClientName, electrumProtocolVersion); err != nil {
+		return fmt.Errorf("electrum handshake failed: %w", err)
+	}
+	result, err := session.call(c.handleHeaders, headersSubscribeMethod)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to electrum headers: %w", err)
+	}
+	var header electrumHeader
+	if err := json.Unmarshal(result, &header); err != nil {
+		return fmt.Errorf("invalid electrum header: %w", err)
+	}
+	c.setTip(header.Height)
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return err
+	}
+	log.Info().Str("endpoint", c.endpoint).Int64("btc_tip", header.Height).Msg("subscribed to electrum headers")
+
+	// Pings keep the connection alive and make a silently dropped connection
+	// fail the read deadline below.
+	done := make(chan struct{})
+	defer close(done)
+	go session.ping(c.cfg.PingInterval, done)
+
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(2 * c.cfg.PingInterval)); err != nil {
+			return err
+		}
+		msg, err := session.read()
+		if err != nil {
+			return err
+		}
+		if err := c.handleHeaders(msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *ElectrumClient) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: c.cfg.RequestTimeout}
+	if c.useTLS {
+		return tls.DialWithDialer(dialer, "tcp", c.endpoint, &tls.Config{MinVersion: tls.VersionTLS12})
+	}
+	return dialer.Dial("tcp", c.endpoint)
+}
+
+// handleHeaders applies a headers notification, other messages are ignored.
+func (c *ElectrumClient) handleHeaders(msg *electrumMessage) error {
+	if msg.Method != headersSubscribeMethod {
+		return nil
+	}
+	var headers []electrumHeader
+	if err := json.Unmarshal(msg.Params, &headers); err != nil {
+		return fmt.Errorf("invalid electrum headers notification: %w", err)
+	}
+	for _, header := range headers {
+		log.Debug().Int64("btc_tip", header.Height).Msg("received electrum header")
+		c.setTip(header.Height)
+	}
+	return nil
+}
+
+// setTip records the tip pushed by the server and signals it if it changed.
+func (c *ElectrumClient) setTip(tip int64) {
+	c.mu.Lock()
+	changed := !c.connected || c.tip != tip
+	c.connected = true
+	c.tip = tip
+	c.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	select {
+	case c.notifications <- struct{}{}:
+	default:
+		// A signal is pending already.
+	}
+}
+
+func (c *ElectrumClient) setDisconnected() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connected = false
+}
+
+// electrumSession speaks the line delimited JSON-RPC of the electrum protocol
+// on a single connection.
+type electrumSession struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	writeMu sync.Mutex
+	nextID  uint64
+}
+
+// call sends a request and waits for its response, passing the
+// notifications received meanwhile to handle.
+func (s *electrumSession) call(
+	handle func(*electrumMessage) error, method string, params ...interface{},
+) (json.RawMessage, error) {
+	id, err := s.send(method, params...)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		msg, err := s.read()
+		if err != nil {
+			return nil, err
+		}
+		if msg.ID == nil {
+			if err := handle(msg); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if *msg.ID != id {
+			continue
+		}
+		if msg.Error != nil {
+			return nil, msg.Error
+		}
+		return msg.Result, nil
+	}
+}
+
+func (s *electrumSession) send(method string, params ...interface{}) (uint64, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.nextID++
+	if params == nil {
+		params = []interface{}{}
+	}
+	req, err := json.Marshal(electrumRequest{JSONRPC: "2.0", ID: s.nextID, Method: method, Params: params})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.conn.Write(append(req, '\n')); err != nil {
+		return 0, err
+	}
+	return s.nextID, nil
+}
+
+func (s *electrumSession) read() (*electrumMessage, error) {
+	line, err := s.reader.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	var msg electrumMessage
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return nil, fmt.Errorf("invalid electrum message: %w", err)
+	}
+	return &msg, nil
+}
+
+// ping sends a server.ping every interval until done is closed. A failed
+// write closes the connection, which fails the pending read.
+func (s *electrumSession) ping(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if _, err := s.send("server.ping"); err != nil {
+				s.conn.Close()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package btcclient
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/btcsuite/btcd/btcjson"
+)
+
+// ErrorClass tells how a failed btc request is best handled.
+type ErrorClass string
+
+const (
+	// ErrorClassTransient failures, e.g. timeouts, connection errors or an
+	// overloaded or starting node, may succeed when retried later.
+	ErrorClassTransient ErrorClass = "transient"
+	// ErrorClassAuth failures were rejected credentials or certificates,
+	// retrying only succeeds once the configuration is fixed.
+	ErrorClassAuth ErrorClass = "auth"
+	// ErrorClassPermanent failures, e.g. unknown transactions, invalid
+	// answers or unsupported queries, fail the same way when retried.
+	ErrorClassPermanent ErrorClass = "permanent"
+)
+
+// Error is a failed btc request along with its class. The backends return
+// their errors as *Error, the cause is available through errors.Is and errors.As.
+type Error struct {
+	Class ErrorClass
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ErrorClass returns the class labelling the outcome of the request in the metrics.
+func (e *Error) ErrorClass() string {
+	return string(e.Class)
+}
+
+// ClassOf returns the class of the error, classifying errors that were not
+// returned by a backend, e.g. of a wrapping client, by their cause.
+// Unknown errors are permanent.
+func ClassOf(err error) ErrorClass {
+	var (
+		btcErr     *Error
+		rpcErr     *btcjson.RPCError
+		rpcStatus  *RpcStatusError
+		httpStatus *HttpStatusError
+		certErr    *tls.CertificateVerificationError
+		netErr     net.Error
+	)
+	switch {
+	case errors.As(err, &btcErr):
+		return btcErr.Class
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return ErrorClassTransient
+	case errors.Is(err, ErrRpcUnauthorized), errors.As(err, &certErr):
+		return ErrorClassAuth
+	case errors.Is(err, ErrP2PNotSynced), errors.Is(err, ErrElectrumNotConnected), errors.Is(err, ErrNoNodeAvailable):
+		return ErrorClassTransient
+	case errors.As(err, &rpcErr):
+		if rpcErr.Code == btcjson.ErrRPCInWarmup {
+			return ErrorClassTransient
+		}
+		return ErrorClassPermanent
+	case errors.As(err, &rpcStatus):
+		return statusClass(rpcStatus.StatusCode)
+	case errors.As(err, &httpStatus):
+		return statusClass(httpStatus.StatusCode)
+	case errors.As(err, &netErr):
+		return ErrorClassTransient
+	default:
+		return ErrorClassPermanent
+	}
+}
+
+// IsTransientError reports whether the request may succeed when retried later.
+func IsTransientError(err error) bool {
+	return err != nil && ClassOf(err) == ErrorClassTransient
+}
+
+// IsAuthError reports whether the credentials or certificates were rejected.
+func IsAuthError(err error) bool {
+	return err != nil && ClassOf(err) == ErrorClassAuth
+}
+
+// statusClass classifies an unexpected HTTP status.
+func statusClass(statusCode int) ErrorClass {
+	switch {
+	case statusCode == http.StatusUnauthorized, statusCode == http.StatusForbidden:
+		return ErrorClassAuth
+	case statusCode == http.StatusTooManyRequests, statusCode >= http.StatusInternalServerError:
+		return ErrorClassTransient
+	default:
+		return ErrorClassPermanent
+	}
+}
+
+// classify wraps the error into an *Error of its class, unless it is one already.
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	var btcErr *Error
+	if errors.As(err, &btcErr) {
+		return err
+	}
+	return &Error{Class: ClassOf(err), Err: err}
+}
+
+// classified makes the request return its errors classified, so that the
+// metrics of the request are labelled by the class.
+func classified[T any](request func() (T, error)) func() (T, error) {
+	return func() (T, error) {
+		result, err := request()
+		return result, classify(err)
+	}
+}
@@ -0,0 +1,165 @@
+package btcclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/observability/metrics"
+)
+
+// maxEsploraResponseSize bounds the responses read from the esplora API.
+const maxEsploraResponseSize = 1 << 20
+
+// EsploraClient is a BtcInterface querying an Esplora/mempool HTTP API, for
+// environments without a full node of their own. Requests failing with a
+// network error, a rate limit or a server error are retried.
+type EsploraClient struct {
+	*httpApi
+}
+
+// NewEsploraClient creates a client for the API at the given base URL, e.g.
+// https://mempool.space/testnet/api.
+func NewEsploraClient(baseURL string, cfg *config.HttpRetryConfig) *EsploraClient {
+	return &EsploraClient{
+		httpApi: newHttpApi("esplora", baseURL, cfg, maxEsploraResponseSize),
+	}
+}
+
+func (c *EsploraClient) GetBlockCount(ctx context.Context) (int64, error) {
+	return metrics.RecordBtcClientMetrics[int64](classified(func() (int64, error) {
+		body, err := c.get(ctx, "/blocks/tip/height")
+		if err != nil {
+			return 0, err
+		}
+		tip, err := strconv.ParseInt(strings.TrimSpace(string(body)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid tip height from esplora: %w", err)
+		}
+		return tip, nil
+	}))
+}
+
+func (c *EsploraClient) GetRawTransaction(ctx context.Context, txHash *chainhash.Hash) (*wire.MsgTx, error) {
+	return metrics.RecordBtcClientMetrics[*wire.MsgTx](classified(func() (*wire.MsgTx, error) {
+		body, err := c.get(ctx, "/tx/"+txHash.String()+"/hex")
+		if err != nil {
+			return nil, err
+		}
+		raw, err := hex.DecodeString(strings.TrimSpace(string(body)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid transaction from esplora: %w", err)
+		}
+		var tx wire.MsgTx
+		if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+			return nil, fmt.Errorf("invalid transaction from esplora: %w", err)
+		}
+		return &tx, nil
+	}))
+}
+
+type esploraTx struct {
+	Vout []struct {
+		ScriptPubKey string `json:"scriptpubkey"`
+		Value        int64  `json:"value"`
+	} `json:"vout"`
+	Status esploraTxStatus `json:"status"`
+}
+
+type esploraTxStatus struct {
+	Confirmed   bool  `json:"confirmed"`
+	BlockHeight int64 `json:"block_height"`
+}
+
+type esploraOutspend struct {
+	Spent  bool            `json:"spent"`
+	Status esploraTxStatus `json:"status"`
+}
+
+// GetTxOut answers like the gettxout RPC of bitcoind without the mempool:
+// outputs of unknown or unconfirmed transactions and outputs spent by a
+// confirmed transaction are reported as nil.
+func (c *EsploraClient) GetTxOut(ctx context.Context, txHash *chainhash.Hash, index uint32) (*wire.TxOut, error) {
+	return metrics.RecordBtcClientMetrics[*wire.TxOut](classified(func() (*wire.TxOut, error) {
+		var tx esploraTx
+		if err := c.getJSON(ctx, "/tx/"+txHash.String(), &tx); err != nil {
+			var statusErr *HttpStatusError
+			if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if !tx.Status.Confirmed || int(index) >= len(tx.Vout) {
+			return nil, nil
+		}
+
+		var outspend esploraOutspend
+		if err := c.getJSON(ctx, fmt.Sprintf("/tx/%s/outspend/%d", txHash, index), &outspend); err != nil {
+			return nil, err
+		}
+		if outspend.Spent && outspend.Status.Confirmed {
+			return nil, nil
+		}
+
+		out := tx.Vout[index]
+		pkScript, err := hex.DecodeString(out.ScriptPubKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tx out script from esplora: %w", err)
+		}
+		return wire.NewTxOut(out.Value, pkScript), nil
+	}))
+}
+
+func (c *EsploraClient) GetTxBlockHeight(ctx context.Context, txHash *chainhash.Hash) (int64, error) {
+	return metrics.RecordBtcClientMetrics[int64](classified(func() (int64, error) {
+		var status esploraTxStatus
+		if err := c.getJSON(ctx, "/tx/"+txHash.String()+"/status", &status); err != nil {
+			return 0, err
+		}
+		if !status.Confirmed {
+			return 0, ErrTxNotConfirmed
+		}
+		return status.BlockHeight, nil
+	}))
+}
+
+func (c *EsploraClient) GetTxOutSpendHeight(ctx context.Context, txHash *chainhash.Hash, index uint32) (int64, error) {
+	return metrics.RecordBtcClientMetrics[int64](classified(func() (int64, error) {
+		var outspend esploraOutspend
+		if err := c.getJSON(ctx, fmt.Sprintf("/tx/%s/outspend/%d", txHash, index), &outspend); err != nil {
+			return 0, err
+		}
+		if !outspend.Spent || !outspend.Status.Confirmed {
+			return 0, ErrTxNotConfirmed
+		}
+		return outspend.Status.BlockHeight, nil
+	}))
+}
+
+func (c *EsploraClient) GetBlockHash(ctx context.Context, height int64) (*chainhash.Hash, error) {
+	return metrics.RecordBtcClientMetrics[*chainhash.Hash](classified(func() (*chainhash.Hash, error) {
+		body, err := c.get(ctx, "/block-height/"+strconv.FormatInt(height, 10))
+		if err != nil {
+			return nil, err
+		}
+		hash, err := chainhash.NewHashFromStr(strings.TrimSpace(string(body)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid block hash from esplora: %w", err)
+		}
+		return hash, nil
+	}))
+}
+
+// GetSyncStatus is not supported, the API only serves the chain of its synced node.
+func (c *EsploraClient) GetSyncStatus(ctx context.Context) (*SyncStatus, error) {
+	return nil, ErrUnsupported
+}
@@ -0,0 +1,234 @@
+package btcclient
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// errOrphanHeader is returned for headers whose parent is not known yet.
+var errOrphanHeader = errors.New("header does not connect to a known header")
+
+// headerNode is a validated header in the HeaderChain.
+type headerNode struct {
+	hash      chainhash.Hash
+	parent    *headerNode
+	height    int32
+	bits      uint32
+	timestamp int64
+	// workSum is the total work of the chain up to and including this header.
+	workSum *big.Int
+}
+
+func (n *headerNode) Height() int32 {
+	return n.height
+}
+
+func (n *headerNode) Bits() uint32 {
+	return n.bits
+}
+
+func (n *headerNode) Timestamp() int64 {
+	return n.timestamp
+}
+
+func (n *headerNode) Parent() blockchain.HeaderCtx {
+	// A nil parent must be returned as a nil interface, not a typed nil.
+	if n.parent == nil {
+		return nil
+	}
+	return n.parent
+}
+
+func (n *headerNode) RelativeAncestorCtx(distance int32) blockchain.HeaderCtx {
+	ancestor := n.ancestor(n.height - distance)
+	if ancestor == nil {
+		return nil
+	}
+	return ancestor
+}
+
+// ancestor returns the ancestor at the given height, or nil if there is none.
+func (n *headerNode) ancestor(height int32) *headerNode {
+	if height < 0 || height > n.height {
+		return nil
+	}
+	node := n
+	for node != nil && node.height != height {
+		node = node.parent
+	}
+	return node
+}
+
+// HeaderChain keeps the block headers received from peers, starting at the
+// genesis block of the network. Every header is checked for its proof of
+// work, its difficulty according to the retarget rules, its timestamp and
+// the checkpoints of the network before it is accepted. The best chain is
+// the one with the most cumulative work, not the longest one.
+type HeaderChain struct {
+	params     *chaincfg.Params
+	timeSource blockchain.MedianTimeSource
+
+	mu    sync.RWMutex
+	index map[chainhash.Hash]*headerNode
+	best  *headerNode
+}
+
+func NewHeaderChain(params *chaincfg.Params) *HeaderChain {
+	genesis := &headerNode{
+		hash:      *params.GenesisHash,
+		height:    0,
+		bits:      params.GenesisBlock.Header.Bits,
+		timestamp: params.GenesisBlock.Header.Timestamp.Unix(),
+		workSum:   blockchain.CalcWork(params.GenesisBlock.Header.Bits),
+	}
+	return &HeaderChain{
+		params:     params,
+		timeSource: blockchain.NewMedianTime(),
+		index:      map[chainhash.Hash]*headerNode{genesis.hash: genesis},
+		best:       genesis,
+	}
+}
+
+// BestHeight returns the height of the chain with the most work.
+func (c *HeaderChain) BestHeight() int32 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.best.height
+}
+
+// BlockHash returns the hash of the header at the height in the best chain.
+func (c *HeaderChain) BlockHash(height int64) (*chainhash.Hash, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if height < 0 || height > int64(c.best.height) {
+		return nil, fmt.Errorf("no header at height %d, the best height is %d", height, c.best.height)
+	}
+	hash := c.best.ancestor(int32(height)).hash
+	return &hash, nil
+}
+
+// ProcessHeaders validates and adds consecutive headers. Headers known
+// already are skipped. It reports whether the best chain changed. Headers
+// up to an invalid one are kept, the error tells the peer misbehaved.
+func (c *HeaderChain) ProcessHeaders(headers []*wire.BlockHeader) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previousBest := c.best
+	for _, header := range headers {
+		if err := c.addHeader(header); err != nil {
+			return c.best != previousBest, err
+		}
+	}
+	return c.best != previousBest, nil
+}
+
+func (c *HeaderChain) addHeader(header *wire.BlockHeader) error {
+	hash := header.BlockHash()
+	if _, ok := c.index[hash]; ok {
+		return nil
+	}
+	parent, ok := c.index[header.PrevBlock]
+	if !ok {
+		return fmt.Errorf("%w: %s", errOrphanHeader, hash)
+	}
+
+	err := blockchain.CheckBlockHeaderSanity(header, c.params.PowLimit, c.timeSource, blockchain.BFNone)
+	if err != nil {
+		return fmt.Errorf("invalid header %s: %w", hash, err)
+	}
+	err = blockchain.CheckBlockHeaderContext(header, parent, blockchain.BFNone, c, false)
+	if err != nil {
+		return fmt.Errorf("invalid header %s: %w", hash, err)
+	}
+
+	node := &headerNode{
+		hash:      hash,
+		parent:    parent,
+		height:    parent.height + 1,
+		bits:      header.Bits,
+		timestamp: header.Timestamp.Unix(),
+		workSum:   new(big.Int).Add(parent.workSum, blockchain.CalcWork(header.Bits)),
+	}
+	c.index[hash] = node
+	if node.workSum.Cmp(c.best.workSum) > 0 {
+		c.best = node
+	}
+	return nil
+}
+
+// BlockLocator returns the locator of the best chain, used to ask peers for
+// the headers following it: the ten most recent hashes, then exponentially
+// fewer back to the genesis block.
+func (c *HeaderChain) BlockLocator() []*chainhash.Hash {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var locator []*chainhash.Hash
+	step := int32(1)
+	node := c.best
+	for node != nil && len(locator) < wire.MaxBlockLocatorsPerMsg {
+		hash := node.hash
+		locator = append(locator, &hash)
+		if node.height == 0 {
+			break
+		}
+
+		height := node.height - step
+		if height < 0 {
+			height = 0
+		}
+		node = node.ancestor(height)
+		if len(locator) > 10 {
+			step *= 2
+		}
+	}
+	return locator
+}
+
+// The methods below provide the context of blockchain.CheckBlockHeaderContext,
+// they are called with the lock held.
+
+func (c *HeaderChain) ChainParams() *chaincfg.Params {
+	return c.params
+}
+
+func (c *HeaderChain) BlocksPerRetarget() int32 {
+	return int32(c.params.TargetTimespan / c.params.TargetTimePerBlock)
+}
+
+func (c *HeaderChain) MinRetargetTimespan() int64 {
+	return int64(c.params.TargetTimespan.Seconds()) / c.params.RetargetAdjustmentFactor
+}
+
+func (c *HeaderChain) MaxRetargetTimespan() int64 {
+	return int64(c.params.TargetTimespan.Seconds()) * c.params.RetargetAdjustmentFactor
+}
+
+func (c *HeaderChain) VerifyCheckpoint(height int32, hash *chainhash.Hash) bool {
+	for _, checkpoint := range c.params.Checkpoints {
+		if checkpoint.Height == height {
+			return checkpoint.Hash.IsEqual(hash)
+		}
+	}
+	return true
+}
+
+// FindPreviousCheckpoint returns the header of the highest checkpoint the
+// best chain reached, forks below it are rejected.
+func (c *HeaderChain) FindPreviousCheckpoint() (blockchain.HeaderCtx, error) {
+	for i := len(c.params.Checkpoints) - 1; i >= 0; i-- {
+		checkpoint := c.params.Checkpoints[i]
+		if node, ok := c.index[*checkpoint.Hash]; ok {
+			return node, nil
+		}
+	}
+	return nil, nil
+}
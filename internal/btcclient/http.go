@@ -0,0 +1,122 @@
+package btcclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+)
+
+// HttpStatusError is returned when an HTTP API answers with an unexpected status.
+type HttpStatusError struct {
+	// Api names the API that answered, e.g. esplora.
+	Api        string
+	StatusCode int
+	Body       string
+}
+
+func (e *HttpStatusError) Error() string {
+	return fmt.Sprintf("%s returned status %d: %s", e.Api, e.StatusCode, e.Body)
+}
+
+// retryable reports whether the request may succeed when sent again.
+func (e *HttpStatusError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// httpApi sends the GET requests of the backends querying an HTTP API.
+// Requests failing with a network error, a rate limit or a server error are retried.
+type httpApi struct {
+	name            string
+	baseURL         string
+	httpClient      *http.Client
+	cfg             *config.HttpRetryConfig
+	maxResponseSize int64
+}
+
+func newHttpApi(name, baseURL string, cfg *config.HttpRetryConfig, maxResponseSize int64) *httpApi {
+	return &httpApi{
+		name:            name,
+		baseURL:         strings.TrimSuffix(baseURL, "/"),
+		httpClient:      &http.Client{Timeout: cfg.RequestTimeout},
+		cfg:             cfg,
+		maxResponseSize: maxResponseSize,
+	}
+}
+
+func (a *httpApi) getJSON(ctx context.Context, path string, result interface{}) error {
+	body, err := a.get(ctx, path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("invalid response to %s request %s: %w", a.name, path, err)
+	}
+	return nil
+}
+
+// get requests the path, retrying with a doubling backoff until a request
+// succeeds, fails permanently or the retries are exhausted.
+func (a *httpApi) get(ctx context.Context, path string) ([]byte, error) {
+	backoff := a.cfg.RetryBackoff
+	var lastErr error
+	for attempt := 0; attempt <= a.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return nil, fmt.Errorf("%s request %s cancelled: %w", a.name, path, errors.Join(ctx.Err(), lastErr))
+			}
+			backoff *= 2
+		}
+
+		body, err := a.doGet(ctx, path)
+		if err == nil {
+			return body, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+
+		var statusErr *HttpStatusError
+		if errors.As(err, &statusErr) && !statusErr.retryable() {
+			break
+		}
+	}
+
+	return nil, fmt.Errorf("%s request %s failed: %w", a.name, path, lastErr)
+}
+
+func (a *httpApi) doGet(ctx context.Context, path string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, a.cfg.RequestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := a.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, a.maxResponseSize))
+	if err != nil {
+		// The connection broke off while reading the response.
+		return nil, &Error{Class: ErrorClassTransient, Err: err}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HttpStatusError{Api: a.name, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+
+	return body, nil
+}
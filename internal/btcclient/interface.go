@@ -1,5 +1,68 @@
 package btcclient
 
+import (
+	"context"
+	"errors"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ErrUnsupported is returned by backends that cannot answer a query, e.g.
+// transaction lookups of a backend only tracking the headers.
+var ErrUnsupported = errors.New("not supported by the btc backend")
+
+// ErrTxNotConfirmed is returned for transactions not included in a block yet.
+var ErrTxNotConfirmed = errors.New("transaction not confirmed")
+
+// BtcInterface queries the Bitcoin chain. Every request honors the deadline
+// and cancellation of its context. Failed requests return an *Error telling
+// whether the failure is transient, an auth failure or permanent, queries a
+// backend cannot answer return ErrUnsupported, which is permanent, see ClassOf.
 type BtcInterface interface {
-	GetBlockCount() (int64, error)
+	GetBlockCount(ctx context.Context) (int64, error)
+	// GetRawTransaction returns the transaction with the given hash.
+	GetRawTransaction(ctx context.Context, txHash *chainhash.Hash) (*wire.MsgTx, error)
+	// GetTxOut returns the output of a confirmed transaction if it is unspent,
+	// or nil if it was spent by a confirmed transaction or does not exist.
+	GetTxOut(ctx context.Context, txHash *chainhash.Hash, index uint32) (*wire.TxOut, error)
+	// GetTxBlockHeight returns the height of the block including the
+	// transaction, or ErrTxNotConfirmed if it is not included yet.
+	GetTxBlockHeight(ctx context.Context, txHash *chainhash.Hash) (int64, error)
+	// GetTxOutSpendHeight returns the height of the block including the
+	// transaction spending the output, or ErrTxNotConfirmed if the output is
+	// unspent or only spent in the mempool.
+	GetTxOutSpendHeight(ctx context.Context, txHash *chainhash.Hash, index uint32) (int64, error)
+	// GetBlockHash returns the hash of the block at the height in the best chain.
+	GetBlockHash(ctx context.Context, height int64) (*chainhash.Hash, error)
+	// GetSyncStatus returns how far the node synced the chain.
+	GetSyncStatus(ctx context.Context) (*SyncStatus, error)
+}
+
+// maxSyncedHeaderLag is the number of blocks a synced node may know the
+// header of without having the block yet, e.g. while downloading the newest block.
+const maxSyncedHeaderLag = 1
+
+// SyncStatus tells whether a node is still catching up with the chain.
+type SyncStatus struct {
+	InitialBlockDownload bool
+	// Blocks is the height of the most recent validated block.
+	Blocks int64
+	// Headers is the height of the most recent known header.
+	Headers int64
+}
+
+// IsSyncing reports whether the tip of the node lags behind the chain.
+func (s *SyncStatus) IsSyncing() bool {
+	return s.InitialBlockDownload || s.Headers-s.Blocks > maxSyncedHeaderLag
+}
+
+// BlockNotifier signals new blocks, so that they are processed without
+// waiting for the next poll.
+type BlockNotifier interface {
+	// Notifications returns the channel signalled when a new block arrived.
+	Notifications() <-chan struct{}
+	// Start delivers notifications until the context is cancelled or the notifier is stopped.
+	Start(ctx context.Context)
+	Stop()
 }
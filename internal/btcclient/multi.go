@@ -0,0 +1,468 @@
+package btcclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/rs/zerolog/log"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/observability/metrics"
+)
+
+// ErrNoNodeAvailable is returned in quorum mode while every node failed
+// recently or lags behind.
+var ErrNoNodeAvailable = errors.New("no healthy and caught up btc node available")
+
+// Node is a single Bitcoin node used by the MultiBtcClient.
+type Node struct {
+	// Name identifies the node in logs and metrics, e.g. its endpoint.
+	Name   string
+	Client BtcInterface
+}
+
+type nodeState struct {
+	Node
+	healthy bool
+	// lagging is set by health checks when the node is too far behind the median tip.
+	lagging bool
+	// retryAt is when a failed node is tried again.
+	retryAt time.Time
+}
+
+// MultiBtcClient is a BtcInterface backed by several nodes. Without a quorum
+// mode it uses the first healthy node and fails over to the next one. In
+// quorum mode it asks all healthy nodes and uses the minimum or median tip,
+// and requires a quorum of them to agree on block hashes.
+// Nodes that fail are skipped for the health check interval, nodes lagging
+// behind the median tip are skipped until a health check finds them caught up.
+type MultiBtcClient struct {
+	quorumMode          string
+	quorumSize          int
+	healthCheckInterval time.Duration
+	maxTipLag           uint64
+
+	mu              sync.Mutex
+	nodes           []*nodeState
+	lastHealthCheck time.Time
+	checking        atomic.Bool
+	// noneAvailable is set while no node is available, so that it is only
+	// logged once.
+	noneAvailable bool
+}
+
+func NewMultiBtcClient(nodes []Node, cfg *config.BtcConfig) *MultiBtcClient {
+	states := make([]*nodeState, 0, len(nodes))
+	for _, node := range nodes {
+		states = append(states, &nodeState{Node: node, healthy: true})
+		metrics.RecordBtcNodeHealth(node.Name, true)
+	}
+
+	quorumSize := cfg.QuorumSize
+	if quorumSize == 0 {
+		quorumSize = len(nodes)/2 + 1
+	}
+
+	return &MultiBtcClient{
+		quorumMode:          cfg.QuorumMode,
+		quorumSize:          quorumSize,
+		healthCheckInterval: cfg.HealthCheckInterval,
+		maxTipLag:           cfg.MaxTipLag,
+		nodes:               states,
+		lastHealthCheck:     time.Now(),
+	}
+}
+
+func (c *MultiBtcClient) GetBlockCount(ctx context.Context) (int64, error) {
+	c.maybeCheckHealth()
+
+	if c.quorumMode == config.QuorumModeNone {
+		return c.failoverBlockCount(ctx)
+	}
+	return c.quorumBlockCount(ctx)
+}
+
+// GetRawTransaction asks the available nodes in order until one answers.
+// Lookups do not depend on the tip, so no quorum is needed, and a node not
+// knowing a transaction is not considered failed.
+func (c *MultiBtcClient) GetRawTransaction(ctx context.Context, txHash *chainhash.Hash) (*wire.MsgTx, error) {
+	return lookup(ctx, c, func(client BtcInterface) (*wire.MsgTx, error) {
+		return client.GetRawTransaction(ctx, txHash)
+	})
+}
+
+// GetTxOut asks the available nodes in order until one answers.
+func (c *MultiBtcClient) GetTxOut(ctx context.Context, txHash *chainhash.Hash, index uint32) (*wire.TxOut, error) {
+	return lookup(ctx, c, func(client BtcInterface) (*wire.TxOut, error) {
+		return client.GetTxOut(ctx, txHash, index)
+	})
+}
+
+// GetTxBlockHeight asks the available nodes in order until one answers.
+func (c *MultiBtcClient) GetTxBlockHeight(ctx context.Context, txHash *chainhash.Hash) (int64, error) {
+	return lookup(ctx, c, func(client BtcInterface) (int64, error) {
+		return client.GetTxBlockHeight(ctx, txHash)
+	})
+}
+
+// GetTxOutSpendHeight asks the available nodes in order until one answers.
+func (c *MultiBtcClient) GetTxOutSpendHeight(ctx context.Context, txHash *chainhash.Hash, index uint32) (int64, error) {
+	return lookup(ctx, c, func(client BtcInterface) (int64, error) {
+		return client.GetTxOutSpendHeight(ctx, txHash, index)
+	})
+}
+
+// GetBlockHash asks the available nodes in order until one answers. In quorum
+// mode all available nodes are asked and a quorum of them must agree on the
+// hash, so that a single node on a wrong fork can neither fake nor hide a reorg.
+func (c *MultiBtcClient) GetBlockHash(ctx context.Context, height int64) (*chainhash.Hash, error) {
+	query := func(client BtcInterface) (*chainhash.Hash, error) {
+		return client.GetBlockHash(ctx, height)
+	}
+	if c.quorumMode == config.QuorumModeNone {
+		return lookup(ctx, c, query)
+	}
+
+	nodes := c.availableNodes()
+	if len(nodes) == 0 {
+		return nil, ErrNoNodeAvailable
+	}
+	// A node not knowing the height, e.g. because it lags behind, is not
+	// considered failed.
+	hashes, errs := queryAll(ctx, c, nodes, query, false)
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("btc block hash request aborted: %w", errors.Join(append(errs, ctx.Err())...))
+	}
+
+	votes := make(map[chainhash.Hash]int)
+	for _, hash := range hashes {
+		votes[*hash]++
+	}
+	var (
+		agreed   []chainhash.Hash
+		maxVotes int
+	)
+	for hash, count := range votes {
+		maxVotes = max(maxVotes, count)
+		if count >= c.quorumSize {
+			agreed = append(agreed, hash)
+		}
+	}
+	switch {
+	case len(agreed) == 1:
+		return &agreed[0], nil
+	case len(agreed) > 1:
+		return nil, fmt.Errorf("btc nodes disagree on the block hash at height %d", height)
+	}
+
+	var failures []error
+	for _, err := range errs {
+		if !errors.Is(err, ErrUnsupported) {
+			failures = append(failures, err)
+		}
+	}
+	if len(hashes) == 0 && len(failures) == 0 {
+		return nil, ErrUnsupported
+	}
+	return nil, fmt.Errorf(
+		"only %d of the required %d btc nodes agree on the block hash at height %d: %w",
+		maxVotes, c.quorumSize, height, errors.Join(failures...),
+	)
+}
+
+// GetSyncStatus asks the available nodes in order until one answers.
+func (c *MultiBtcClient) GetSyncStatus(ctx context.Context) (*SyncStatus, error) {
+	return lookup(ctx, c, func(client BtcInterface) (*SyncStatus, error) {
+		return client.GetSyncStatus(ctx)
+	})
+}
+
+// lookup returns the answer of the first available node answering the
+// query. Once the context is done the remaining nodes are not asked.
+func lookup[T any](ctx context.Context, c *MultiBtcClient, query func(BtcInterface) (T, error)) (T, error) {
+	var (
+		zero    T
+		lastErr = ErrUnsupported
+	)
+	nodes := c.availableNodes()
+	if len(nodes) == 0 {
+		return zero, ErrNoNodeAvailable
+	}
+	for _, node := range nodes {
+		result, err := query(node.Client)
+		if err == nil {
+			return result, nil
+		}
+		if !errors.Is(err, ErrUnsupported) {
+			lastErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return zero, lastErr
+}
+
+// failoverBlockCount returns the tip of the first available node that answers.
+// A node is not blamed for requests aborted by the context.
+func (c *MultiBtcClient) failoverBlockCount(ctx context.Context) (int64, error) {
+	var lastErr error
+	for _, node := range c.availableNodes() {
+		tip, err := node.Client.GetBlockCount(ctx)
+		if ctx.Err() != nil {
+			return 0, fmt.Errorf("btc tip request aborted: %w", errors.Join(ctx.Err(), err))
+		}
+		if err != nil {
+			c.markFailure(node, err)
+			lastErr = err
+			continue
+		}
+		c.markSuccess(node)
+		return tip, nil
+	}
+
+	return 0, fmt.Errorf("no btc node answered: %w", lastErr)
+}
+
+// quorumBlockCount asks all available nodes for their tip and returns the
+// minimum or median of the answers, provided enough nodes answered.
+func (c *MultiBtcClient) quorumBlockCount(ctx context.Context) (int64, error) {
+	nodes := c.availableNodes()
+	if len(nodes) == 0 {
+		return 0, ErrNoNodeAvailable
+	}
+	tips, errs := queryAll(ctx, c, nodes, func(client BtcInterface) (int64, error) {
+		return client.GetBlockCount(ctx)
+	}, true)
+	if ctx.Err() != nil {
+		return 0, fmt.Errorf("btc tip request aborted: %w", errors.Join(append(errs, ctx.Err())...))
+	}
+	if len(tips) < c.quorumSize {
+		return 0, fmt.Errorf(
+			"only %d of the required %d btc nodes answered: %w",
+			len(tips), c.quorumSize, errors.Join(errs...),
+		)
+	}
+
+	sort.Slice(tips, func(i, j int) bool { return tips[i] < tips[j] })
+	if c.quorumMode == config.QuorumModeMin {
+		return tips[0], nil
+	}
+	// The lower median, so that an even split never rounds up.
+	return tips[(len(tips)-1)/2], nil
+}
+
+// queryAll asks the nodes concurrently, returning the answers of the nodes
+// that answered and the errors of the others. If blame is set, the nodes are
+// marked as failed or recovered by their answer, except for requests aborted
+// by the context.
+func queryAll[T any](
+	ctx context.Context, c *MultiBtcClient, nodes []*nodeState, query func(BtcInterface) (T, error), blame bool,
+) ([]T, []error) {
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results []T
+		errs    []error
+	)
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(node *nodeState) {
+			defer wg.Done()
+			result, err := query(node.Client)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if blame && ctx.Err() == nil {
+					c.markFailure(node, err)
+				}
+				errs = append(errs, fmt.Errorf("%s: %w", node.Name, err))
+				return
+			}
+			if blame {
+				c.markSuccess(node)
+			}
+			results = append(results, result)
+		}(node)
+	}
+	wg.Wait()
+
+	return results, errs
+}
+
+// availableNodes returns the nodes to query in their configured order. If
+// no node is available, all nodes are returned as a last resort, including
+// the lagging ones. In quorum mode none are returned instead, as lagging or
+// failing nodes must not decide the tip.
+func (c *MultiBtcClient) availableNodes() []*nodeState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	var available []*nodeState
+	for _, node := range c.nodes {
+		if !node.lagging && (node.healthy || now.After(node.retryAt)) {
+			available = append(available, node)
+		}
+	}
+	if len(available) > 0 {
+		if c.noneAvailable {
+			log.Info().Int("available", len(available)).Msg("btc nodes available again")
+			c.noneAvailable = false
+		}
+		return available
+	}
+
+	refused := c.quorumMode != config.QuorumModeNone
+	metrics.RecordBtcNoNodeAvailable(refused)
+	if !c.noneAvailable {
+		if refused {
+			log.Error().Int("nodes", len(c.nodes)).
+				Msg("no healthy and caught up btc node available, refusing requests in quorum mode")
+		} else {
+			log.Warn().Int("nodes", len(c.nodes)).
+				Msg("no healthy and caught up btc node available, falling back to all nodes")
+		}
+		c.noneAvailable = true
+	}
+	if refused {
+		return nil
+	}
+	return c.nodes
+}
+
+func (c *MultiBtcClient) markFailure(node *nodeState, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if node.healthy {
+		log.Warn().Err(err).Str("node", node.Name).Str("error_class", string(ClassOf(err))).
+			Msg("btc node failed, skipping it")
+		metrics.RecordBtcNodeHealth(node.Name, false)
+	}
+	node.healthy = false
+	node.retryAt = time.Now().Add(c.healthCheckInterval)
+}
+
+func (c *MultiBtcClient) markSuccess(node *nodeState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !node.healthy {
+		log.Info().Str("node", node.Name).Msg("btc node recovered")
+		metrics.RecordBtcNodeHealth(node.Name, !node.lagging)
+	}
+	node.healthy = true
+}
+
+// maybeCheckHealth starts a health check in the background once the health
+// check interval passed since the last one.
+func (c *MultiBtcClient) maybeCheckHealth() {
+	c.mu.Lock()
+	due := time.Since(c.lastHealthCheck) >= c.healthCheckInterval
+	c.mu.Unlock()
+
+	if due && c.checking.CompareAndSwap(false, true) {
+		go func() {
+			defer c.checking.Store(false)
+			c.checkHealth()
+		}()
+	}
+}
+
+// checkHealth asks every node for its tip, marking nodes that fail as failed
+// and nodes lagging more than the max tip lag behind the median tip as lagging.
+// The median is used so that a single node reporting a tip too high can not
+// get the others skipped. Lagging nodes are only skipped as long as enough
+// nodes are left for a quorum, the least lagging ones are kept otherwise.
+func (c *MultiBtcClient) checkHealth() {
+	c.mu.Lock()
+	nodes := c.nodes
+	c.mu.Unlock()
+
+	// A node not answering until the next check is due counts as failed, and
+	// does not hold back the following checks.
+	ctx, cancel := context.WithTimeout(context.Background(), c.healthCheckInterval)
+	defer cancel()
+
+	tips := make([]int64, len(nodes))
+	answered := make([]bool, len(nodes))
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node *nodeState) {
+			defer wg.Done()
+			tip, err := node.Client.GetBlockCount(ctx)
+			if err != nil {
+				c.markFailure(node, err)
+				return
+			}
+			c.markSuccess(node)
+			tips[i], answered[i] = tip, true
+		}(i, node)
+	}
+	wg.Wait()
+
+	var answeredTips []int64
+	for i, tip := range tips {
+		if answered[i] {
+			answeredTips = append(answeredTips, tip)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastHealthCheck = time.Now()
+	if len(answeredTips) == 0 {
+		return
+	}
+	sort.Slice(answeredTips, func(i, j int) bool { return answeredTips[i] < answeredTips[j] })
+	// The lower median, as for the quorum tip.
+	median := answeredTips[(len(answeredTips)-1)/2]
+
+	lagging := make([]bool, len(nodes))
+	var inSync int
+	for i := range nodes {
+		if !answered[i] {
+			continue
+		}
+		lagging[i] = median-tips[i] > int64(c.maxTipLag)
+		if !lagging[i] {
+			inSync++
+		}
+	}
+	// Keep the least lagging nodes until enough are available for a quorum.
+	for inSync < c.quorumSize {
+		closest := -1
+		for i := range nodes {
+			if lagging[i] && (closest < 0 || tips[i] > tips[closest]) {
+				closest = i
+			}
+		}
+		if closest < 0 {
+			break
+		}
+		lagging[closest] = false
+		inSync++
+	}
+
+	for i, node := range nodes {
+		if !answered[i] {
+			continue
+		}
+		if lagging[i] != node.lagging {
+			log.Warn().Str("node", node.Name).Int64("tip", tips[i]).Int64("median_tip", median).
+				Bool("lagging", lagging[i]).Msg("btc node lag changed")
+			metrics.RecordBtcNodeHealth(node.Name, !lagging[i])
+		}
+		node.lagging = lagging[i]
+	}
+}
@@ -0,0 +1,315 @@
+package btcclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/rs/zerolog/log"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/observability/metrics"
+)
+
+const p2pUserAgentName = "staking-expiry-checker"
+
+// ErrP2PNotSynced is returned until the headers were synced with enough peers.
+var ErrP2PNotSynced = errors.New("block headers are not synced with enough peers yet")
+
+// P2PClient is a BtcInterface syncing the block headers from Bitcoin peers
+// into a HeaderChain, which validates their proof of work. The tip is the
+// height of the chain with the most work, so that no single peer, and no
+// RPC node, has to be trusted for the height driving the expiries. Peers
+// sending invalid headers are disconnected. Every new tip is signalled on
+// the notifications channel, coalesced like the ones of the BlockSubscriber.
+type P2PClient struct {
+	addresses     []string
+	params        *chaincfg.Params
+	cfg           *config.P2PConfig
+	chain         *HeaderChain
+	notifications chan struct{}
+	quit          chan struct{}
+	started       atomic.Bool
+	stopOnce      sync.Once
+	// synced is set once enough peers had no further headers to send and
+	// the chain reached the height they advertised.
+	synced atomic.Bool
+
+	syncedPeersMu sync.Mutex
+	syncedPeers   map[string]struct{}
+}
+
+// NewP2PClient creates a client for the peers at the given host:port
+// addresses. The client connects to nothing before it is started.
+func NewP2PClient(addresses []string, params *chaincfg.Params, cfg *config.P2PConfig) *P2PClient {
+	return &P2PClient{
+		addresses:     addresses,
+		params:        params,
+		cfg:           cfg,
+		chain:         NewHeaderChain(params),
+		notifications: make(chan struct{}, 1),
+		quit:          make(chan struct{}),
+		syncedPeers:   make(map[string]struct{}),
+	}
+}
+
+func (c *P2PClient) GetBlockCount(ctx context.Context) (int64, error) {
+	return metrics.RecordBtcClientMetrics[int64](classified(func() (int64, error) {
+		// A partially synced chain is behind the real tip, which is safe
+		// but would hold back every expiry until the sync completed.
+		if !c.synced.Load() {
+			return 0, ErrP2PNotSynced
+		}
+		return int64(c.chain.BestHeight()), nil
+	}))
+}
+
+// GetRawTransaction is not supported. Only the headers are synced, transactions cannot be looked up.
+func (c *P2PClient) GetRawTransaction(ctx context.Context, txHash *chainhash.Hash) (*wire.MsgTx, error) {
+	return nil, ErrUnsupported
+}
+
+// GetTxOut is not supported. Only the headers are synced, transactions cannot be looked up.
+func (c *P2PClient) GetTxOut(ctx context.Context, txHash *chainhash.Hash, index uint32) (*wire.TxOut, error) {
+	return nil, ErrUnsupported
+}
+
+// GetTxBlockHeight is not supported, block contents are not downloaded.
+func (c *P2PClient) GetTxBlockHeight(ctx context.Context, txHash *chainhash.Hash) (int64, error) {
+	return 0, ErrUnsupported
+}
+
+// GetTxOutSpendHeight is not supported, block contents are not downloaded.
+func (c *P2PClient) GetTxOutSpendHeight(ctx context.Context, txHash *chainhash.Hash, index uint32) (int64, error) {
+	return 0, ErrUnsupported
+}
+
+// GetBlockHash returns the hash of the header at the height in the chain
+// with the most work.
+func (c *P2PClient) GetBlockHash(ctx context.Context, height int64) (*chainhash.Hash, error) {
+	return metrics.RecordBtcClientMetrics[*chainhash.Hash](classified(func() (*chainhash.Hash, error) {
+		if !c.synced.Load() {
+			return nil, ErrP2PNotSynced
+		}
+		return c.chain.BlockHash(height)
+	}))
+}
+
+// GetSyncStatus reports the header chain as syncing until enough peers had
+// no further headers to send.
+func (c *P2PClient) GetSyncStatus(ctx context.Context) (*SyncStatus, error) {
+	height := int64(c.chain.BestHeight())
+	return &SyncStatus{
+		InitialBlockDownload: !c.synced.Load(),
+		Blocks:               height,
+		Headers:              height,
+	}, nil
+}
+
+// Notifications returns the channel signalled when the best chain changed.
+func (c *P2PClient) Notifications() <-chan struct{} {
+	return c.notifications
+}
+
+// Start keeps a connection to every peer until the context is cancelled or
+// the client is stopped, reconnecting whenever a connection is lost.
+// Starting an already started client returns immediately.
+func (c *P2PClient) Start(ctx context.Context) {
+	if !c.started.CompareAndSwap(false, true) {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-c.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, address := range c.addresses {
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+			c.maintainPeer(ctx, address)
+		}(address)
+	}
+	wg.Wait()
+}
+
+func (c *P2PClient) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.quit)
+	})
+}
+
+func (c *P2PClient) maintainPeer(ctx context.Context, address string) {
+	for {
+		if err := c.connectPeer(ctx, address); err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Str("peer", address).Msg("bitcoin peer connection failed, reconnecting")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(c.cfg.ReconnectInterval):
+		}
+	}
+}
+
+// connectPeer connects to the peer and syncs headers from it until it disconnects.
+func (c *P2PClient) connectPeer(ctx context.Context, address string) error {
+	dialer := &net.Dialer{Timeout: c.cfg.ConnectTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+
+	verAck := make(chan struct{}, 1)
+	peerCfg := &peer.Config{
+		UserAgentName:    p2pUserAgentName,
+		UserAgentVersion: "1.0.0",
+		ChainParams:      c.params,
+		DisableRelayTx:   true,
+		TrickleInterval:  time.Second,
+		// The client never accepts connections, so it cannot be connected to
+		// itself. The check would only trip over peers in the same process.
+		AllowSelfConns: true,
+		Listeners: peer.MessageListeners{
+			OnVerAck: func(p *peer.Peer, msg *wire.MsgVerAck) {
+				verAck <- struct{}{}
+			},
+			OnHeaders: c.onHeaders,
+			OnInv:     c.onInv,
+		},
+	}
+	// The resolved address, the peer package only understands IP addresses.
+	p, err := peer.NewOutboundPeer(peerCfg, conn.RemoteAddr().String())
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	p.AssociateConnection(conn)
+	defer func() {
+		p.Disconnect()
+		p.WaitForDisconnect()
+	}()
+
+	disconnected := make(chan struct{})
+	go func() {
+		p.WaitForDisconnect()
+		close(disconnected)
+	}()
+
+	select {
+	case <-verAck:
+	case <-disconnected:
+		return fmt.Errorf("version handshake failed")
+	case <-time.After(c.cfg.ConnectTimeout):
+		return fmt.Errorf("version handshake timed out")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	log.Info().Str("peer", address).Int32("peer_height", p.StartingHeight()).Msg("connected to bitcoin peer")
+
+	// New blocks are announced by their headers instead of an inv.
+	p.QueueMessage(wire.NewMsgSendHeaders(), nil)
+	c.requestHeaders(p)
+
+	select {
+	case <-disconnected:
+		return fmt.Errorf("peer disconnected")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// requestHeaders asks the peer for the headers following the best chain.
+func (c *P2PClient) requestHeaders(p *peer.Peer) {
+	msg := wire.NewMsgGetHeaders()
+	for _, hash := range c.chain.BlockLocator() {
+		if err := msg.AddBlockLocatorHash(hash); err != nil {
+			break
+		}
+	}
+	p.QueueMessage(msg, nil)
+}
+
+func (c *P2PClient) onHeaders(p *peer.Peer, msg *wire.MsgHeaders) {
+	changed, err := c.chain.ProcessHeaders(msg.Headers)
+	if changed {
+		log.Debug().Int32("btc_tip", c.chain.BestHeight()).Str("peer", p.Addr()).Msg("best header chain changed")
+		select {
+		case c.notifications <- struct{}{}:
+		default:
+			// A signal is pending already.
+		}
+	}
+
+	switch {
+	case errors.Is(err, errOrphanHeader):
+		// An announced header whose parent is missing, catch up first.
+		c.requestHeaders(p)
+	case err != nil:
+		log.Warn().Err(err).Str("peer", p.Addr()).Msg("bitcoin peer sent invalid headers, disconnecting")
+		p.Disconnect()
+	case len(msg.Headers) == wire.MaxBlockHeadersPerMsg:
+		// The peer has more headers to send.
+		c.requestHeaders(p)
+	default:
+		c.markPeerSynced(p)
+	}
+}
+
+// markPeerSynced records that the peer had no further headers to send, and
+// marks the chain synced once enough peers did. A peer only counts once the
+// chain reached the height it advertised when connecting, a peer which is
+// still syncing itself or withholds headers must not end the sync early.
+// With several peers configured, at least two have to count, so that no
+// single peer decides when the expiries start.
+func (c *P2PClient) markPeerSynced(p *peer.Peer) {
+	if c.synced.Load() {
+		return
+	}
+
+	tip := c.chain.BestHeight()
+	if tip < p.StartingHeight() {
+		log.Debug().Str("peer", p.Addr()).Int32("btc_tip", tip).Int32("peer_height", p.StartingHeight()).
+			Msg("bitcoin peer has no further headers below its advertised height")
+		return
+	}
+
+	c.syncedPeersMu.Lock()
+	defer c.syncedPeersMu.Unlock()
+	c.syncedPeers[p.Addr()] = struct{}{}
+	if len(c.syncedPeers) < c.requiredSyncedPeers() {
+		return
+	}
+	if c.synced.CompareAndSwap(false, true) {
+		log.Info().Int32("btc_tip", tip).Int("peers", len(c.syncedPeers)).Msg("block headers synced")
+	}
+}
+
+func (c *P2PClient) requiredSyncedPeers() int {
+	return min(2, len(c.addresses))
+}
+
+func (c *P2PClient) onInv(p *peer.Peer, msg *wire.MsgInv) {
+	for _, inv := range msg.InvList {
+		if inv.Type == wire.InvTypeBlock || inv.Type == wire.InvTypeWitnessBlock {
+			c.requestHeaders(p)
+			return
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package btcclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+)
+
+// maxRpcResponseSize bounds the responses read from the RPC server.
+const maxRpcResponseSize = 32 << 20
+
+// ErrRpcUnauthorized is returned when the RPC server rejects the credentials.
+var ErrRpcUnauthorized = errors.New("rpc server rejected the credentials")
+
+// RpcStatusError is returned when the RPC server answers with an unexpected
+// status and no JSON-RPC error, e.g. when its work queue is full.
+type RpcStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *RpcStatusError) Error() string {
+	return fmt.Sprintf("rpc server returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// rpcClient posts JSON-RPC requests to bitcoind. Unlike rpcclient it uses its
+// own http client, so that requests are bounded by a timeout and connections
+// can present client certificates.
+type rpcClient struct {
+	url        string
+	httpClient *http.Client
+	auth       rpcAuth
+	nextID     atomic.Uint64
+}
+
+type rpcRequest struct {
+	Version string        `json:"jsonrpc"`
+	ID      uint64        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage   `json:"result"`
+	Error  *btcjson.RPCError `json:"error"`
+}
+
+func newRpcClient(endpoint config.BtcEndpointConfig, timeout time.Duration) (*rpcClient, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if endpoint.Proxy != "" {
+		proxyURL, err := url.Parse(endpoint.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	scheme := "http"
+	if !endpoint.DisableTLS {
+		scheme = "https"
+		tlsConfig, err := newTLSConfig(&endpoint.TLS)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	var auth rpcAuth = &staticAuth{user: endpoint.RpcUser, pass: endpoint.RpcPass}
+	if endpoint.RpcCookieFile != "" {
+		auth = &cookieAuth{path: endpoint.RpcCookieFile}
+	}
+
+	return &rpcClient{
+		url:        scheme + "://" + endpoint.Endpoint,
+		httpClient: &http.Client{Transport: transport, Timeout: timeout},
+		auth:       auth,
+	}, nil
+}
+
+// newTLSConfig loads the trusted CAs and the client certificate, if configured.
+func newTLSConfig(cfg *config.BtcTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CACert != "" {
+		pem, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tls ca cert: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in tls ca cert %s", cfg.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tls client cert: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// call sends the request and decodes its result into result, which may be
+// nil to discard it. Errors returned by the server are *btcjson.RPCError.
+// The request is bounded by the context as well as the request timeout.
+func (c *rpcClient) call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	body, err := json.Marshal(rpcRequest{
+		Version: "1.0",
+		ID:      c.nextID.Add(1),
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.post(ctx, body, false)
+	if errors.Is(err, ErrRpcUnauthorized) {
+		// The cookie may have been rotated since it was read.
+		resp, err = c.post(ctx, body, true)
+	}
+	if err != nil {
+		return err
+	}
+
+	var rpcResp rpcResponse
+	if err := json.Unmarshal(resp, &rpcResp); err != nil {
+		return fmt.Errorf("invalid response to rpc %s: %w", method, err)
+	}
+	if rpcResp.Error != nil {
+		return rpcResp.Error
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(rpcResp.Result, result); err != nil {
+		return fmt.Errorf("invalid result of rpc %s: %w", method, err)
+	}
+	return nil
+}
+
+func (c *rpcClient) post(ctx context.Context, body []byte, reloadAuth bool) ([]byte, error) {
+	user, pass, err := c.auth.credentials(reloadAuth)
+	if err != nil {
+		// Without credentials the server cannot be queried at all.
+		return nil, &Error{Class: ErrorClassAuth, Err: err}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(user, pass)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrRpcUnauthorized
+	}
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxRpcResponseSize))
+	if err != nil {
+		// The connection broke off while reading the response.
+		return nil, &Error{Class: ErrorClassTransient, Err: err}
+	}
+	// bitcoind answers failed calls with an error status and the error in the body.
+	if resp.StatusCode != http.StatusOK && !json.Valid(respBody) {
+		return nil, &RpcStatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(respBody))}
+	}
+	return respBody, nil
+}
+
+// rpcAuth provides the credentials of the RPC server.
+type rpcAuth interface {
+	// credentials returns the user and password, reloaded from their source
+	// if reload is set, e.g. after the server rejected them.
+	credentials(reload bool) (string, string, error)
+}
+
+type staticAuth struct {
+	user string
+	pass string
+}
+
+func (a *staticAuth) credentials(bool) (string, string, error) {
+	return a.user, a.pass, nil
+}
+
+// cookieAuth reads the credentials from the cookie file bitcoind writes on
+// every start, reading it again whenever it was modified.
+type cookieAuth struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	user    string
+	pass    string
+}
+
+func (a *cookieAuth) credentials(reload bool) (string, string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	info, err := os.Stat(a.path)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read rpc cookie file: %w", err)
+	}
+	if reload || !info.ModTime().Equal(a.modTime) {
+		content, err := os.ReadFile(a.path)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read rpc cookie file: %w", err)
+		}
+		user, pass, ok := strings.Cut(strings.TrimSpace(string(content)), ":")
+		if !ok {
+			return "", "", fmt.Errorf("malformed rpc cookie file %s", a.path)
+		}
+		a.user, a.pass, a.modTime = user, pass, info.ModTime()
+	}
+	return a.user, a.pass, nil
+}
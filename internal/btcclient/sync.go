@@ -0,0 +1,95 @@
+package btcclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/observability/metrics"
+)
+
+// ErrNodeSyncing is returned while the node is still catching up with the chain.
+var ErrNodeSyncing = errors.New("btc node is syncing")
+
+// SyncMonitor checks that the node is synced before its tip is used, and
+// tracks when the tip last changed to report a stalled chain.
+type SyncMonitor struct {
+	client         BtcInterface
+	requireSynced  bool
+	stallThreshold time.Duration
+
+	mu        sync.Mutex
+	tip       int64
+	changedAt time.Time
+	stalled   bool
+}
+
+func NewSyncMonitor(client BtcInterface, cfg *config.BtcConfig) *SyncMonitor {
+	return &SyncMonitor{
+		client:         client,
+		requireSynced:  cfg.RequireSynced,
+		stallThreshold: cfg.StallThreshold,
+	}
+}
+
+// Check records the tip and returns ErrNodeSyncing if the node is syncing
+// and a synced node is required. A stalled tip is only reported, processing
+// a stale tip is safe as expiries are merely delayed.
+func (m *SyncMonitor) Check(ctx context.Context, tip int64) error {
+	sinceChange, stalled, stallChanged := m.observeTip(tip)
+	if stallChanged {
+		if stalled {
+			log.Warn().Int64("btc_tip", tip).Dur("since_change", sinceChange).
+				Msg("btc tip has not advanced within the stall threshold")
+		} else {
+			log.Info().Int64("btc_tip", tip).Msg("btc tip advanced again")
+		}
+	}
+
+	syncing := false
+	var status *SyncStatus
+	if m.requireSynced {
+		var err error
+		status, err = m.client.GetSyncStatus(ctx)
+		switch {
+		case errors.Is(err, ErrUnsupported):
+			// Backends without a sync status only serve synced chains.
+		case err != nil:
+			return fmt.Errorf("failed to get the btc sync status: %w", err)
+		default:
+			syncing = status.IsSyncing()
+		}
+	}
+
+	metrics.RecordBtcSyncState(syncing, stalled, sinceChange)
+	if syncing {
+		return fmt.Errorf(
+			"%w: initial block download %t, blocks %d, headers %d",
+			ErrNodeSyncing, status.InitialBlockDownload, status.Blocks, status.Headers,
+		)
+	}
+	return nil
+}
+
+// observeTip records the tip, returning how long ago it last changed,
+// whether it is stalled and whether that changed with this observation.
+func (m *SyncMonitor) observeTip(tip int64) (time.Duration, bool, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if m.changedAt.IsZero() || tip != m.tip {
+		m.tip = tip
+		m.changedAt = now
+	}
+	sinceChange := now.Sub(m.changedAt)
+	stalled := m.stallThreshold > 0 && sinceChange > m.stallThreshold
+	stallChanged := stalled != m.stalled
+	m.stalled = stalled
+	return sinceChange, stalled, stallChanged
+}
@@ -0,0 +1,114 @@
+package btcclient
+
+import (
+	"context"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/go-zeromq/zmq4"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	hashBlockTopic = "hashblock"
+	// zmqReconnectInterval is the delay between attempts to (re)connect to the publisher.
+	zmqReconnectInterval = 5 * time.Second
+)
+
+// BlockSubscriber subscribes to the zmqpubhashblock notifications of bitcoind
+// and signals every block connected to the chain. Signals are coalesced, a
+// consumer busy while several blocks arrive is signalled once afterwards.
+type BlockSubscriber struct {
+	endpoint          string
+	reconnectInterval time.Duration
+	notifications     chan struct{}
+	quit              chan struct{}
+	stopOnce          sync.Once
+}
+
+// NewBlockSubscriber creates a subscriber for the zmqpubhashblock endpoint,
+// e.g. tcp://localhost:28332.
+func NewBlockSubscriber(endpoint string) *BlockSubscriber {
+	return &BlockSubscriber{
+		endpoint:          endpoint,
+		reconnectInterval: zmqReconnectInterval,
+		notifications:     make(chan struct{}, 1),
+		quit:              make(chan struct{}),
+	}
+}
+
+// Notifications returns the channel signalled when a new block was connected.
+func (s *BlockSubscriber) Notifications() <-chan struct{} {
+	return s.notifications
+}
+
+// Start receives block notifications until the context is cancelled or the
+// subscriber is stopped, reconnecting whenever the publisher is unavailable.
+func (s *BlockSubscriber) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-s.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		if err := s.subscribe(ctx); err != nil && ctx.Err() == nil {
+			log.Warn().Err(err).Str("endpoint", s.endpoint).Msg("block notification subscription failed, reconnecting")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.reconnectInterval):
+		}
+	}
+}
+
+func (s *BlockSubscriber) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.quit)
+	})
+}
+
+// subscribe connects to the publisher and forwards its notifications until
+// receiving fails.
+func (s *BlockSubscriber) subscribe(ctx context.Context) error {
+	socket := zmq4.NewSub(
+		ctx,
+		zmq4.WithDialerRetry(s.reconnectInterval),
+		zmq4.WithDialerMaxRetries(-1),
+		zmq4.WithAutomaticReconnect(true),
+	)
+	defer socket.Close()
+
+	if err := socket.Dial(s.endpoint); err != nil {
+		return err
+	}
+	if err := socket.SetOption(zmq4.OptionSubscribe, hashBlockTopic); err != nil {
+		return err
+	}
+	log.Info().Str("endpoint", s.endpoint).Msg("subscribed to block notifications")
+
+	for {
+		msg, err := socket.Recv()
+		if err != nil {
+			return err
+		}
+		// bitcoind sends the topic, the block hash and a sequence number.
+		if len(msg.Frames) < 2 || string(msg.Frames[0]) != hashBlockTopic {
+			continue
+		}
+		log.Debug().Str("block_hash", hex.EncodeToString(msg.Frames[1])).Msg("received block notification")
+
+		select {
+		case s.notifications <- struct{}{}:
+		default:
+			// A signal is pending already.
+		}
+	}
+}
@@ -4,17 +4,22 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	queue "github.com/babylonchain/staking-queue-client/config"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Poller  PollerConfig      `mapstructure:"poller"`
-	Db      DbConfig          `mapstructure:"db"`
-	Btc     BtcConfig         `mapstructure:"btc"`
-	Queue   queue.QueueConfig `mapstructure:"queue"`
-	Metrics MetricsConfig     `mapstructure:"metrics"`
+	Poller           PollerConfig           `mapstructure:"poller"`
+	Db               DbConfig               `mapstructure:"db"`
+	Btc              BtcConfig              `mapstructure:"btc"`
+	Queue            queue.QueueConfig      `mapstructure:"queue"`
+	Publisher        PublisherConfig        `mapstructure:"publisher"`
+	Metrics          MetricsConfig          `mapstructure:"metrics"`
+	LeaderElection   LeaderElectionConfig   `mapstructure:"leader-election"`
+	ExpiryValidation ExpiryValidationConfig `mapstructure:"expiry-validation"`
+	Reorg            ReorgConfig            `mapstructure:"reorg"`
 }
 
 func (cfg *Config) Validate() error {
@@ -30,6 +35,36 @@ func (cfg *Config) Validate() error {
 		return err
 	}
 
+	// Only bitcoind and esplora report when an output was spent, a spend
+	// after the expiry must not skip it.
+	if cfg.Poller.VerifyUnspent {
+		switch cfg.Btc.GetBackend() {
+		case BackendBitcoind, BackendEsplora:
+		default:
+			return fmt.Errorf("verifying unspent outputs is not supported by the %s btc backend", cfg.Btc.GetBackend())
+		}
+	}
+
+	if err := cfg.ExpiryValidation.Validate(); err != nil {
+		return err
+	}
+
+	if cfg.ExpiryValidation.Enabled {
+		switch cfg.Btc.GetBackend() {
+		case BackendElectrum, BackendP2P, BackendBabylon:
+			return fmt.Errorf("validating expire heights is not supported by the %s btc backend", cfg.Btc.GetBackend())
+		}
+	}
+
+	if err := cfg.Reorg.Validate(); err != nil {
+		return err
+	}
+
+	// Detecting reorgs requires the block hashes of the best chain.
+	if cfg.Reorg.Enabled && cfg.Btc.GetBackend() == BackendElectrum {
+		return fmt.Errorf("detecting reorgs is not supported by the %s btc backend", BackendElectrum)
+	}
+
 	if err := cfg.Metrics.Validate(); err != nil {
 		return err
 	}
@@ -38,6 +73,14 @@ func (cfg *Config) Validate() error {
 		return err
 	}
 
+	if err := cfg.Publisher.Validate(); err != nil {
+		return err
+	}
+
+	if err := cfg.LeaderElection.Validate(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -61,6 +104,8 @@ func New(cfgFile string) (*Config, error) {
 	*/
 	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_", "-", "__"))
 
+	setDefaults()
+
 	err = viper.ReadInConfig()
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
@@ -76,3 +121,42 @@ func New(cfgFile string) (*Config, error) {
 
 	return &cfg, nil
 }
+
+// setDefaults fills in the keys added after the initial release, so that
+// config files written before them keep working.
+func setDefaults() {
+	viper.SetDefault("poller.lease-duration", time.Minute)
+	viper.SetDefault("poller.batch-size", 100)
+	viper.SetDefault("poller.workers", 8)
+	viper.SetDefault("poller.max-failures", 10)
+
+	viper.SetDefault("db.history-retention", 90*24*time.Hour)
+	viper.SetDefault("db.dedup-window", 30*24*time.Hour)
+
+	viper.SetDefault("btc.health-check-interval", 30*time.Second)
+	viper.SetDefault("btc.max-tip-lag", 3)
+	viper.SetDefault("btc.esplora.request-timeout", 10*time.Second)
+	viper.SetDefault("btc.esplora.max-retries", 3)
+	viper.SetDefault("btc.esplora.retry-backoff", 500*time.Millisecond)
+	viper.SetDefault("btc.electrum.request-timeout", 10*time.Second)
+	viper.SetDefault("btc.electrum.ping-interval", 30*time.Second)
+	viper.SetDefault("btc.electrum.reconnect-interval", 5*time.Second)
+	viper.SetDefault("btc.p2p.connect-timeout", 10*time.Second)
+	viper.SetDefault("btc.p2p.reconnect-interval", 5*time.Second)
+	viper.SetDefault("btc.babylon.request-timeout", 10*time.Second)
+	viper.SetDefault("btc.babylon.max-retries", 3)
+	viper.SetDefault("btc.babylon.retry-backoff", 500*time.Millisecond)
+
+	viper.SetDefault("publisher.max-retries", 3)
+	viper.SetDefault("publisher.initial-backoff", 200*time.Millisecond)
+	viper.SetDefault("publisher.max-backoff", 5*time.Second)
+	viper.SetDefault("publisher.confirm-timeout", 5*time.Second)
+	viper.SetDefault("publisher.breaker-failure-threshold", 5)
+	viper.SetDefault("publisher.breaker-cooldown", 30*time.Second)
+
+	viper.SetDefault("leader-election.lease-duration", 15*time.Second)
+	viper.SetDefault("leader-election.renew-interval", 5*time.Second)
+
+	viper.SetDefault("reorg.window", 144)
+	viper.SetDefault("reorg.compensation", ReorgCompensationAlert)
+}
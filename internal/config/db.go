@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/url"
 	"strconv"
+	"time"
 )
 
 type DbConfig struct {
@@ -11,6 +12,10 @@ type DbConfig struct {
 	Password string `mapstructure:"password"`
 	DbName   string `mapstructure:"db-name"`
 	Address  string `mapstructure:"address"`
+	// HistoryRetention is how long published expiry events are kept in the history.
+	HistoryRetention time.Duration `mapstructure:"history-retention"`
+	// DedupWindow is how long a published expiry event suppresses publishing it again.
+	DedupWindow time.Duration `mapstructure:"dedup-window"`
 }
 
 func (cfg *DbConfig) Validate() error {
@@ -30,6 +35,14 @@ func (cfg *DbConfig) Validate() error {
 		return fmt.Errorf("missing db name")
 	}
 
+	if cfg.HistoryRetention <= 0 {
+		return fmt.Errorf("history retention must be positive")
+	}
+
+	if cfg.DedupWindow <= 0 {
+		return fmt.Errorf("dedup window must be positive")
+	}
+
 	u, err := url.Parse(cfg.Address)
 	if err != nil {
 		return fmt.Errorf("invalid db address: %w", err)
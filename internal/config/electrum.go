@@ -0,0 +1,33 @@
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+// ElectrumConfig controls the connection of the electrum backend.
+type ElectrumConfig struct {
+	// RequestTimeout bounds connecting to the server and the requests of the handshake.
+	RequestTimeout time.Duration `mapstructure:"request-timeout"`
+	// PingInterval is how often the connection is checked, a server not
+	// answering for two intervals is considered gone.
+	PingInterval time.Duration `mapstructure:"ping-interval"`
+	// ReconnectInterval is the delay between attempts to reconnect to the server.
+	ReconnectInterval time.Duration `mapstructure:"reconnect-interval"`
+}
+
+func (cfg *ElectrumConfig) Validate() error {
+	if cfg.RequestTimeout <= 0 {
+		return errors.New("electrum request timeout must be positive")
+	}
+
+	if cfg.PingInterval <= 0 {
+		return errors.New("electrum ping interval must be positive")
+	}
+
+	if cfg.ReconnectInterval <= 0 {
+		return errors.New("electrum reconnect interval must be positive")
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// stakingTagLength is the length of the tag starting the OP_RETURN data of staking transactions.
+const stakingTagLength = 4
+
+// ExpiryValidationConfig controls checking the expire height of the timelock
+// documents against the chain before publishing their expiry.
+type ExpiryValidationConfig struct {
+	// Enabled computes the expiry from the staking or unbonding tx and
+	// quarantines documents whose expire height does not match.
+	Enabled bool `mapstructure:"enabled"`
+	// Tag is the hex encoded tag of the OP_RETURN output of staking transactions.
+	Tag string `mapstructure:"tag"`
+	// UnbondingTime is the timelock of unbonding outputs in blocks, unbonding
+	// delegations are not validated if it is zero.
+	UnbondingTime uint16 `mapstructure:"unbonding-time"`
+}
+
+func (cfg *ExpiryValidationConfig) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if cfg.Tag == "" {
+		return errors.New("staking tag is required to validate expire heights")
+	}
+	tag, err := hex.DecodeString(cfg.Tag)
+	if err != nil {
+		return fmt.Errorf("invalid staking tag: %w", err)
+	}
+	if len(tag) != stakingTagLength {
+		return errors.New("staking tag must be 4 bytes")
+	}
+
+	return nil
+}
+
+// GetTag returns the decoded staking tag.
+func (cfg *ExpiryValidationConfig) GetTag() []byte {
+	tag, _ := hex.DecodeString(cfg.Tag)
+	return tag
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+// HttpRetryConfig controls the requests of the backends querying an HTTP API,
+// i.e. esplora and babylon.
+type HttpRetryConfig struct {
+	// RequestTimeout bounds a single request to the API.
+	RequestTimeout time.Duration `mapstructure:"request-timeout"`
+	// MaxRetries is the number of times a failed request is retried before giving up.
+	MaxRetries int `mapstructure:"max-retries"`
+	// RetryBackoff is the delay before the first retry, it doubles with every retry.
+	RetryBackoff time.Duration `mapstructure:"retry-backoff"`
+}
+
+func (cfg *HttpRetryConfig) Validate() error {
+	if cfg.RequestTimeout <= 0 {
+		return errors.New("request timeout must be positive")
+	}
+
+	if cfg.MaxRetries < 0 {
+		return errors.New("max retries cannot be negative")
+	}
+
+	if cfg.RetryBackoff <= 0 {
+		return errors.New("retry backoff must be positive")
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+// LeaderElectionConfig enables running several replicas where only the
+// current leader processes expired delegations.
+type LeaderElectionConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// LeaseDuration is how long the leadership is held without being renewed.
+	LeaseDuration time.Duration `mapstructure:"lease-duration"`
+	// RenewInterval is how often the leader renews, and standbys try to take over, the lease.
+	RenewInterval time.Duration `mapstructure:"renew-interval"`
+}
+
+func (cfg *LeaderElectionConfig) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if cfg.LeaseDuration <= 0 {
+		return errors.New("leader election lease duration must be positive")
+	}
+
+	if cfg.RenewInterval <= 0 {
+		return errors.New("leader election renew interval must be positive")
+	}
+
+	if cfg.RenewInterval >= cfg.LeaseDuration {
+		return errors.New("leader election renew interval must be shorter than the lease duration")
+	}
+
+	return nil
+}
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+// P2PConfig controls the peer connections of the p2p backend.
+type P2PConfig struct {
+	// ConnectTimeout bounds connecting to a peer and the version handshake.
+	ConnectTimeout time.Duration `mapstructure:"connect-timeout"`
+	// ReconnectInterval is the delay between attempts to reconnect to a peer.
+	ReconnectInterval time.Duration `mapstructure:"reconnect-interval"`
+}
+
+func (cfg *P2PConfig) Validate() error {
+	if cfg.ConnectTimeout <= 0 {
+		return errors.New("p2p connect timeout must be positive")
+	}
+
+	if cfg.ReconnectInterval <= 0 {
+		return errors.New("p2p reconnect interval must be positive")
+	}
+
+	return nil
+}
@@ -11,6 +11,24 @@ import (
 type PollerConfig struct {
 	Interval time.Duration `mapstructure:"interval"`
 	LogLevel string        `mapstructure:"log-level"`
+	// LeaseDuration is how long a claimed timelock document stays reserved for
+	// this instance. Leases of crashed instances become claimable after it passes.
+	LeaseDuration time.Duration `mapstructure:"lease-duration"`
+	// BatchSize is the maximum number of expired delegations claimed at once.
+	BatchSize int `mapstructure:"batch-size"`
+	// Workers is the number of expired delegations published concurrently.
+	Workers int `mapstructure:"workers"`
+	// MaxFailures is the number of failed attempts after which a timelock
+	// document is moved to the dead letter collection.
+	MaxFailures int `mapstructure:"max-failures"`
+	/*
+		VerifyUnspent checks that the timelocked output of an expired delegation
+		was not spent before the expire height, e.g. by slashing, in which case the
+		delegation is archived without publishing its expiry. Requires the esplora
+		btc backend, or the bitcoind backend with a txindex, which searches the
+		blocks following the confirmation of the transaction for a spent output.
+	*/
+	VerifyUnspent bool `mapstructure:"verify-unspent"`
 }
 
 func (cfg *PollerConfig) Validate() error {
@@ -18,6 +36,22 @@ func (cfg *PollerConfig) Validate() error {
 		return errors.New("poll interval cannot be negative")
 	}
 
+	if cfg.LeaseDuration <= 0 {
+		return errors.New("lease duration must be positive")
+	}
+
+	if cfg.BatchSize <= 0 {
+		return errors.New("batch size must be positive")
+	}
+
+	if cfg.Workers <= 0 {
+		return errors.New("number of workers must be positive")
+	}
+
+	if cfg.MaxFailures <= 0 {
+		return errors.New("max failures must be positive")
+	}
+
 	if err := cfg.ValidateServiceLogLevel(); err != nil {
 		return err
 	}
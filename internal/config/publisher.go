@@ -0,0 +1,53 @@
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+// PublisherConfig controls how expired staking events are published to the queue.
+type PublisherConfig struct {
+	// MaxRetries is the number of times a failed send is retried before giving up.
+	MaxRetries int `mapstructure:"max-retries"`
+	// InitialBackoff is the delay before the first retry, it doubles with every retry.
+	InitialBackoff time.Duration `mapstructure:"initial-backoff"`
+	// MaxBackoff caps the delay between two retries.
+	MaxBackoff time.Duration `mapstructure:"max-backoff"`
+	// ConfirmTimeout is how long to wait for the broker to confirm a message
+	// before the send counts as failed.
+	ConfirmTimeout time.Duration `mapstructure:"confirm-timeout"`
+	// BreakerFailureThreshold is the number of consecutive failed sends after
+	// which publishing is paused.
+	BreakerFailureThreshold int `mapstructure:"breaker-failure-threshold"`
+	// BreakerCooldown is how long publishing stays paused before a single
+	// trial send checks whether the queue recovered.
+	BreakerCooldown time.Duration `mapstructure:"breaker-cooldown"`
+}
+
+func (cfg *PublisherConfig) Validate() error {
+	if cfg.MaxRetries < 0 {
+		return errors.New("publisher max retries cannot be negative")
+	}
+
+	if cfg.InitialBackoff <= 0 {
+		return errors.New("publisher initial backoff must be positive")
+	}
+
+	if cfg.MaxBackoff < cfg.InitialBackoff {
+		return errors.New("publisher max backoff must not be shorter than the initial backoff")
+	}
+
+	if cfg.ConfirmTimeout <= 0 {
+		return errors.New("publisher confirm timeout must be positive")
+	}
+
+	if cfg.BreakerFailureThreshold <= 0 {
+		return errors.New("publisher breaker failure threshold must be positive")
+	}
+
+	if cfg.BreakerCooldown <= 0 {
+		return errors.New("publisher breaker cooldown must be positive")
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// ReorgCompensationEvent publishes an expiry reverted event for every
+	// expiry whose height left the best chain.
+	ReorgCompensationEvent = "event"
+	// ReorgCompensationAlert only logs an error and records a metric, for
+	// setups in which an operator repairs the downstream state.
+	ReorgCompensationAlert = "alert"
+)
+
+// ReorgConfig controls detecting reorgs of heights at which expiries were
+// published already, and reverting those expiries.
+type ReorgConfig struct {
+	// Enabled keeps the hashes of recent blocks and reverts the expiries of
+	// heights no longer in the best chain.
+	Enabled bool `mapstructure:"enabled"`
+	// Window is the number of most recent confirmed blocks whose hashes are
+	// kept, reorgs deeper than that are only detected down to the oldest one.
+	Window uint64 `mapstructure:"window"`
+	// Compensation is how a reverted expiry is reported, event or alert.
+	Compensation string `mapstructure:"compensation"`
+	// EventQueueName is the queue the expiry reverted events are published to.
+	EventQueueName string `mapstructure:"event-queue-name"`
+}
+
+func (cfg *ReorgConfig) Validate() error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if cfg.Window == 0 {
+		return errors.New("reorg window must be positive")
+	}
+
+	switch cfg.Compensation {
+	case ReorgCompensationEvent:
+		if cfg.EventQueueName == "" {
+			return errors.New("reorg event queue name must be set to publish expiry reverted events")
+		}
+	case ReorgCompensationAlert:
+	default:
+		return fmt.Errorf("invalid reorg compensation %q, must be %s or %s",
+			cfg.Compensation, ReorgCompensationEvent, ReorgCompensationAlert)
+	}
+
+	return nil
+}
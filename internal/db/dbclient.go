@@ -2,7 +2,9 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -13,9 +15,13 @@ import (
 	"github.com/babylonchain/staking-expiry-checker/internal/db/model"
 )
 
+// indexOptionsConflictCode is returned by mongo when an index exists with different options.
+const indexOptionsConflictCode = 85
+
 type Database struct {
-	dbName string
-	client *mongo.Client
+	dbName      string
+	client      *mongo.Client
+	dedupWindow time.Duration
 }
 
 func New(ctx context.Context, cfg config.DbConfig) (*Database, error) {
@@ -29,10 +35,64 @@ func New(ctx context.Context, cfg config.DbConfig) (*Database, error) {
 		return nil, err
 	}
 
-	return &Database{
-		dbName: cfg.DbName,
-		client: client,
-	}, nil
+	db := &Database{
+		dbName:      cfg.DbName,
+		client:      client,
+		dedupWindow: cfg.DedupWindow,
+	}
+	if err := db.ensureHistoryIndexes(ctx, cfg.HistoryRetention); err != nil {
+		return nil, err
+	}
+	if err := db.ensureTTLIndex(ctx, model.PublishedEventCollection, "published_at", cfg.DedupWindow); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// ensureHistoryIndexes creates the indexes of the expired history, including
+// the TTL index that removes entries once they are older than the retention.
+func (db *Database) ensureHistoryIndexes(ctx context.Context, retention time.Duration) error {
+	if err := db.ensureTTLIndex(ctx, model.ExpiredHistoryCollection, "archived_at", retention); err != nil {
+		return err
+	}
+
+	client := db.client.Database(db.dbName).Collection(model.ExpiredHistoryCollection)
+	_, err := client.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "staking_tx_hash_hex", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create expired history index: %w", err)
+	}
+
+	return nil
+}
+
+// ensureTTLIndex creates a TTL index on the date field of the collection.
+// A changed TTL is applied to the existing index.
+func (db *Database) ensureTTLIndex(ctx context.Context, collection, field string, ttl time.Duration) error {
+	client := db.client.Database(db.dbName).Collection(collection)
+	expireAfterSeconds := int32(ttl.Seconds())
+
+	_, err := client.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: field, Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(expireAfterSeconds),
+	})
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == indexOptionsConflictCode {
+		err = db.client.Database(db.dbName).RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: collection},
+			{Key: "index", Value: bson.D{
+				{Key: "keyPattern", Value: bson.D{{Key: field, Value: 1}}},
+				{Key: "expireAfterSeconds", Value: expireAfterSeconds},
+			}},
+		}).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create TTL index on %s.%s: %w", collection, field, err)
+	}
+
+	return nil
 }
 
 func (db *Database) Ping(ctx context.Context) error {
@@ -43,37 +103,1158 @@ func (db *Database) Ping(ctx context.Context) error {
 	return nil
 }
 
-func (db *Database) FindExpiredDelegations(ctx context.Context, btcTipHeight uint64) ([]model.TimeLockDocument, error) {
+// ClaimExpiredDelegations atomically claims up to limit expired documents
+// for the given owner by moving them into publishing with a lease.
+// Documents are claimable when they are not published yet and either not
+// leased or their lease expired, which lets other instances take over the
+// work of a crashed one. The documents are returned as they were before being
+// claimed, so callers can tell whether a publish of another owner was interrupted.
+// A document that can not be decoded is returned with only its ID and DecodeErr set.
+func (db *Database) ClaimExpiredDelegations(
+	ctx context.Context, btcTipHeight uint64, owner string, leaseDuration time.Duration, limit int,
+) ([]model.TimeLockDocument, error) {
 	client := db.client.Database(db.dbName).Collection(model.TimeLockCollection)
-	filter := bson.M{"expire_height": bson.M{"$lte": btcTipHeight}}
 
-	opts := options.Find().SetLimit(100)
-	cursor, err := client.Find(ctx, filter, opts)
+	var delegations []model.TimeLockDocument
+	for len(delegations) < limit {
+		now := time.Now()
+		filter := bson.M{
+			"expire_height": bson.M{"$lte": btcTipHeight},
+			"status":        bson.M{"$ne": model.TimeLockStatusPublished},
+			// Also matches documents without any lease.
+			"lease_expires_at": bson.M{"$not": bson.M{"$gte": now.Unix()}},
+		}
+		update := bson.M{
+			"$set": bson.M{
+				"status":           model.TimeLockStatusPublishing,
+				"lease_owner":      owner,
+				"lease_expires_at": now.Add(leaseDuration).Unix(),
+			},
+		}
+		opts := options.FindOneAndUpdate().
+			SetSort(bson.M{"expire_height": 1}).
+			SetReturnDocument(options.Before)
+
+		raw, err := client.FindOneAndUpdate(ctx, filter, update, opts).Raw()
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				break
+			}
+			return nil, fmt.Errorf("failed to claim expired delegation: %w", err)
+		}
+
+		var delegation model.TimeLockDocument
+		if err := bson.Unmarshal(raw, &delegation); err != nil {
+			id, ok := raw.Lookup("_id").ObjectIDOK()
+			if !ok {
+				return nil, fmt.Errorf("failed to decode claimed delegation without a valid ID: %w", err)
+			}
+			delegation = model.TimeLockDocument{ID: id, DecodeErr: err}
+		}
+		delegations = append(delegations, delegation)
+	}
+
+	return delegations, nil
+}
+
+// RecordDelegationFailure records a failed attempt to process a document
+// claimed by the owner. The document keeps its lease, so it is only retried
+// once the lease expired. If the event is known to not have been published,
+// the document moves back to pending so that the retry is not reported as a
+// duplicate. Once the document failed maxFailures times it is moved to the
+// dead letter collection, fenced by the fence unless it is nil, in which case
+// true is returned. A NotFoundError is returned if the lease was lost to
+// another owner, and ErrFenced if the leadership was lost.
+func (db *Database) RecordDelegationFailure(
+	ctx context.Context, id primitive.ObjectID, owner string, failure error, notPublished bool, maxFailures int,
+	fence *model.LeaderFence,
+) (bool, error) {
+	client := db.client.Database(db.dbName).Collection(model.TimeLockCollection)
+	now := time.Now().Unix()
+	filter := bson.M{
+		"_id":         id,
+		"status":      model.TimeLockStatusPublishing,
+		"lease_owner": owner,
+	}
+	set := bson.M{
+		"last_error":     failure.Error(),
+		"last_failed_at": now,
+	}
+	if notPublished {
+		set["status"] = model.TimeLockStatusPending
+	}
+	update := bson.M{
+		"$set": set,
+		"$inc": bson.M{"failure_count": 1},
+		"$min": bson.M{"first_failed_at": now},
+	}
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(bson.M{"failure_count": 1})
+
+	var result struct {
+		FailureCount int64 `bson:"failure_count"`
+	}
+	err := client.FindOneAndUpdate(ctx, filter, update, opts).Decode(&result)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, &NotFoundError{
+				Key:     id.Hex(),
+				Message: "no delegation claimed by the owner found with the given ID",
+			}
+		}
+		return false, fmt.Errorf("failed to record failure of delegation with ID %v: %w", id, err)
+	}
+
+	if result.FailureCount < int64(maxFailures) {
+		return false, nil
+	}
+	if err := db.moveToDeadLetter(ctx, id, owner, fence); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// RecordMaybePublished records a send of a document claimed by the owner that
+// the broker did not confirm, so that the event may have been published. It
+// does not count as a failure towards the dead letter collection, as the
+// document is not at fault. The document keeps its lease and is only retried
+// once the lease expired. A NotFoundError is returned if the lease was lost
+// to another owner.
+func (db *Database) RecordMaybePublished(
+	ctx context.Context, id primitive.ObjectID, owner string, failure error,
+) error {
+	client := db.client.Database(db.dbName).Collection(model.TimeLockCollection)
+	filter := bson.M{
+		"_id":         id,
+		"status":      model.TimeLockStatusPublishing,
+		"lease_owner": owner,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"maybe_published": true,
+			"last_error":      failure.Error(),
+			"last_failed_at":  time.Now().Unix(),
+		},
+	}
+
+	result, err := client.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to record maybe published delegation with ID %v: %w", id, err)
+	}
+	if result.MatchedCount == 0 {
+		return &NotFoundError{
+			Key:     id.Hex(),
+			Message: "no delegation claimed by the owner found with the given ID",
+		}
+	}
+
+	return nil
+}
+
+// ReleaseDelegation gives up the lease of the owner on a document whose
+// processing was not attempted, e.g. because the queue is unavailable. The
+// document returns to the status it had before being claimed, so that it can
+// be claimed again right away without being reported as a duplicate.
+func (db *Database) ReleaseDelegation(
+	ctx context.Context, id primitive.ObjectID, owner string, status model.TimeLockStatus,
+) error {
+	client := db.client.Database(db.dbName).Collection(model.TimeLockCollection)
+	if status == "" {
+		status = model.TimeLockStatusPending
+	}
+	filter := bson.M{
+		"_id":         id,
+		"status":      model.TimeLockStatusPublishing,
+		"lease_owner": owner,
+	}
+	update := bson.M{
+		"$set":   bson.M{"status": status},
+		"$unset": bson.M{"lease_owner": "", "lease_expires_at": ""},
+	}
+
+	result, err := client.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to release delegation with ID %v: %w", id, err)
+	}
+	if result.MatchedCount == 0 {
+		return &NotFoundError{
+			Key:     id.Hex(),
+			Message: "no delegation claimed by the owner found with the given ID",
+		}
+	}
+
+	return nil
+}
+
+// moveToDeadLetter moves a document claimed by the owner from the queue into
+// the dead letter collection, keeping the original document and its failure
+// details, in a transaction fenced by the fence unless it is nil. A
+// NotFoundError is returned if the lease was lost meanwhile, e.g. to an
+// instance that reclaimed the document and may have published it, and
+// ErrFenced if the leadership was lost.
+func (db *Database) moveToDeadLetter(
+	ctx context.Context, id primitive.ObjectID, owner string, fence *model.LeaderFence,
+) error {
+	queueClient := db.client.Database(db.dbName).Collection(model.TimeLockCollection)
+	deadLetterClient := db.client.Database(db.dbName).Collection(model.TimeLockDeadLetterCollection)
+
+	session, err := db.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	transactionWork := func(sessCtx mongo.SessionContext) (interface{}, error) {
+		if err := db.checkFence(sessCtx, fence); err != nil {
+			return nil, err
+		}
+		filter := bson.M{
+			"_id":         id,
+			"status":      bson.M{"$ne": model.TimeLockStatusPublished},
+			"lease_owner": owner,
+		}
+		raw, err := queueClient.FindOne(sessCtx, filter).Raw()
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, &NotFoundError{
+					Key:     id.Hex(),
+					Message: "no delegation claimed by the owner found with the given ID",
+				}
+			}
+			return nil, err
+		}
+		// Only the failure details are decoded, the document itself may be malformed.
+		var failure struct {
+			LastError     string `bson:"last_error"`
+			FailureCount  int64  `bson:"failure_count"`
+			FirstFailedAt int64  `bson:"first_failed_at"`
+			LastFailedAt  int64  `bson:"last_failed_at"`
+		}
+		if err := bson.Unmarshal(raw, &failure); err != nil {
+			return nil, err
+		}
+
+		deadLetter := model.TimeLockDeadLetterDocument{
+			ID:             id,
+			Document:       raw,
+			LastError:      failure.LastError,
+			FailureCount:   failure.FailureCount,
+			FirstFailedAt:  failure.FirstFailedAt,
+			LastFailedAt:   failure.LastFailedAt,
+			DeadLetteredAt: time.Now().Unix(),
+		}
+		if _, err := deadLetterClient.InsertOne(sessCtx, deadLetter); err != nil {
+			return nil, err
+		}
+		result, err := queueClient.DeleteOne(sessCtx, filter)
+		if err != nil {
+			return nil, err
+		}
+		if result.DeletedCount == 0 {
+			// Aborts the transaction, the dead letter is not kept.
+			return nil, &NotFoundError{
+				Key:     id.Hex(),
+				Message: "no delegation claimed by the owner found with the given ID",
+			}
+		}
+		return nil, nil
+	}
+
+	if _, err := session.WithTransaction(ctx, transactionWork); err != nil {
+		if IsNotFoundError(err) || errors.Is(err, ErrFenced) {
+			return err
+		}
+		return fmt.Errorf("failed to move delegation with ID %v to the dead letter collection: %w", id, err)
+	}
+
+	return nil
+}
+
+// QuarantineDelegation moves a document claimed by the owner into the
+// quarantine collection instead of publishing its expiry, keeping the
+// original document and the reason, in a transaction fenced by the fence
+// unless it is nil. A NotFoundError is returned if the document is no longer
+// claimed by the owner, and ErrFenced if the leadership was lost.
+func (db *Database) QuarantineDelegation(
+	ctx context.Context, id primitive.ObjectID, owner string, reason string, computedExpireHeight uint64,
+	fence *model.LeaderFence,
+) error {
+	queueClient := db.client.Database(db.dbName).Collection(model.TimeLockCollection)
+	quarantineClient := db.client.Database(db.dbName).Collection(model.TimeLockQuarantineCollection)
+
+	session, err := db.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	transactionWork := func(sessCtx mongo.SessionContext) (interface{}, error) {
+		if err := db.checkFence(sessCtx, fence); err != nil {
+			return nil, err
+		}
+		filter := bson.M{
+			"_id":         id,
+			"status":      model.TimeLockStatusPublishing,
+			"lease_owner": owner,
+		}
+		raw, err := queueClient.FindOneAndDelete(sessCtx, filter).Raw()
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, &NotFoundError{
+					Key:     id.Hex(),
+					Message: "no delegation claimed by the owner found with the given ID",
+				}
+			}
+			return nil, err
+		}
+
+		quarantined := model.TimeLockQuarantineDocument{
+			ID:                   id,
+			Document:             raw,
+			Reason:               reason,
+			ComputedExpireHeight: computedExpireHeight,
+			InstanceID:           owner,
+			QuarantinedAt:        time.Now().Unix(),
+		}
+		if _, err := quarantineClient.InsertOne(sessCtx, quarantined); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	if _, err := session.WithTransaction(ctx, transactionWork); err != nil {
+		if IsNotFoundError(err) || errors.Is(err, ErrFenced) {
+			return err
+		}
+		return fmt.Errorf("failed to quarantine delegation with ID %v: %w", id, err)
+	}
+
+	return nil
+}
+
+// ListDeadLetters returns up to limit dead letters, most recent first.
+func (db *Database) ListDeadLetters(ctx context.Context, limit int64) ([]model.TimeLockDeadLetterDocument, error) {
+	client := db.client.Database(db.dbName).Collection(model.TimeLockDeadLetterCollection)
+	opts := options.Find().
+		SetSort(bson.M{"dead_lettered_at": -1}).
+		SetLimit(limit)
+
+	cursor, err := client.Find(ctx, bson.M{}, opts)
 	if err != nil {
 		return nil, err
 	}
 	defer cursor.Close(ctx)
 
-	var delegations []model.TimeLockDocument
-	if err = cursor.All(ctx, &delegations); err != nil {
+	var deadLetters []model.TimeLockDeadLetterDocument
+	if err = cursor.All(ctx, &deadLetters); err != nil {
 		return nil, err
 	}
 
-	return delegations, nil
+	return deadLetters, nil
+}
+
+// RequeueDeadLetter moves a dead letter back into the queue as a pending
+// document with its failure history cleared.
+func (db *Database) RequeueDeadLetter(ctx context.Context, id primitive.ObjectID) error {
+	queueClient := db.client.Database(db.dbName).Collection(model.TimeLockCollection)
+	deadLetterClient := db.client.Database(db.dbName).Collection(model.TimeLockDeadLetterCollection)
+
+	session, err := db.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	transactionWork := func(sessCtx mongo.SessionContext) (interface{}, error) {
+		var deadLetter model.TimeLockDeadLetterDocument
+		if err := deadLetterClient.FindOne(sessCtx, bson.M{"_id": id}).Decode(&deadLetter); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, &NotFoundError{
+					Key:     id.Hex(),
+					Message: "no dead letter found with the given ID",
+				}
+			}
+			return nil, err
+		}
+
+		var document bson.D
+		if err := bson.Unmarshal(deadLetter.Document, &document); err != nil {
+			return nil, err
+		}
+		requeued := bson.D{}
+		for _, field := range document {
+			if !isProcessingField(field.Key) {
+				requeued = append(requeued, field)
+			}
+		}
+
+		if _, err := queueClient.InsertOne(sessCtx, requeued); err != nil {
+			return nil, err
+		}
+		if _, err := deadLetterClient.DeleteOne(sessCtx, bson.M{"_id": id}); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	if _, err := session.WithTransaction(ctx, transactionWork); err != nil {
+		if IsNotFoundError(err) {
+			return err
+		}
+		return fmt.Errorf("failed to requeue dead letter with ID %v: %w", id, err)
+	}
+
+	return nil
+}
+
+// isProcessingField reports whether a timelock document field is written by
+// the checker itself rather than by the upstream indexer.
+func isProcessingField(key string) bool {
+	switch key {
+	case "status", "lease_owner", "lease_expires_at", "published_at", "published_tip_height",
+		"failure_count", "last_error", "first_failed_at", "last_failed_at", "maybe_published":
+		return true
+	}
+	return false
 }
 
-func (db *Database) DeleteExpiredDelegation(ctx context.Context, id primitive.ObjectID) error {
+// MarkDelegationPublished moves a document claimed by the owner from
+// publishing to published once its event has been handed over to the queue,
+// recording the btc tip height at that time. The event is recorded in the
+// published event ledger in the same transaction, which is fenced by the
+// fence unless it is nil. If the event was sent rather than suppressed as a
+// duplicate, the publish time of its ledger entry is refreshed.
+// A NotFoundError is returned if the lease was lost to another owner, and
+// ErrFenced if the leadership was lost.
+func (db *Database) MarkDelegationPublished(
+	ctx context.Context, id primitive.ObjectID, owner string, tipHeight uint64, sent bool,
+	fence *model.LeaderFence,
+) error {
+	queueClient := db.client.Database(db.dbName).Collection(model.TimeLockCollection)
+	ledgerClient := db.client.Database(db.dbName).Collection(model.PublishedEventCollection)
+
+	session, err := db.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	transactionWork := func(sessCtx mongo.SessionContext) (interface{}, error) {
+		if err := db.checkFence(sessCtx, fence); err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		filter := bson.M{
+			"_id":         id,
+			"status":      model.TimeLockStatusPublishing,
+			"lease_owner": owner,
+		}
+		update := bson.M{
+			"$set": bson.M{
+				"status":               model.TimeLockStatusPublished,
+				"published_at":         now.Unix(),
+				"published_tip_height": tipHeight,
+			},
+			"$unset": bson.M{"lease_expires_at": ""},
+		}
+
+		var delegation model.TimeLockDocument
+		err := queueClient.FindOneAndUpdate(sessCtx, filter, update).Decode(&delegation)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, &NotFoundError{
+					Key:     id.Hex(),
+					Message: "no delegation claimed by the owner found with the given ID",
+				}
+			}
+			return nil, err
+		}
+
+		// An entry left by an earlier publish keeps its time when the
+		// duplicate was suppressed, so that suppressed duplicates do not
+		// extend the dedup window. An event sent again restarts it.
+		key := model.PublishedEventKey(delegation.StakingTxHashHex, delegation.TxType)
+		inserted := bson.M{
+			"staking_tx_hash_hex": delegation.StakingTxHashHex,
+			"tx_type":             delegation.TxType,
+		}
+		ledgerUpdate := bson.M{"$setOnInsert": inserted}
+		if sent {
+			ledgerUpdate["$set"] = bson.M{"published_at": now, "instance_id": owner}
+		} else {
+			inserted["published_at"] = now
+			inserted["instance_id"] = owner
+		}
+		opts := options.Update().SetUpsert(true)
+		if _, err := ledgerClient.UpdateOne(sessCtx, bson.M{"_id": key}, ledgerUpdate, opts); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	if _, err := session.WithTransaction(ctx, transactionWork); err != nil {
+		if IsNotFoundError(err) || errors.Is(err, ErrFenced) {
+			return err
+		}
+		return fmt.Errorf("failed to mark delegation with ID %v as published: %w", id, err)
+	}
+
+	return nil
+}
+
+// IsEventPublished reports whether the expired event of the staking tx was
+// published within the dedup window, according to the published event ledger.
+func (db *Database) IsEventPublished(ctx context.Context, stakingTxHashHex, txType string) (bool, error) {
+	client := db.client.Database(db.dbName).Collection(model.PublishedEventCollection)
+	// The TTL monitor removes expired entries only periodically.
+	filter := bson.M{
+		"_id":          model.PublishedEventKey(stakingTxHashHex, txType),
+		"published_at": bson.M{"$gte": time.Now().Add(-db.dedupWindow)},
+	}
+
+	count, err := client.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("failed to look up published event of %s: %w", stakingTxHashHex, err)
+	}
+
+	return count > 0, nil
+}
+
+// ArchiveExpiredDelegation moves a published document from the queue into
+// the expired history, in a transaction fenced by the fence unless it is nil.
+// A NotFoundError is returned if the document is not in the queue or not
+// published, and ErrFenced if the leadership was lost.
+func (db *Database) ArchiveExpiredDelegation(
+	ctx context.Context, id primitive.ObjectID, fence *model.LeaderFence,
+) error {
+	queueClient := db.client.Database(db.dbName).Collection(model.TimeLockCollection)
+	historyClient := db.client.Database(db.dbName).Collection(model.ExpiredHistoryCollection)
+
+	session, err := db.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	transactionWork := func(sessCtx mongo.SessionContext) (interface{}, error) {
+		if err := db.checkFence(sessCtx, fence); err != nil {
+			return nil, err
+		}
+		filter := bson.M{
+			"_id":    id,
+			"status": model.TimeLockStatusPublished,
+		}
+		var delegation model.TimeLockDocument
+		if err := queueClient.FindOne(sessCtx, filter).Decode(&delegation); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, &NotFoundError{
+					Key:     id.Hex(),
+					Message: "no published delegation found with the given ID",
+				}
+			}
+			return nil, err
+		}
+
+		history := model.ExpiredHistoryDocument{
+			ID:                 primitive.NewObjectID(),
+			TimeLockID:         delegation.ID,
+			StakingTxHashHex:   delegation.StakingTxHashHex,
+			TxType:             delegation.TxType,
+			ExpireHeight:       delegation.ExpireHeight,
+			Outcome:            model.ExpiredHistoryOutcomePublished,
+			PublishedAt:        delegation.PublishedAt,
+			TipHeight:          delegation.PublishedTipHeight,
+			InstanceID:         delegation.LeaseOwner,
+			StakingOutputIndex: delegation.StakingOutputIndex,
+			UnbondingTxHashHex: delegation.UnbondingTxHashHex,
+			ArchivedAt:         time.Now(),
+		}
+		if _, err := historyClient.InsertOne(sessCtx, history); err != nil {
+			return nil, err
+		}
+		if _, err := queueClient.DeleteOne(sessCtx, filter); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	if _, err := session.WithTransaction(ctx, transactionWork); err != nil {
+		if IsNotFoundError(err) || errors.Is(err, ErrFenced) {
+			return err
+		}
+		return fmt.Errorf("failed to archive expired delegation with ID %v: %w", id, err)
+	}
+
+	return nil
+}
+
+// ArchiveSpentDelegation moves a document claimed by the owner into the
+// expired history with the spent outcome, instead of publishing its expiry,
+// in a transaction fenced by the fence unless it is nil. A NotFoundError is
+// returned if the document is no longer claimed by the owner, and ErrFenced
+// if the leadership was lost.
+func (db *Database) ArchiveSpentDelegation(
+	ctx context.Context, id primitive.ObjectID, owner string, tipHeight uint64, fence *model.LeaderFence,
+) error {
+	queueClient := db.client.Database(db.dbName).Collection(model.TimeLockCollection)
+	historyClient := db.client.Database(db.dbName).Collection(model.ExpiredHistoryCollection)
+
+	session, err := db.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	transactionWork := func(sessCtx mongo.SessionContext) (interface{}, error) {
+		if err := db.checkFence(sessCtx, fence); err != nil {
+			return nil, err
+		}
+		filter := bson.M{
+			"_id":         id,
+			"status":      model.TimeLockStatusPublishing,
+			"lease_owner": owner,
+		}
+		var delegation model.TimeLockDocument
+		if err := queueClient.FindOneAndDelete(sessCtx, filter).Decode(&delegation); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, &NotFoundError{
+					Key:     id.Hex(),
+					Message: "no delegation claimed by the owner found with the given ID",
+				}
+			}
+			return nil, err
+		}
+
+		history := model.ExpiredHistoryDocument{
+			ID:                 primitive.NewObjectID(),
+			TimeLockID:         delegation.ID,
+			StakingTxHashHex:   delegation.StakingTxHashHex,
+			TxType:             delegation.TxType,
+			ExpireHeight:       delegation.ExpireHeight,
+			Outcome:            model.ExpiredHistoryOutcomeSpent,
+			TipHeight:          tipHeight,
+			InstanceID:         owner,
+			StakingOutputIndex: delegation.StakingOutputIndex,
+			UnbondingTxHashHex: delegation.UnbondingTxHashHex,
+			ArchivedAt:         time.Now(),
+		}
+		if _, err := historyClient.InsertOne(sessCtx, history); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	if _, err := session.WithTransaction(ctx, transactionWork); err != nil {
+		if IsNotFoundError(err) || errors.Is(err, ErrFenced) {
+			return err
+		}
+		return fmt.Errorf("failed to archive spent delegation with ID %v: %w", id, err)
+	}
+
+	return nil
+}
+
+// ArchivePublishedDelegations archives all documents that were published but
+// not archived yet, e.g. because archiving failed in an earlier run. Every
+// archive is fenced by the fence unless it is nil.
+func (db *Database) ArchivePublishedDelegations(ctx context.Context, fence *model.LeaderFence) (int64, error) {
 	client := db.client.Database(db.dbName).Collection(model.TimeLockCollection)
-	filter := bson.M{"_id": id}
+	filter := bson.M{"status": model.TimeLockStatusPublished}
+	opts := options.Find().SetProjection(bson.M{"_id": 1})
+
+	cursor, err := client.Find(ctx, filter, opts)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find published delegations: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var published []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &published); err != nil {
+		return 0, fmt.Errorf("failed to find published delegations: %w", err)
+	}
+
+	var archived int64
+	for _, delegation := range published {
+		err := db.ArchiveExpiredDelegation(ctx, delegation.ID, fence)
+		if err != nil {
+			if IsNotFoundError(err) {
+				// Archived concurrently by another instance.
+				continue
+			}
+			return archived, err
+		}
+		archived++
+	}
+
+	return archived, nil
+}
+
+// NextExpireHeight returns the lowest expire height above afterHeight of the
+// documents in the queue. It returns a NotFoundError if there is none.
+func (db *Database) NextExpireHeight(ctx context.Context, afterHeight uint64) (uint64, error) {
+	client := db.client.Database(db.dbName).Collection(model.TimeLockCollection)
+	filter := bson.M{"expire_height": bson.M{"$gt": afterHeight}}
+	opts := options.FindOne().
+		SetSort(bson.M{"expire_height": 1}).
+		SetProjection(bson.M{"expire_height": 1})
+
+	var next struct {
+		ExpireHeight uint64 `bson:"expire_height"`
+	}
+	if err := client.FindOne(ctx, filter, opts).Decode(&next); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return 0, &NotFoundError{
+				Key:     fmt.Sprintf("%d", afterHeight),
+				Message: "no delegation expires after the given height",
+			}
+		}
+		return 0, fmt.Errorf("failed to find next expire height: %w", err)
+	}
+
+	return next.ExpireHeight, nil
+}
+
+// CountExpiredDelegations counts the documents expiring at or below the
+// height that are still in the queue, in whatever state.
+func (db *Database) CountExpiredDelegations(ctx context.Context, height uint64) (int64, error) {
+	client := db.client.Database(db.dbName).Collection(model.TimeLockCollection)
+	filter := bson.M{"expire_height": bson.M{"$lte": height}}
+
+	count, err := client.CountDocuments(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count expired delegations: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetProcessingCheckpoint returns the processing checkpoint, or a
+// NotFoundError if nothing was processed yet.
+func (db *Database) GetProcessingCheckpoint(ctx context.Context) (*model.ProcessingCheckpointDocument, error) {
+	client := db.client.Database(db.dbName).Collection(model.ProcessingCheckpointCollection)
+	filter := bson.M{"_id": model.ProcessingCheckpointID}
+
+	var checkpoint model.ProcessingCheckpointDocument
+	if err := client.FindOne(ctx, filter).Decode(&checkpoint); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, &NotFoundError{
+				Key:     model.ProcessingCheckpointID,
+				Message: "processing checkpoint not found",
+			}
+		}
+		return nil, fmt.Errorf("failed to get processing checkpoint: %w", err)
+	}
+
+	return &checkpoint, nil
+}
+
+// SaveProcessingCheckpoint advances the processing checkpoint to the height,
+// creating it if it does not exist, in a transaction fenced by the fence
+// unless it is nil. The checkpoint never moves backwards, a NotFoundError is
+// returned if it is beyond the height already, and ErrFenced if the
+// leadership was lost.
+func (db *Database) SaveProcessingCheckpoint(
+	ctx context.Context, height uint64, blockHash string, fence *model.LeaderFence,
+) error {
+	client := db.client.Database(db.dbName).Collection(model.ProcessingCheckpointCollection)
+
+	session, err := db.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	transactionWork := func(sessCtx mongo.SessionContext) (interface{}, error) {
+		if err := db.checkFence(sessCtx, fence); err != nil {
+			return nil, err
+		}
+		// A checkpoint beyond the height makes the upsert fail with a duplicate key.
+		filter := bson.M{
+			"_id":    model.ProcessingCheckpointID,
+			"height": bson.M{"$lte": height},
+		}
+		update := bson.M{
+			"$set": bson.M{
+				"height":     height,
+				"block_hash": blockHash,
+				"updated_at": time.Now().Unix(),
+			},
+		}
+		_, err := client.UpdateOne(sessCtx, filter, update, options.Update().SetUpsert(true))
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, &NotFoundError{
+				Key:     model.ProcessingCheckpointID,
+				Message: "processing checkpoint is beyond the given height",
+			}
+		}
+		return nil, err
+	}
+
+	if _, err := session.WithTransaction(ctx, transactionWork); err != nil {
+		if IsNotFoundError(err) || errors.Is(err, ErrFenced) {
+			return err
+		}
+		return fmt.Errorf("failed to save processing checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// RollbackProcessingCheckpoint moves the processing checkpoint back to the
+// height if it is beyond it, e.g. because the blocks above were reorged, in a
+// transaction fenced by the fence unless it is nil. ErrFenced is returned if
+// the leadership was lost.
+func (db *Database) RollbackProcessingCheckpoint(
+	ctx context.Context, height uint64, blockHash string, fence *model.LeaderFence,
+) error {
+	client := db.client.Database(db.dbName).Collection(model.ProcessingCheckpointCollection)
+
+	session, err := db.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	transactionWork := func(sessCtx mongo.SessionContext) (interface{}, error) {
+		if err := db.checkFence(sessCtx, fence); err != nil {
+			return nil, err
+		}
+		filter := bson.M{
+			"_id":    model.ProcessingCheckpointID,
+			"height": bson.M{"$gt": height},
+		}
+		update := bson.M{
+			"$set": bson.M{
+				"height":     height,
+				"block_hash": blockHash,
+				"updated_at": time.Now().Unix(),
+			},
+		}
+		_, err := client.UpdateOne(sessCtx, filter, update)
+		return nil, err
+	}
+
+	if _, err := session.WithTransaction(ctx, transactionWork); err != nil {
+		if errors.Is(err, ErrFenced) {
+			return err
+		}
+		return fmt.Errorf("failed to roll back processing checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// ListRecentBlocks returns the kept hashes of recent blocks, highest first.
+func (db *Database) ListRecentBlocks(ctx context.Context) ([]model.RecentBlockDocument, error) {
+	client := db.client.Database(db.dbName).Collection(model.RecentBlockCollection)
+	opts := options.Find().SetSort(bson.M{"_id": -1})
+
+	cursor, err := client.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recent blocks: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var blocks []model.RecentBlockDocument
+	if err := cursor.All(ctx, &blocks); err != nil {
+		return nil, fmt.Errorf("failed to list recent blocks: %w", err)
+	}
+
+	return blocks, nil
+}
+
+// SaveRecentBlocks stores the hashes of the blocks, replacing the ones kept
+// for the same heights, and drops the ones below keepFromHeight, in a
+// transaction fenced by the fence unless it is nil. ErrFenced is returned if
+// the leadership was lost.
+func (db *Database) SaveRecentBlocks(
+	ctx context.Context, blocks []model.RecentBlockDocument, keepFromHeight uint64, fence *model.LeaderFence,
+) error {
+	client := db.client.Database(db.dbName).Collection(model.RecentBlockCollection)
+
+	session, err := db.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	transactionWork := func(sessCtx mongo.SessionContext) (interface{}, error) {
+		if err := db.checkFence(sessCtx, fence); err != nil {
+			return nil, err
+		}
+		for _, block := range blocks {
+			filter := bson.M{"_id": block.Height}
+			if _, err := client.ReplaceOne(sessCtx, filter, block, options.Replace().SetUpsert(true)); err != nil {
+				return nil, fmt.Errorf("failed to save recent block at height %d: %w", block.Height, err)
+			}
+		}
+		if _, err := client.DeleteMany(sessCtx, bson.M{"_id": bson.M{"$lt": keepFromHeight}}); err != nil {
+			return nil, fmt.Errorf("failed to prune recent blocks: %w", err)
+		}
+		return nil, nil
+	}
+
+	if _, err := session.WithTransaction(ctx, transactionWork); err != nil {
+		if errors.Is(err, ErrFenced) {
+			return err
+		}
+		return fmt.Errorf("failed to save recent blocks: %w", err)
+	}
+
+	return nil
+}
 
-	result, err := client.DeleteOne(ctx, filter)
+// DeleteRecentBlocks drops the kept hashes of the blocks at or above the
+// height, in a transaction fenced by the fence unless it is nil. ErrFenced is
+// returned if the leadership was lost.
+func (db *Database) DeleteRecentBlocks(ctx context.Context, fromHeight uint64, fence *model.LeaderFence) error {
+	client := db.client.Database(db.dbName).Collection(model.RecentBlockCollection)
+
+	session, err := db.client.StartSession()
 	if err != nil {
-		return fmt.Errorf("failed to delete expired delegation with ID %v: %w", id, err)
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	transactionWork := func(sessCtx mongo.SessionContext) (interface{}, error) {
+		if err := db.checkFence(sessCtx, fence); err != nil {
+			return nil, err
+		}
+		_, err := client.DeleteMany(sessCtx, bson.M{"_id": bson.M{"$gte": fromHeight}})
+		return nil, err
+	}
+
+	if _, err := session.WithTransaction(ctx, transactionWork); err != nil {
+		if errors.Is(err, ErrFenced) {
+			return err
+		}
+		return fmt.Errorf("failed to delete recent blocks: %w", err)
+	}
+
+	return nil
+}
+
+// FindPublishedExpiries returns the history of the delegations whose expiry
+// event was published and that expired at or above the height.
+func (db *Database) FindPublishedExpiries(
+	ctx context.Context, fromHeight uint64,
+) ([]model.ExpiredHistoryDocument, error) {
+	client := db.client.Database(db.dbName).Collection(model.ExpiredHistoryCollection)
+	filter := bson.M{
+		"expire_height": bson.M{"$gte": fromHeight},
+		// Documents archived without an outcome were published.
+		"outcome": bson.M{"$in": bson.A{model.ExpiredHistoryOutcomePublished, nil}},
+	}
+	opts := options.Find().SetSort(bson.M{"expire_height": 1})
+
+	cursor, err := client.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find published expiries: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var expiries []model.ExpiredHistoryDocument
+	if err := cursor.All(ctx, &expiries); err != nil {
+		return nil, fmt.Errorf("failed to find published expiries: %w", err)
+	}
+
+	return expiries, nil
+}
+
+// RevertExpiredDelegation queues the delegation of a published expiry again,
+// marks its history as reverted by the reorg at the fork height and removes
+// its event from the published event ledger, so that the expiry is published
+// again once its height is confirmed in the new best chain, in a transaction
+// fenced by the fence unless it is nil. A NotFoundError is returned if the
+// history is not of a published expiry, and ErrFenced if the leadership was
+// lost.
+func (db *Database) RevertExpiredDelegation(
+	ctx context.Context, historyID primitive.ObjectID, forkHeight uint64, fence *model.LeaderFence,
+) error {
+	queueClient := db.client.Database(db.dbName).Collection(model.TimeLockCollection)
+	historyClient := db.client.Database(db.dbName).Collection(model.ExpiredHistoryCollection)
+	ledgerClient := db.client.Database(db.dbName).Collection(model.PublishedEventCollection)
+
+	session, err := db.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	transactionWork := func(sessCtx mongo.SessionContext) (interface{}, error) {
+		if err := db.checkFence(sessCtx, fence); err != nil {
+			return nil, err
+		}
+		filter := bson.M{
+			"_id":     historyID,
+			"outcome": bson.M{"$in": bson.A{model.ExpiredHistoryOutcomePublished, nil}},
+		}
+		update := bson.M{
+			"$set": bson.M{
+				"outcome":     model.ExpiredHistoryOutcomeReverted,
+				"fork_height": forkHeight,
+				"reverted_at": time.Now().Unix(),
+			},
+		}
+		var history model.ExpiredHistoryDocument
+		if err := historyClient.FindOneAndUpdate(sessCtx, filter, update).Decode(&history); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil, &NotFoundError{
+					Key:     historyID.Hex(),
+					Message: "no published expiry found with the given ID",
+				}
+			}
+			return nil, err
+		}
+
+		delegation := model.TimeLockDocument{
+			ID:                 history.TimeLockID,
+			StakingTxHashHex:   history.StakingTxHashHex,
+			ExpireHeight:       history.ExpireHeight,
+			TxType:             history.TxType,
+			Status:             model.TimeLockStatusPending,
+			StakingOutputIndex: history.StakingOutputIndex,
+			UnbondingTxHashHex: history.UnbondingTxHashHex,
+		}
+		if _, err := queueClient.InsertOne(sessCtx, delegation); err != nil {
+			return nil, err
+		}
+		ledgerFilter := bson.M{"_id": model.PublishedEventKey(history.StakingTxHashHex, history.TxType)}
+		if _, err := ledgerClient.DeleteOne(sessCtx, ledgerFilter); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	if _, err := session.WithTransaction(ctx, transactionWork); err != nil {
+		if IsNotFoundError(err) || errors.Is(err, ErrFenced) {
+			return err
+		}
+		return fmt.Errorf("failed to revert expired delegation with history ID %v: %w", historyID, err)
+	}
+
+	return nil
+}
+
+// AcquireLeaderLock renews the leader lock for the owner, or takes it over if
+// it is free or expired. It returns the current lock document when the owner
+// holds the lock, and a NotFoundError when another owner holds a live lock.
+func (db *Database) AcquireLeaderLock(
+	ctx context.Context, owner string, leaseDuration time.Duration,
+) (*model.LeaderLockDocument, error) {
+	client := db.client.Database(db.dbName).Collection(model.LeaderLockCollection)
+	now := time.Now()
+	expiresAt := now.Add(leaseDuration).Unix()
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	// Renew the lock if we still hold it, keeping the fencing token.
+	renewFilter := bson.M{
+		"_id":        model.LeaderLockID,
+		"owner":      owner,
+		"expires_at": bson.M{"$gte": now.Unix()},
+	}
+	renewUpdate := bson.M{"$set": bson.M{"expires_at": expiresAt}}
+
+	var lock model.LeaderLockDocument
+	err := client.FindOneAndUpdate(ctx, renewFilter, renewUpdate, opts).Decode(&lock)
+	if err == nil {
+		return &lock, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("failed to renew leader lock: %w", err)
+	}
+
+	// Otherwise take over an expired lock, or create it if it does not exist.
+	// A live lock of another owner makes the upsert fail with a duplicate key.
+	takeoverFilter := bson.M{
+		"_id":        model.LeaderLockID,
+		"expires_at": bson.M{"$lt": now.Unix()},
+	}
+	takeoverUpdate := bson.M{
+		"$set": bson.M{"owner": owner, "expires_at": expiresAt},
+		"$inc": bson.M{"fencing_token": 1},
+	}
+	err = client.FindOneAndUpdate(ctx, takeoverFilter, takeoverUpdate, opts.SetUpsert(true)).Decode(&lock)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, &NotFoundError{
+				Key:     model.LeaderLockID,
+				Message: "leader lock is held by another owner",
+			}
+		}
+		return nil, fmt.Errorf("failed to take over leader lock: %w", err)
+	}
+
+	return &lock, nil
+}
+
+// ValidateLeaderLock checks that the owner still holds a live leader lock with
+// the given fencing token. It returns a NotFoundError otherwise.
+func (db *Database) ValidateLeaderLock(ctx context.Context, owner string, fencingToken int64) error {
+	client := db.client.Database(db.dbName).Collection(model.LeaderLockCollection)
+	filter := bson.M{
+		"_id":           model.LeaderLockID,
+		"owner":         owner,
+		"fencing_token": fencingToken,
+		"expires_at":    bson.M{"$gte": time.Now().Unix()},
+	}
+
+	count, err := client.CountDocuments(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to validate leader lock: %w", err)
+	}
+	if count == 0 {
+		return &NotFoundError{
+			Key:     model.LeaderLockID,
+			Message: "leader lock with the given fencing token is not held by the owner",
+		}
+	}
+
+	return nil
+}
+
+// checkFence makes sure within the transaction that the fence still holds the
+// leader lock, so that a stale leader can not write after another instance
+// took over. The lock is written rather than read, a takeover racing with the
+// transaction then conflicts with it and one of them is retried. Concurrent
+// fenced writes conflict the same way, the transactions retry them.
+func (db *Database) checkFence(sessCtx mongo.SessionContext, fence *model.LeaderFence) error {
+	if fence == nil {
+		return nil
+	}
+	client := db.client.Database(db.dbName).Collection(model.LeaderLockCollection)
+	filter := bson.M{
+		"_id":           model.LeaderLockID,
+		"owner":         fence.Owner,
+		"fencing_token": fence.FencingToken,
+		"expires_at":    bson.M{"$gte": time.Now().Unix()},
+	}
+	result, err := client.UpdateOne(sessCtx, filter, bson.M{"$inc": bson.M{"fenced_writes": 1}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrFenced
+	}
+	return nil
+}
+
+// ReleaseLeaderLock expires the leader lock if it is held by the owner, so
+// that a standby can take over without waiting for the lease to run out.
+func (db *Database) ReleaseLeaderLock(ctx context.Context, owner string) error {
+	client := db.client.Database(db.dbName).Collection(model.LeaderLockCollection)
+	filter := bson.M{
+		"_id":   model.LeaderLockID,
+		"owner": owner,
 	}
+	update := bson.M{"$set": bson.M{"expires_at": int64(0)}}
 
-	// Check if any document was deleted
-	if result.DeletedCount == 0 {
-		return fmt.Errorf("no expired delegation found with ID %v", id)
+	if _, err := client.UpdateOne(ctx, filter, update); err != nil {
+		return fmt.Errorf("failed to release leader lock: %w", err)
 	}
 
 	return nil
@@ -1 +1,23 @@
 package db
+
+import "errors"
+
+// NotFoundError is returned when a document to update is not found, or is no
+// longer in the state the update expects.
+type NotFoundError struct {
+	Key     string
+	Message string
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Message
+}
+
+func IsNotFoundError(err error) bool {
+	var notFoundErr *NotFoundError
+	return errors.As(err, &notFoundErr)
+}
+
+// ErrFenced is returned when a fenced write is rejected, because the leader
+// lock is no longer held with the fencing token of the write.
+var ErrFenced = errors.New("leader lock is no longer held with the fencing token")
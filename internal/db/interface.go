@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"github.com/babylonchain/staking-expiry-checker/internal/db/model"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -9,10 +10,66 @@ import (
 
 type DbInterface interface {
 	Ping(ctx context.Context) error
-	FindExpiredDelegations(
-		ctx context.Context, btcTipHeight uint64,
+	ClaimExpiredDelegations(
+		ctx context.Context, btcTipHeight uint64, owner string, leaseDuration time.Duration, limit int,
 	) ([]model.TimeLockDocument, error)
-	DeleteExpiredDelegation(
+	RecordDelegationFailure(
+		ctx context.Context, id primitive.ObjectID, owner string, failure error, notPublished bool, maxFailures int,
+		fence *model.LeaderFence,
+	) (bool, error)
+	RecordMaybePublished(ctx context.Context, id primitive.ObjectID, owner string, failure error) error
+	ReleaseDelegation(
+		ctx context.Context, id primitive.ObjectID, owner string, status model.TimeLockStatus,
+	) error
+	MarkDelegationPublished(
+		ctx context.Context, id primitive.ObjectID, owner string, tipHeight uint64, sent bool,
+		fence *model.LeaderFence,
+	) error
+	IsEventPublished(
+		ctx context.Context, stakingTxHashHex, txType string,
+	) (bool, error)
+	ArchiveExpiredDelegation(
+		ctx context.Context, id primitive.ObjectID, fence *model.LeaderFence,
+	) error
+	ArchivePublishedDelegations(ctx context.Context, fence *model.LeaderFence) (int64, error)
+	ArchiveSpentDelegation(
+		ctx context.Context, id primitive.ObjectID, owner string, tipHeight uint64, fence *model.LeaderFence,
+	) error
+	QuarantineDelegation(
+		ctx context.Context, id primitive.ObjectID, owner string, reason string, computedExpireHeight uint64,
+		fence *model.LeaderFence,
+	) error
+	NextExpireHeight(ctx context.Context, afterHeight uint64) (uint64, error)
+	CountExpiredDelegations(ctx context.Context, height uint64) (int64, error)
+	GetProcessingCheckpoint(ctx context.Context) (*model.ProcessingCheckpointDocument, error)
+	SaveProcessingCheckpoint(
+		ctx context.Context, height uint64, blockHash string, fence *model.LeaderFence,
+	) error
+	RollbackProcessingCheckpoint(
+		ctx context.Context, height uint64, blockHash string, fence *model.LeaderFence,
+	) error
+	ListRecentBlocks(ctx context.Context) ([]model.RecentBlockDocument, error)
+	SaveRecentBlocks(
+		ctx context.Context, blocks []model.RecentBlockDocument, keepFromHeight uint64, fence *model.LeaderFence,
+	) error
+	DeleteRecentBlocks(ctx context.Context, fromHeight uint64, fence *model.LeaderFence) error
+	FindPublishedExpiries(
+		ctx context.Context, fromHeight uint64,
+	) ([]model.ExpiredHistoryDocument, error)
+	RevertExpiredDelegation(
+		ctx context.Context, historyID primitive.ObjectID, forkHeight uint64, fence *model.LeaderFence,
+	) error
+	AcquireLeaderLock(
+		ctx context.Context, owner string, leaseDuration time.Duration,
+	) (*model.LeaderLockDocument, error)
+	ValidateLeaderLock(
+		ctx context.Context, owner string, fencingToken int64,
+	) error
+	ReleaseLeaderLock(ctx context.Context, owner string) error
+	ListDeadLetters(
+		ctx context.Context, limit int64,
+	) ([]model.TimeLockDeadLetterDocument, error)
+	RequeueDeadLetter(
 		ctx context.Context, id primitive.ObjectID,
 	) error
 }
@@ -0,0 +1,16 @@
+package model
+
+const ProcessingCheckpointCollection = "processing_checkpoint"
+
+// ProcessingCheckpointID is the ID of the single checkpoint document.
+const ProcessingCheckpointID = "staking-expiry-checker"
+
+// ProcessingCheckpointDocument records the last height up to which all
+// expiries were processed, along with the hash of the block at that height.
+type ProcessingCheckpointDocument struct {
+	ID        string `bson:"_id"`
+	Height    uint64 `bson:"height"`
+	BlockHash string `bson:"block_hash,omitempty"`
+	// UpdatedAt is the unix timestamp at which the checkpoint last advanced.
+	UpdatedAt int64 `bson:"updated_at"`
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const TimeLockDeadLetterCollection = "timelock_dead_letter"
+
+// TimeLockDeadLetterDocument holds a timelock document that failed to be
+// processed too many times, until an operator requeues it.
+type TimeLockDeadLetterDocument struct {
+	ID primitive.ObjectID `bson:"_id"`
+	// Document is the original timelock document as it was stored in the queue.
+	Document       bson.Raw `bson:"document"`
+	LastError      string   `bson:"last_error"`
+	FailureCount   int64    `bson:"failure_count"`
+	FirstFailedAt  int64    `bson:"first_failed_at"`
+	LastFailedAt   int64    `bson:"last_failed_at"`
+	DeadLetteredAt int64    `bson:"dead_lettered_at"`
+}
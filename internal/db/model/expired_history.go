@@ -0,0 +1,53 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const ExpiredHistoryCollection = "expired_history"
+
+// ExpiredHistoryOutcome tells how an expired delegation was completed.
+// Documents archived without an outcome were published.
+type ExpiredHistoryOutcome string
+
+const (
+	// ExpiredHistoryOutcomePublished means the expiry event was published.
+	ExpiredHistoryOutcomePublished ExpiredHistoryOutcome = "published"
+	// ExpiredHistoryOutcomeSpent means the timelocked output was already spent,
+	// e.g. by slashing, so no expiry event was published.
+	ExpiredHistoryOutcomeSpent ExpiredHistoryOutcome = "spent"
+	// ExpiredHistoryOutcomeReverted means the expiry event was published but
+	// its height left the best chain, the delegation was queued again.
+	ExpiredHistoryOutcomeReverted ExpiredHistoryOutcome = "reverted"
+)
+
+// ExpiredHistoryDocument records how an expired delegation was completed,
+// written when the timelock document is removed from the queue.
+type ExpiredHistoryDocument struct {
+	ID primitive.ObjectID `bson:"_id"`
+	// TimeLockID is the ID the document had in the timelock queue.
+	TimeLockID       primitive.ObjectID    `bson:"timelock_id"`
+	StakingTxHashHex string                `bson:"staking_tx_hash_hex"`
+	TxType           string                `bson:"tx_type"`
+	ExpireHeight     uint64                `bson:"expire_height"`
+	Outcome          ExpiredHistoryOutcome `bson:"outcome,omitempty"`
+	// PublishedAt is the unix timestamp at which the event was confirmed as published.
+	PublishedAt int64 `bson:"published_at"`
+	// TipHeight is the btc tip height observed when the event was published,
+	// or when the output was found spent.
+	TipHeight uint64 `bson:"tip_height"`
+	// InstanceID identifies the checker instance that completed the delegation.
+	InstanceID string `bson:"instance_id"`
+	// StakingOutputIndex and UnbondingTxHashHex are kept from the timelock
+	// document, so that it can be restored when its expiry is reverted.
+	StakingOutputIndex *uint32 `bson:"staking_output_index,omitempty"`
+	UnbondingTxHashHex string  `bson:"unbonding_tx_hash_hex,omitempty"`
+	// ForkHeight is the lowest height replaced by the reorg that reverted the expiry.
+	ForkHeight uint64 `bson:"fork_height,omitempty"`
+	// RevertedAt is the unix timestamp at which the expiry was reverted.
+	RevertedAt int64 `bson:"reverted_at,omitempty"`
+	// ArchivedAt is a date rather than a unix timestamp, the retention TTL index requires it.
+	ArchivedAt time.Time `bson:"archived_at"`
+}
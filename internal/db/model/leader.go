@@ -0,0 +1,26 @@
+package model
+
+const LeaderLockCollection = "leader_lock"
+
+// LeaderLockID is the ID of the lock document replicas compete for.
+const LeaderLockID = "staking-expiry-checker"
+
+type LeaderLockDocument struct {
+	ID    string `bson:"_id"`
+	Owner string `bson:"owner"`
+	// FencingToken is incremented every time the leadership changes hands,
+	// so that a stale leader can detect that it was replaced.
+	FencingToken int64 `bson:"fencing_token"`
+	// ExpiresAt is the unix timestamp after which other replicas may take over.
+	ExpiresAt int64 `bson:"expires_at"`
+	// FencedWrites counts the fenced writes, which bump it so that a
+	// takeover conflicts with the fenced writes in flight.
+	FencedWrites int64 `bson:"fenced_writes,omitempty"`
+}
+
+// LeaderFence identifies the leadership a write is made under. A fenced write
+// is rejected once the owner lost the leader lock or got a new fencing token.
+type LeaderFence struct {
+	Owner        string
+	FencingToken int64
+}
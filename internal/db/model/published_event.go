@@ -0,0 +1,25 @@
+package model
+
+import (
+	"time"
+)
+
+const PublishedEventCollection = "published_events"
+
+// PublishedEventDocument is an entry of the ledger of published expiry
+// events, used to suppress publishing the same event twice.
+type PublishedEventDocument struct {
+	// ID is the event key built by PublishedEventKey.
+	ID               string `bson:"_id"`
+	StakingTxHashHex string `bson:"staking_tx_hash_hex"`
+	TxType           string `bson:"tx_type"`
+	// PublishedAt is a date rather than a unix timestamp, the dedup window TTL index requires it.
+	PublishedAt time.Time `bson:"published_at"`
+	// InstanceID identifies the checker instance that published the event.
+	InstanceID string `bson:"instance_id"`
+}
+
+// PublishedEventKey identifies the expiry event of a staking tx.
+func PublishedEventKey(stakingTxHashHex, txType string) string {
+	return stakingTxHashHex + ":" + txType
+}
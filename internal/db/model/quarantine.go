@@ -0,0 +1,22 @@
+package model
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const TimeLockQuarantineCollection = "timelock_quarantine"
+
+// TimeLockQuarantineDocument holds a timelock document whose expire height
+// does not match the chain, so that its expiry is not published early.
+type TimeLockQuarantineDocument struct {
+	ID primitive.ObjectID `bson:"_id"`
+	// Document is the original timelock document as it was stored in the queue.
+	Document bson.Raw `bson:"document"`
+	Reason   string   `bson:"reason"`
+	// ComputedExpireHeight is the expiry derived from the chain, zero if it could not be derived.
+	ComputedExpireHeight uint64 `bson:"computed_expire_height,omitempty"`
+	// InstanceID identifies the checker instance that quarantined the document.
+	InstanceID    string `bson:"instance_id"`
+	QuarantinedAt int64  `bson:"quarantined_at"`
+}
@@ -0,0 +1,10 @@
+package model
+
+const RecentBlockCollection = "recent_blocks"
+
+// RecentBlockDocument is the hash of a recently processed block, kept to
+// detect the block leaving the best chain in a reorg.
+type RecentBlockDocument struct {
+	Height uint64 `bson:"_id"`
+	Hash   string `bson:"hash"`
+}
@@ -6,9 +6,74 @@ import (
 
 const TimeLockCollection = "timelock_queue"
 
+// TimeLockStatus tracks the publishing progress of a timelock document.
+// Documents inserted upstream carry no status and are treated as pending.
+type TimeLockStatus string
+
+const (
+	TimeLockStatusPending    TimeLockStatus = "pending"
+	TimeLockStatusPublishing TimeLockStatus = "publishing"
+	TimeLockStatusPublished  TimeLockStatus = "published"
+)
+
+func (s TimeLockStatus) String() string {
+	return string(s)
+}
+
+const (
+	TimeLockTxTypeActive    = "active"
+	TimeLockTxTypeUnbonding = "unbonding"
+)
+
+// unbondingOutputIndex is the index of the timelocked output of an unbonding
+// transaction, which has no other output.
+const unbondingOutputIndex = 0
+
 type TimeLockDocument struct {
 	ID               primitive.ObjectID `bson:"_id"`
 	StakingTxHashHex string             `bson:"staking_tx_hash_hex"`
 	ExpireHeight     uint64             `bson:"expire_height"`
 	TxType           string             `bson:"tx_type"`
+	Status           TimeLockStatus     `bson:"status,omitempty"`
+	// LeaseOwner is the instance that claimed the document for publishing.
+	LeaseOwner string `bson:"lease_owner,omitempty"`
+	// LeaseExpiresAt is the unix timestamp after which other instances may reclaim the document.
+	LeaseExpiresAt int64 `bson:"lease_expires_at,omitempty"`
+	// PublishedAt is the unix timestamp at which the event was confirmed as published.
+	PublishedAt int64 `bson:"published_at,omitempty"`
+	// PublishedTipHeight is the btc tip height observed when the event was published.
+	PublishedTipHeight uint64 `bson:"published_tip_height,omitempty"`
+	// FailureCount is the number of failed attempts to process the document.
+	FailureCount int64 `bson:"failure_count,omitempty"`
+	// LastError is the error of the most recent failed attempt.
+	LastError string `bson:"last_error,omitempty"`
+	// MaybePublished is set if a send was not confirmed by the broker, which
+	// may have stored the event nonetheless.
+	MaybePublished bool `bson:"maybe_published,omitempty"`
+	// StakingOutputIndex is the index of the staking output in the staking transaction, if known.
+	StakingOutputIndex *uint32 `bson:"staking_output_index,omitempty"`
+	// UnbondingTxHashHex is the hash of the unbonding transaction of unbonding delegations, if known.
+	UnbondingTxHashHex string `bson:"unbonding_tx_hash_hex,omitempty"`
+	// DecodeErr is set instead of the other fields when the stored document could not be decoded.
+	DecodeErr error `bson:"-"`
+}
+
+// TimeLockOutpoint returns the output locked until the expiry, the staking
+// output of active delegations and the unbonding output of unbonding ones.
+// It reports false if the document does not tell which output it is.
+func (d TimeLockDocument) TimeLockOutpoint() (string, uint32, bool) {
+	switch d.TxType {
+	case TimeLockTxTypeActive:
+		if d.StakingOutputIndex == nil {
+			return "", 0, false
+		}
+		return d.StakingTxHashHex, *d.StakingOutputIndex, true
+	case TimeLockTxTypeUnbonding:
+		if d.UnbondingTxHashHex == "" {
+			return "", 0, false
+		}
+		return d.UnbondingTxHashHex, unbondingOutputIndex, true
+	default:
+		return "", 0, false
+	}
 }
@@ -0,0 +1,559 @@
+package fakebtc
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+)
+
+const (
+	DefaultRpcUser = "rpcuser"
+	DefaultRpcPass = "rpcpass"
+)
+
+// Server is an in-process bitcoind serving the JSON-RPC methods used by the
+// checker. The tip, the sync state, the confirmed transactions and failures
+// of the node are scripted by the caller.
+type Server struct {
+	server *httptest.Server
+
+	mu         sync.Mutex
+	user       string
+	pass       string
+	tip        int64
+	tipScript  []int64
+	headers    int64
+	ibd        bool
+	latency    time.Duration
+	rejectAuth bool
+	failures   map[string][]*btcjson.RPCError
+	calls      map[string]int
+	txs        map[chainhash.Hash]confirmedTx
+	spent      map[wire.OutPoint]int64 // spend heights
+	forks      []int64
+	quit       chan struct{}
+	closeOnce  sync.Once
+}
+
+type confirmedTx struct {
+	tx     *wire.MsgTx
+	height int64
+}
+
+type rpcRequest struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type rpcResponse struct {
+	Result interface{}       `json:"result"`
+	Error  *btcjson.RPCError `json:"error"`
+	ID     json.RawMessage   `json:"id"`
+}
+
+// NewServer starts a fake bitcoind serving HTTP at the given tip height,
+// accepting the default credentials.
+func NewServer(tip int64) *Server {
+	s := newServer(tip)
+	s.server = httptest.NewServer(s)
+	return s
+}
+
+// NewTLSServer starts a fake bitcoind serving HTTPS with a self-signed
+// certificate. The tls config may e.g. require client certificates, the
+// server accepts any client when it is nil.
+func NewTLSServer(tip int64, tlsConfig *tls.Config) *Server {
+	s := newServer(tip)
+	s.server = httptest.NewUnstartedServer(s)
+	s.server.TLS = tlsConfig
+	s.server.StartTLS()
+	return s
+}
+
+func newServer(tip int64) *Server {
+	return &Server{
+		user:     DefaultRpcUser,
+		pass:     DefaultRpcPass,
+		tip:      tip,
+		headers:  tip,
+		failures: make(map[string][]*btcjson.RPCError),
+		calls:    make(map[string]int),
+		txs:      make(map[chainhash.Hash]confirmedTx),
+		spent:    make(map[wire.OutPoint]int64),
+		quit:     make(chan struct{}),
+	}
+}
+
+// Endpoint returns the host:port of the server, as configured for the btc client.
+func (s *Server) Endpoint() string {
+	return s.server.Listener.Addr().String()
+}
+
+// Certificate returns the self-signed certificate of a TLS server.
+func (s *Server) Certificate() *x509.Certificate {
+	return s.server.Certificate()
+}
+
+// Configure points the btc config at the server, replacing any other endpoint.
+func (s *Server) Configure(cfg *config.BtcConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cfg.Backend = config.BackendBitcoind
+	cfg.Endpoint = s.Endpoint()
+	cfg.Endpoints = nil
+	cfg.DisableTLS = s.server.TLS == nil
+	cfg.RpcUser = s.user
+	cfg.RpcPass = s.pass
+	cfg.RpcCookieFile = ""
+	cfg.TLS = config.BtcTLSConfig{}
+	cfg.Proxy = ""
+	cfg.ZmqBlockEndpoint = ""
+}
+
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		close(s.quit)
+		s.server.Close()
+	})
+}
+
+// SetCredentials changes the credentials accepted by the server, e.g. to
+// simulate a rotated cookie.
+func (s *Server) SetCredentials(user, pass string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.user, s.pass = user, pass
+}
+
+// RejectAuth makes the server answer every request with 401 Unauthorized.
+func (s *Server) RejectAuth(reject bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rejectAuth = reject
+}
+
+// SetTip moves the tip to the given height, dropping any scripted tips.
+func (s *Server) SetTip(tip int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tip = tip
+	s.headers = tip
+	s.tipScript = nil
+}
+
+// Reorg replaces the blocks from the fork height on by those of another
+// branch, whose tip is at the given height. The confirmed transactions stay
+// confirmed at their heights, as if mined again on the new branch.
+func (s *Server) Reorg(forkHeight, tip int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forks = append(s.forks, forkHeight)
+	s.tip = tip
+	s.headers = tip
+	s.tipScript = nil
+}
+
+// ScriptTips makes the following getblockcount requests answer the given
+// heights in order, the last height stays the tip afterwards.
+func (s *Server) ScriptTips(tips ...int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tipScript = append([]int64{}, tips...)
+}
+
+// AutoMine mines a block every interval until the server is closed.
+func (s *Server) AutoMine(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.mu.Lock()
+				s.tip++
+				s.headers = s.tip
+				s.mu.Unlock()
+			case <-s.quit:
+				return
+			}
+		}
+	}()
+}
+
+// Tip returns the current tip height.
+func (s *Server) Tip() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tip
+}
+
+// SetSyncing reports the node as in initial block download with the given
+// number of headers known beyond the tip.
+func (s *Server) SetSyncing(syncing bool, headersAhead int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ibd = syncing
+	s.headers = s.tip + headersAhead
+}
+
+// SetLatency delays every response by the given duration.
+func (s *Server) SetLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = latency
+}
+
+// FailNext makes the next count requests of the method fail with the error.
+func (s *Server) FailNext(method string, count int, err *btcjson.RPCError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < count; i++ {
+		s.failures[method] = append(s.failures[method], err)
+	}
+}
+
+// Calls returns how often the method was requested.
+func (s *Server) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+// AddTx confirms the transaction in the block at the given height.
+func (s *Server) AddTx(tx *wire.MsgTx, height int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.txs[tx.TxHash()] = confirmedTx{tx: tx, height: height}
+}
+
+// SpendOutput marks the output of a confirmed transaction as spent by a
+// transaction in the block at the given height.
+func (s *Server) SpendOutput(txHash chainhash.Hash, index uint32, height int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spent[*wire.NewOutPoint(&txHash, index)] = height
+}
+
+// ServeHTTP answers a JSON-RPC request the way bitcoind does: failed calls
+// are answered with an error status and the error in the body.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	latency := s.latency
+	user, pass, rejectAuth := s.user, s.pass, s.rejectAuth
+	s.mu.Unlock()
+
+	select {
+	case <-time.After(latency):
+	case <-r.Context().Done():
+		return
+	case <-s.quit:
+		// Close waits for the requests in flight.
+		return
+	}
+
+	reqUser, reqPass, ok := r.BasicAuth()
+	if rejectAuth || !ok || reqUser != user || reqPass != pass {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var req rpcRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeResponse(w, http.StatusInternalServerError, rpcResponse{
+			Error: btcjson.NewRPCError(btcjson.ErrRPCParse.Code, err.Error()),
+		})
+		return
+	}
+
+	result, rpcErr := s.handle(req)
+	status := http.StatusOK
+	if rpcErr != nil {
+		status = http.StatusInternalServerError
+		if rpcErr.Code == btcjson.ErrRPCMethodNotFound.Code {
+			status = http.StatusNotFound
+		}
+	}
+	s.writeResponse(w, status, rpcResponse{Result: result, Error: rpcErr, ID: req.ID})
+}
+
+func (s *Server) writeResponse(w http.ResponseWriter, status int, resp rpcResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) handle(req rpcRequest) (interface{}, *btcjson.RPCError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls[req.Method]++
+	if failures := s.failures[req.Method]; len(failures) > 0 {
+		s.failures[req.Method] = failures[1:]
+		return nil, failures[0]
+	}
+
+	switch req.Method {
+	case "getblockcount":
+		if len(s.tipScript) > 0 {
+			s.tip, s.tipScript = s.tipScript[0], s.tipScript[1:]
+			s.headers = s.tip
+		}
+		return s.tip, nil
+	case "getblockchaininfo":
+		return btcjson.GetBlockChainInfoResult{
+			Chain:                "regtest",
+			Blocks:               int32(s.tip),
+			Headers:              int32(s.headers),
+			BestBlockHash:        s.blockHash(s.tip).String(),
+			InitialBlockDownload: s.ibd,
+		}, nil
+	case "getrawtransaction":
+		return s.getRawTransaction(req.Params)
+	case "gettxout":
+		return s.getTxOut(req.Params)
+	case "getblockheader":
+		return s.getBlockHeader(req.Params)
+	case "getblockhash":
+		return s.getBlockHash(req.Params)
+	case "getblock":
+		return s.getBlock(req.Params)
+	default:
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCMethodNotFound.Code, "Method not found")
+	}
+}
+
+func (s *Server) getRawTransaction(params []json.RawMessage) (interface{}, *btcjson.RPCError) {
+	var (
+		txID    string
+		verbose bool
+	)
+	if err := parseParams(params, &txID, &verbose); err != nil {
+		return nil, err
+	}
+	confirmed, err := s.lookupTx(txID)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw bytes.Buffer
+	if err := confirmed.tx.Serialize(&raw); err != nil {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCInternal.Code, err.Error())
+	}
+	if !verbose {
+		return hex.EncodeToString(raw.Bytes()), nil
+	}
+	return btcjson.TxRawResult{
+		Hex:           hex.EncodeToString(raw.Bytes()),
+		Txid:          txID,
+		Hash:          confirmed.tx.WitnessHash().String(),
+		Version:       uint32(confirmed.tx.Version),
+		LockTime:      confirmed.tx.LockTime,
+		BlockHash:     s.blockHash(confirmed.height).String(),
+		Confirmations: uint64(s.tip - confirmed.height + 1),
+	}, nil
+}
+
+func (s *Server) getTxOut(params []json.RawMessage) (interface{}, *btcjson.RPCError) {
+	var (
+		txID    string
+		index   uint32
+		mempool bool
+	)
+	if err := parseParams(params, &txID, &index, &mempool); err != nil {
+		return nil, err
+	}
+	confirmed, err := s.lookupTx(txID)
+	if err != nil || int(index) >= len(confirmed.tx.TxOut) {
+		// bitcoind answers null for unknown outputs.
+		return nil, nil
+	}
+	txHash := confirmed.tx.TxHash()
+	if s.isSpent(*wire.NewOutPoint(&txHash, index)) {
+		return nil, nil
+	}
+
+	out := confirmed.tx.TxOut[index]
+	return btcjson.GetTxOutResult{
+		BestBlock:     s.blockHash(s.tip).String(),
+		Confirmations: s.tip - confirmed.height + 1,
+		Value:         btcutil.Amount(out.Value).ToBTC(),
+		ScriptPubKey:  btcjson.ScriptPubKeyResult{Hex: hex.EncodeToString(out.PkScript)},
+	}, nil
+}
+
+func (s *Server) getBlockHeader(params []json.RawMessage) (interface{}, *btcjson.RPCError) {
+	var (
+		hash    string
+		verbose = true
+	)
+	if err := parseParams(params, &hash, &verbose); err != nil {
+		return nil, err
+	}
+	if !verbose {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCInvalidParameter, "only verbose headers are served")
+	}
+	height, err := s.blockHeight(hash)
+	if err != nil {
+		return nil, err
+	}
+	return btcjson.GetBlockHeaderVerboseResult{
+		Hash:          hash,
+		Height:        int32(height),
+		Confirmations: s.tip - height + 1,
+	}, nil
+}
+
+// isSpent reports whether the output is spent by a confirmed transaction.
+// Spends confirmed above a lowered tip were reorged out.
+func (s *Server) isSpent(outPoint wire.OutPoint) bool {
+	if height, spent := s.spent[outPoint]; spent && height <= s.tip {
+		return true
+	}
+	for _, confirmed := range s.txs {
+		if confirmed.height > s.tip {
+			continue
+		}
+		for _, in := range confirmed.tx.TxIn {
+			if in.PreviousOutPoint == outPoint {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getBlock serves the block with its transactions decoded, i.e. verbosity 2.
+// Besides the confirmed transactions a block holds a transaction for every
+// output spent at its height.
+func (s *Server) getBlock(params []json.RawMessage) (interface{}, *btcjson.RPCError) {
+	var (
+		hash      string
+		verbosity = 1
+	)
+	if err := parseParams(params, &hash, &verbosity); err != nil {
+		return nil, err
+	}
+	if verbosity != 2 {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCInvalidParameter, "only blocks with decoded transactions are served")
+	}
+	height, err := s.blockHeight(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	block := btcjson.GetBlockVerboseTxResult{
+		Hash:          hash,
+		Height:        height,
+		Confirmations: s.tip - height + 1,
+	}
+	for txHash, confirmed := range s.txs {
+		if confirmed.height != height {
+			continue
+		}
+		tx := btcjson.TxRawResult{Txid: txHash.String()}
+		for _, in := range confirmed.tx.TxIn {
+			tx.Vin = append(tx.Vin, btcjson.Vin{
+				Txid: in.PreviousOutPoint.Hash.String(),
+				Vout: in.PreviousOutPoint.Index,
+			})
+		}
+		block.Tx = append(block.Tx, tx)
+	}
+	for outPoint, spendHeight := range s.spent {
+		if spendHeight != height {
+			continue
+		}
+		block.Tx = append(block.Tx, btcjson.TxRawResult{
+			Txid: chainhash.DoubleHashH([]byte(outPoint.String())).String(),
+			Vin:  []btcjson.Vin{{Txid: outPoint.Hash.String(), Vout: outPoint.Index}},
+		})
+	}
+	return block, nil
+}
+
+// blockHeight returns the height of the block with the hash on the current branch.
+func (s *Server) blockHeight(hash string) (int64, *btcjson.RPCError) {
+	for height := s.tip; height >= 0; height-- {
+		if s.blockHash(height).String() == hash {
+			return height, nil
+		}
+	}
+	return 0, btcjson.NewRPCError(btcjson.ErrRPCBlockNotFound, "Block not found")
+}
+
+func (s *Server) getBlockHash(params []json.RawMessage) (interface{}, *btcjson.RPCError) {
+	var height int64
+	if err := parseParams(params, &height); err != nil {
+		return nil, err
+	}
+	if height < 0 || height > s.tip {
+		return nil, btcjson.NewRPCError(btcjson.ErrRPCInvalidParameter, "Block height out of range")
+	}
+	return s.blockHash(height).String(), nil
+}
+
+func (s *Server) lookupTx(txID string) (confirmedTx, *btcjson.RPCError) {
+	txHash, err := chainhash.NewHashFromStr(txID)
+	if err != nil {
+		return confirmedTx{}, btcjson.NewRPCError(btcjson.ErrRPCInvalidParameter, err.Error())
+	}
+	confirmed, ok := s.txs[*txHash]
+	// Transactions confirmed above a lowered tip were reorged out.
+	if !ok || confirmed.height > s.tip {
+		return confirmedTx{}, btcjson.NewRPCError(
+			btcjson.ErrRPCNoTxInfo, "No such mempool or blockchain transaction. Use gettransaction for wallet transactions.",
+		)
+	}
+	return confirmed, nil
+}
+
+// parseParams decodes the positional params into the targets, leaving
+// targets of omitted trailing params untouched.
+func parseParams(params []json.RawMessage, targets ...interface{}) *btcjson.RPCError {
+	if len(params) > len(targets) {
+		return btcjson.NewRPCError(btcjson.ErrRPCInvalidParams.Code, "too many params")
+	}
+	for i, param := range params {
+		if err := json.Unmarshal(param, targets[i]); err != nil {
+			return btcjson.NewRPCError(btcjson.ErrRPCInvalidParams.Code, fmt.Sprintf("invalid param %d: %v", i, err))
+		}
+	}
+	if len(params) == 0 && len(targets) > 0 {
+		return btcjson.NewRPCError(btcjson.ErrRPCInvalidParams.Code, "missing params")
+	}
+	return nil
+}
+
+// blockHash derives a stable fake hash of the block at the height on the
+// current branch. Callers must hold the lock.
+func (s *Server) blockHash(height int64) chainhash.Hash {
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:8], uint64(height))
+	branch := uint64(0)
+	for _, fork := range s.forks {
+		if height >= fork {
+			branch++
+		}
+	}
+	if branch == 0 {
+		return chainhash.DoubleHashH(append([]byte("fakebtc"), buf[:8]...))
+	}
+	binary.BigEndian.PutUint64(buf[8:], branch)
+	return chainhash.DoubleHashH(append([]byte("fakebtc"), buf[:]...))
+}
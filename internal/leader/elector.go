@@ -0,0 +1,167 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/db"
+	"github.com/babylonchain/staking-expiry-checker/internal/db/model"
+	"github.com/babylonchain/staking-expiry-checker/internal/observability/metrics"
+)
+
+var ErrNotLeader = errors.New("instance is not the leader")
+
+const resignTimeout = 5 * time.Second
+
+// Elector competes with other replicas for the leader lock document and keeps
+// track of whether this instance is the current leader.
+type Elector struct {
+	db            db.DbInterface
+	owner         string
+	leaseDuration time.Duration
+	renewInterval time.Duration
+	quit          chan struct{}
+
+	mu           sync.RWMutex
+	isLeader     bool
+	fencingToken int64
+	// leaseDeadline is when the lease runs out locally, so that the leadership
+	// is given up even if the lock can not be renewed because the db is down.
+	leaseDeadline time.Time
+}
+
+func NewElector(cfg *config.LeaderElectionConfig, db db.DbInterface, owner string) *Elector {
+	return &Elector{
+		db:            db,
+		owner:         owner,
+		leaseDuration: cfg.LeaseDuration,
+		renewInterval: cfg.RenewInterval,
+		quit:          make(chan struct{}),
+	}
+}
+
+// Start tries to acquire or renew the leadership every renew interval until
+// the context is cancelled or the elector is stopped.
+func (e *Elector) Start(ctx context.Context) {
+	ticker := time.NewTicker(e.renewInterval)
+	defer ticker.Stop()
+
+	e.campaign(ctx)
+	for {
+		select {
+		case <-ticker.C:
+			e.campaign(ctx)
+		case <-ctx.Done():
+			e.resign()
+			return
+		case <-e.quit:
+			e.resign()
+			return
+		}
+	}
+}
+
+func (e *Elector) Stop() {
+	close(e.quit)
+}
+
+// IsLeader reports whether this instance holds a lease that has not run out.
+func (e *Elector) IsLeader() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.isLeader && time.Now().Before(e.leaseDeadline)
+}
+
+// CheckFencingToken verifies against the db that no other instance took over
+// the leadership since this instance acquired it. It returns ErrNotLeader if
+// this instance must not perform any side effects anymore.
+func (e *Elector) CheckFencingToken(ctx context.Context) error {
+	e.mu.RLock()
+	fencingToken := e.fencingToken
+	e.mu.RUnlock()
+
+	if !e.IsLeader() {
+		return ErrNotLeader
+	}
+
+	if err := e.db.ValidateLeaderLock(ctx, e.owner, fencingToken); err != nil {
+		if db.IsNotFoundError(err) {
+			e.setLeader(false, 0, time.Time{})
+			return ErrNotLeader
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Fence returns the fence for db writes made under the current leadership,
+// which the db rejects once another instance took over. It returns
+// ErrNotLeader if this instance does not hold a lease.
+func (e *Elector) Fence() (*model.LeaderFence, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if !e.isLeader || !time.Now().Before(e.leaseDeadline) {
+		return nil, ErrNotLeader
+	}
+	return &model.LeaderFence{Owner: e.owner, FencingToken: e.fencingToken}, nil
+}
+
+func (e *Elector) campaign(ctx context.Context) {
+	requestedAt := time.Now()
+	lock, err := e.db.AcquireLeaderLock(ctx, e.owner, e.leaseDuration)
+	if err != nil {
+		if !db.IsNotFoundError(err) {
+			log.Error().Err(err).Msg("failed to acquire leader lock")
+			// Keep the leadership until the local lease deadline runs out,
+			// a transient db error should not cause a failover.
+			return
+		}
+		e.setLeader(false, 0, time.Time{})
+		return
+	}
+
+	e.setLeader(true, lock.FencingToken, requestedAt.Add(e.leaseDuration))
+}
+
+func (e *Elector) resign() {
+	if !e.IsLeader() {
+		return
+	}
+	// The parent context may already be cancelled during shutdown.
+	ctx, cancel := context.WithTimeout(context.Background(), resignTimeout)
+	defer cancel()
+	if err := e.db.ReleaseLeaderLock(ctx, e.owner); err != nil {
+		log.Error().Err(err).Msg("failed to release leader lock")
+	}
+	e.setLeader(false, 0, time.Time{})
+}
+
+func (e *Elector) setLeader(isLeader bool, fencingToken int64, leaseDeadline time.Time) {
+	e.mu.Lock()
+	wasLeader := e.isLeader
+	previousToken := e.fencingToken
+	e.isLeader = isLeader
+	e.fencingToken = fencingToken
+	e.leaseDeadline = leaseDeadline
+	e.mu.Unlock()
+
+	switch {
+	case isLeader && !wasLeader:
+		metrics.RecordLeadershipChange(true)
+		log.Info().Str("owner", e.owner).Int64("fencing_token", fencingToken).
+			Msg("acquired leadership")
+	case isLeader && previousToken != fencingToken:
+		log.Info().Str("owner", e.owner).Int64("fencing_token", fencingToken).
+			Msg("re-acquired leadership with a new fencing token")
+	case !isLeader && wasLeader:
+		metrics.RecordLeadershipChange(false)
+		log.Warn().Str("owner", e.owner).Int64("fencing_token", previousToken).
+			Msg("lost leadership")
+	}
+}
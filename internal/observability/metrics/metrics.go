@@ -1,6 +1,8 @@
 package metrics
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"sync"
@@ -26,13 +28,43 @@ func (O Outcome) String() string {
 }
 
 var (
-	once                       sync.Once
-	metricsRouter              *chi.Mux
-	pollDurationHistogram      *prometheus.HistogramVec
-	btcClientDurationHistogram *prometheus.HistogramVec
-	queueSendErrorCounter      prometheus.Counter
+	once                        sync.Once
+	metricsRouter               *chi.Mux
+	pollDurationHistogram       *prometheus.HistogramVec
+	btcClientDurationHistogram  *prometheus.HistogramVec
+	queueSendErrorCounter       prometheus.Counter
+	republishedEventCounter     prometheus.Counter
+	delegationFailureCounter    prometheus.Counter
+	deadLetterCounter           prometheus.Counter
+	isLeaderGauge               prometheus.Gauge
+	leadershipChangeCounter     *prometheus.CounterVec
+	queueCircuitOpenGauge       prometheus.Gauge
+	suppressedDuplicateCounter  prometheus.Counter
+	btcTipCacheCounter          *prometheus.CounterVec
+	btcTipAgeGauge              prometheus.Gauge
+	btcNodeHealthyGauge         *prometheus.GaugeVec
+	spentDelegationCounter      *prometheus.CounterVec
+	expireHeightMismatchCounter *prometheus.CounterVec
+	btcNodeSyncingGauge         prometheus.Gauge
+	btcTipStalledGauge          prometheus.Gauge
+	btcTipSinceChangeGauge      prometheus.Gauge
+	checkpointHeightGauge       prometheus.Gauge
+	checkpointLagGauge          prometheus.Gauge
+	reorgCounter                prometheus.Counter
+	revertedExpiryCounter       *prometheus.CounterVec
+	btcNoNodeAvailableCounter   *prometheus.CounterVec
+
+	// btcSyncState is reported by the health endpoint.
+	btcSyncStateMu sync.RWMutex
+	btcSyncState   BtcSyncState
 )
 
+// BtcSyncState is the sync state of the btc node reported by the health endpoint.
+type BtcSyncState struct {
+	Syncing bool `json:"btc_syncing"`
+	Stalled bool `json:"btc_stalled"`
+}
+
 // Init initializes the metrics package.
 func Init(metricsPort int) {
 	once.Do(func() {
@@ -47,6 +79,7 @@ func initMetricsRouter(metricsPort int) {
 	metricsRouter.Get("/metrics", func(w http.ResponseWriter, r *http.Request) {
 		promhttp.Handler().ServeHTTP(w, r)
 	})
+	metricsRouter.Get("/health", healthHandler)
 
 	go func() {
 		metricsAddr := fmt.Sprintf(":%d", metricsPort)
@@ -72,7 +105,7 @@ func registerMetrics() {
 	btcClientDurationHistogram = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "btcclient_duration_seconds",
-			Help:    "Histogram of btcclient durations in seconds.",
+			Help:    "Histogram of btcclient durations in seconds, by success or the class of the error.",
 			Buckets: defaultHistogramBucketsSeconds,
 		},
 		[]string{"function", "status"},
@@ -86,13 +119,188 @@ func registerMetrics() {
 		},
 	)
 
+	// add a counter for the number of events published again after an interrupted publish
+	republishedEventCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "republished_event_count",
+			Help: "The total number of expired events published more than once for the same timelock document",
+		},
+	)
+
+	delegationFailureCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "delegation_failure_count",
+			Help: "The total number of failed attempts to process a timelock document",
+		},
+	)
+
+	deadLetterCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "dead_letter_count",
+			Help: "The total number of timelock documents moved to the dead letter collection",
+		},
+	)
+
+	isLeaderGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "is_leader",
+			Help: "Whether this instance currently holds the leader lock (1) or not (0).",
+		},
+	)
+
+	leadershipChangeCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "leadership_change_count",
+			Help: "The total number of times this instance acquired or lost the leadership.",
+		},
+		[]string{"status"},
+	)
+
+	queueCircuitOpenGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "queue_circuit_breaker_open",
+			Help: "Whether sending to the queue is paused by the circuit breaker (1) or not (0).",
+		},
+	)
+
+	suppressedDuplicateCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "suppressed_duplicate_count",
+			Help: "The total number of expired events not published because the published event ledger already held them",
+		},
+	)
+
+	btcTipCacheCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "btc_tip_cache_count",
+			Help: "The total number of btc tip height lookups served from the cache (hit) or the node (miss)",
+		},
+		[]string{"result"},
+	)
+
+	btcTipAgeGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "btc_tip_age_seconds",
+			Help: "The age of the most recently served cached btc tip height in seconds.",
+		},
+	)
+
+	btcNodeHealthyGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "btc_node_healthy",
+			Help: "Whether a btc node is used to determine the tip (1) or skipped because it failed or lags behind (0).",
+		},
+		[]string{"node"},
+	)
+
+	spentDelegationCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spent_delegation_count",
+			Help: "The total number of expired delegations not published because their timelocked output was already spent",
+		},
+		[]string{"tx_type"},
+	)
+
+	expireHeightMismatchCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "expire_height_mismatch_count",
+			Help: "The total number of timelock documents quarantined because their expire height does not match the chain",
+		},
+		[]string{"tx_type"},
+	)
+
+	btcNodeSyncingGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "btc_node_syncing",
+			Help: "Whether processing is refused because the btc node is syncing (1) or not (0).",
+		},
+	)
+
+	btcTipStalledGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "btc_tip_stalled",
+			Help: "Whether the btc tip has not advanced within the stall threshold (1) or not (0).",
+		},
+	)
+
+	btcTipSinceChangeGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "btc_tip_seconds_since_change",
+			Help: "The number of seconds since the btc tip last changed.",
+		},
+	)
+
+	checkpointHeightGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "processing_checkpoint_height",
+			Help: "The last btc height up to which all expiries were processed.",
+		},
+	)
+
+	checkpointLagGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "processing_checkpoint_lag_blocks",
+			Help: "The number of confirmed btc blocks beyond the processing checkpoint.",
+		},
+	)
+
+	reorgCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "btc_reorg_count",
+			Help: "The number of reorgs detected below the confirmed btc height.",
+		},
+	)
+
+	revertedExpiryCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "reverted_expiry_count",
+			Help: "The number of published expiries reverted because their height left the best chain.",
+		},
+		[]string{"tx_type"},
+	)
+
+	btcNoNodeAvailableCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "btc_no_node_available_count",
+			Help: "The number of btc requests without a healthy and caught up node, sent to all nodes (fallback) or refused in quorum mode (refused).",
+		},
+		[]string{"action"},
+	)
+
 	prometheus.MustRegister(
 		pollDurationHistogram,
 		btcClientDurationHistogram,
 		queueSendErrorCounter,
+		republishedEventCounter,
+		delegationFailureCounter,
+		deadLetterCounter,
+		isLeaderGauge,
+		leadershipChangeCounter,
+		queueCircuitOpenGauge,
+		suppressedDuplicateCounter,
+		btcTipCacheCounter,
+		btcTipAgeGauge,
+		btcNodeHealthyGauge,
+		spentDelegationCounter,
+		expireHeightMismatchCounter,
+		btcNodeSyncingGauge,
+		btcTipStalledGauge,
+		btcTipSinceChangeGauge,
+		checkpointHeightGauge,
+		checkpointLagGauge,
+		reorgCounter,
+		revertedExpiryCounter,
+		btcNoNodeAvailableCounter,
 	)
 }
 
+// classifiedError is implemented by errors telling the class of a failed
+// request, e.g. transient, which labels the outcome instead of a plain error.
+type classifiedError interface {
+	error
+	ErrorClass() string
+}
+
 func RecordBtcClientMetrics[T any](clientRequest func() (T, error)) (T, error) {
 	var result T
 	functionName := utils.GetFunctionName(1)
@@ -101,21 +309,157 @@ func RecordBtcClientMetrics[T any](clientRequest func() (T, error)) (T, error) {
 
 	// Perform the client request
 	result, err := clientRequest()
-	// Determine the outcome status based on whether an error occurred
-	status := Success
+	// Determine the outcome status based on whether and how the request failed
+	status := Success.String()
 	if err != nil {
-		status = Error
+		status = Error.String()
+		var classified classifiedError
+		if errors.As(err, &classified) {
+			status = classified.ErrorClass()
+		}
 	}
 
 	// Calculate the duration
 	duration := time.Since(start).Seconds()
 
 	// Use WithLabelValues to specify the labels and call Observe to record the duration
-	btcClientDurationHistogram.WithLabelValues(functionName, status.String()).Observe(duration)
+	btcClientDurationHistogram.WithLabelValues(functionName, status).Observe(duration)
 
 	return result, err
 }
 
+// RecordBtcTipCacheHit records a tip height served from the cache, with the age of the cached value.
+func RecordBtcTipCacheHit(age time.Duration) {
+	btcTipCacheCounter.WithLabelValues("hit").Inc()
+	btcTipAgeGauge.Set(age.Seconds())
+}
+
+// RecordBtcTipCacheMiss records a tip height lookup that had to query the node.
+func RecordBtcTipCacheMiss() {
+	btcTipCacheCounter.WithLabelValues("miss").Inc()
+	btcTipAgeGauge.Set(0)
+}
+
+// RecordBtcNodeHealth records whether a btc node is used or skipped.
+func RecordBtcNodeHealth(node string, healthy bool) {
+	value := 0.0
+	if healthy {
+		value = 1
+	}
+	btcNodeHealthyGauge.WithLabelValues(node).Set(value)
+}
+
+// RecordBtcNoNodeAvailable records a btc request for which no node was
+// available, which was either sent to all nodes or refused.
+func RecordBtcNoNodeAvailable(refused bool) {
+	action := "fallback"
+	if refused {
+		action = "refused"
+	}
+	btcNoNodeAvailableCounter.WithLabelValues(action).Inc()
+}
+
 func RecordQueueSendError() {
 	queueSendErrorCounter.Inc()
 }
+
+func RecordRepublishedEvent() {
+	republishedEventCounter.Inc()
+}
+
+func RecordDelegationFailure() {
+	delegationFailureCounter.Inc()
+}
+
+func RecordDeadLetter() {
+	deadLetterCounter.Inc()
+}
+
+func RecordSuppressedDuplicate() {
+	suppressedDuplicateCounter.Inc()
+}
+
+// RecordSpentDelegation records an expired delegation whose timelocked output was already spent.
+func RecordSpentDelegation(txType string) {
+	spentDelegationCounter.WithLabelValues(txType).Inc()
+}
+
+// RecordExpireHeightMismatch records a timelock document quarantined because its expire height does not match the chain.
+func RecordExpireHeightMismatch(txType string) {
+	expireHeightMismatchCounter.WithLabelValues(txType).Inc()
+}
+
+// RecordBtcSyncState records whether the btc node is syncing and whether its
+// tip stalled, both also reported by the health endpoint.
+func RecordBtcSyncState(syncing, stalled bool, sinceChange time.Duration) {
+	btcNodeSyncingGauge.Set(boolToFloat(syncing))
+	btcTipStalledGauge.Set(boolToFloat(stalled))
+	btcTipSinceChangeGauge.Set(sinceChange.Seconds())
+
+	btcSyncStateMu.Lock()
+	defer btcSyncStateMu.Unlock()
+	btcSyncState = BtcSyncState{Syncing: syncing, Stalled: stalled}
+}
+
+// healthHandler reports the service as unavailable while the btc node is
+// syncing or its tip stalled.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	btcSyncStateMu.RLock()
+	state := btcSyncState
+	btcSyncStateMu.RUnlock()
+
+	status := http.StatusOK
+	if state.Syncing || state.Stalled {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(state); err != nil {
+		log.Error().Err(err).Msg("failed to write health status")
+	}
+}
+
+func boolToFloat(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// RecordLeadershipChange records this instance acquiring or losing the leadership.
+func RecordLeadershipChange(isLeader bool) {
+	status := "lost"
+	isLeaderValue := 0.0
+	if isLeader {
+		status = "acquired"
+		isLeaderValue = 1
+	}
+	isLeaderGauge.Set(isLeaderValue)
+	leadershipChangeCounter.WithLabelValues(status).Inc()
+}
+
+// RecordQueueCircuitBreakerState records the circuit breaker opening or closing.
+func RecordQueueCircuitBreakerState(open bool) {
+	value := 0.0
+	if open {
+		value = 1
+	}
+	queueCircuitOpenGauge.Set(value)
+}
+
+// RecordProcessingCheckpoint records the processing checkpoint and how many
+// confirmed blocks it lags behind.
+func RecordProcessingCheckpoint(height, lag uint64) {
+	checkpointHeightGauge.Set(float64(height))
+	checkpointLagGauge.Set(float64(lag))
+}
+
+// RecordReorg records a reorg of blocks below the confirmed btc height.
+func RecordReorg() {
+	reorgCounter.Inc()
+}
+
+// RecordRevertedExpiry records a published expiry being reverted by a reorg.
+func RecordRevertedExpiry(txType string) {
+	revertedExpiryCounter.WithLabelValues(txType).Inc()
+}
@@ -6,32 +6,73 @@ import (
 
 	"github.com/rs/zerolog/log"
 
+	"github.com/babylonchain/staking-expiry-checker/internal/btcclient"
+	"github.com/babylonchain/staking-expiry-checker/internal/leader"
 	"github.com/babylonchain/staking-expiry-checker/internal/services"
 )
 
 type Poller struct {
-	service  *services.Service
-	interval time.Duration
-	quit     chan struct{}
+	service       *services.Service
+	elector       *leader.Elector
+	blockNotifier btcclient.BlockNotifier
+	interval      time.Duration
+	quit          chan struct{}
 }
 
-func NewPoller(interval time.Duration, service *services.Service) (*Poller, error) {
+// NewPoller creates a poller for the service. When an elector is given, the
+// poller only processes expired delegations while it holds the leadership.
+// When a block notifier is given, the poller also polls as soon as a new
+// block arrives, the interval then only serves as a fallback.
+func NewPoller(
+	interval time.Duration, service *services.Service, elector *leader.Elector,
+	blockNotifier btcclient.BlockNotifier,
+) (*Poller, error) {
 	return &Poller{
-		service:  service,
-		interval: interval,
-		quit:     make(chan struct{}),
+		service:       service,
+		elector:       elector,
+		blockNotifier: blockNotifier,
+		interval:      interval,
+		quit:          make(chan struct{}),
 	}, nil
 }
 
 func (p *Poller) Start(ctx context.Context) {
 	ticker := time.NewTicker(p.interval)
 
+	// Stopping the poller aborts the poll in flight, including its btc requests.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-p.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if p.elector != nil {
+		go p.elector.Start(ctx)
+	}
+
+	// Receiving from a nil channel blocks forever, which disables the trigger.
+	var newBlocks <-chan struct{}
+	if p.blockNotifier != nil {
+		go p.blockNotifier.Start(ctx)
+		newBlocks = p.blockNotifier.Notifications()
+	}
+
 	for {
 		select {
 		case <-ticker.C:
 			if err := p.poll(ctx); err != nil {
 				log.Error().Err(err).Msg("Error polling")
 			}
+		case <-newBlocks:
+			// The cached tip predates the notified block.
+			p.service.InvalidateTip()
+			if err := p.poll(ctx); err != nil {
+				log.Error().Err(err).Msg("Error polling on new block")
+			}
 		case <-ctx.Done():
 			// Handle context cancellation.
 			log.Info().Msg("Poller stopped due to context cancellation")
@@ -45,9 +86,19 @@ func (p *Poller) Start(ctx context.Context) {
 
 func (p *Poller) Stop() {
 	close(p.quit)
+	if p.elector != nil {
+		p.elector.Stop()
+	}
+	if p.blockNotifier != nil {
+		p.blockNotifier.Stop()
+	}
 }
 
 func (p *Poller) poll(ctx context.Context) error {
+	if p.elector != nil && !p.elector.IsLeader() {
+		log.Debug().Msg("not the leader, skipping poll")
+		return nil
+	}
 	if err := p.service.ProcessExpiredDelegations(ctx); err != nil {
 		log.Error().Err(err).Msg("Error processing expired delegations")
 		return err
@@ -0,0 +1,88 @@
+package queue
+
+import (
+	"sync"
+	"time"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/observability/metrics"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// CircuitBreaker pauses sending once too many consecutive sends failed.
+// After the cooldown a single trial send is let through, its outcome decides
+// whether sending resumes or stays paused for another cooldown.
+type CircuitBreaker struct {
+	failureThreshold int
+	cooldown         time.Duration
+
+	mu                  sync.Mutex
+	state               breakerState
+	consecutiveFailures int
+	openedAt            time.Time
+}
+
+func NewCircuitBreaker(failureThreshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+	}
+}
+
+// Allow reports whether a send may be attempted now.
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		// Only the trial send is allowed until its outcome is recorded.
+		return false
+	default:
+		return true
+	}
+}
+
+// IsOpen reports whether sending is currently paused.
+func (b *CircuitBreaker) IsOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state == breakerOpen && time.Since(b.openedAt) < b.cooldown
+}
+
+func (b *CircuitBreaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != breakerClosed {
+		metrics.RecordQueueCircuitBreakerState(false)
+	}
+	b.state = breakerClosed
+	b.consecutiveFailures = 0
+}
+
+func (b *CircuitBreaker) RecordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.consecutiveFailures++
+	if b.state == breakerHalfOpen || b.consecutiveFailures >= b.failureThreshold {
+		if b.state == breakerClosed {
+			metrics.RecordQueueCircuitBreakerState(true)
+		}
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
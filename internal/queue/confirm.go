@@ -0,0 +1,140 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/rs/zerolog/log"
+
+	"github.com/babylonchain/staking-queue-client/client"
+	queueConfig "github.com/babylonchain/staking-queue-client/config"
+)
+
+// ConfirmingQueueClient publishes messages on a channel in confirm mode and
+// only reports a send as successful once the broker acknowledged that it took
+// responsibility for the message. All other operations, including declaring
+// the queue, are left to the wrapped queue client.
+type ConfirmingQueueClient struct {
+	client.QueueClient
+
+	amqpURI        string
+	confirmTimeout time.Duration
+
+	mu      sync.Mutex
+	conn    *amqp091.Connection
+	channel *amqp091.Channel
+}
+
+// NewConfirmingQueueClient wraps the queue client of the queue with the given
+// name. The queue must have been declared by the wrapped client already.
+func NewConfirmingQueueClient(
+	cfg *queueConfig.QueueConfig, queueClient client.QueueClient, confirmTimeout time.Duration,
+) (*ConfirmingQueueClient, error) {
+	c := &ConfirmingQueueClient{
+		QueueClient:    queueClient,
+		amqpURI:        fmt.Sprintf("amqp://%s:%s@%s", cfg.QueueUser, cfg.QueuePassword, cfg.Url),
+		confirmTimeout: confirmTimeout,
+	}
+	if _, err := c.confirmChannel(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// SendMessage publishes the message and waits for the broker to confirm it.
+// ErrPublishNacked is returned if the broker rejected the message,
+// ErrConfirmTimeout if no confirmation arrived within the confirm timeout and
+// ErrConfirmLost if the channel closed before, in which latter cases the
+// message may or may not have been stored.
+func (c *ConfirmingQueueClient) SendMessage(ctx context.Context, messageBody string) error {
+	channel, err := c.confirmChannel()
+	if err != nil {
+		return err
+	}
+
+	confirmation, err := channel.PublishWithDeferredConfirmWithContext(
+		ctx, "", c.GetQueueName(), false, false,
+		amqp091.Publishing{
+			DeliveryMode: amqp091.Persistent,
+			ContentType:  "text/plain",
+			Body:         []byte(messageBody),
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+
+	confirmCtx, cancel := context.WithTimeout(ctx, c.confirmTimeout)
+	defer cancel()
+	acked, err := confirmation.WaitContext(confirmCtx)
+	if err != nil {
+		if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+			return ErrConfirmTimeout
+		}
+		return err
+	}
+	if !acked {
+		// Pending confirmations are nacked when the channel or its
+		// connection closes, which says nothing about the message.
+		if channel.IsClosed() {
+			return ErrConfirmLost
+		}
+		return ErrPublishNacked
+	}
+
+	return nil
+}
+
+// confirmChannel returns the channel in confirm mode, opening a new
+// connection if the previous one was closed, e.g. by a broker restart.
+func (c *ConfirmingQueueClient) confirmChannel() (*amqp091.Channel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.channel != nil && !c.channel.IsClosed() {
+		return c.channel, nil
+	}
+	c.closeConnection()
+
+	conn, err := amqp091.Dial(c.amqpURI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the queue: %w", err)
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open a channel: %w", err)
+	}
+	if err := channel.Confirm(false); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to put the channel into confirm mode: %w", err)
+	}
+
+	c.conn = conn
+	c.channel = channel
+	return channel, nil
+}
+
+func (c *ConfirmingQueueClient) closeConnection() {
+	if c.conn != nil && !c.conn.IsClosed() {
+		if err := c.conn.Close(); err != nil {
+			log.Warn().Err(err).Msg("failed to close the queue connection")
+		}
+	}
+	c.conn = nil
+	c.channel = nil
+}
+
+// Stop closes the confirm connection and stops the wrapped queue client.
+func (c *ConfirmingQueueClient) Stop() error {
+	c.mu.Lock()
+	c.closeConnection()
+	c.mu.Unlock()
+
+	return c.QueueClient.Stop()
+}
@@ -0,0 +1,48 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrCircuitOpen is returned while sending is paused because the queue is unhealthy.
+var ErrCircuitOpen = errors.New("queue circuit breaker is open")
+
+// ErrPublishNacked is returned when the broker refused to store a message.
+var ErrPublishNacked = errors.New("message was nacked by the broker")
+
+// ErrConfirmTimeout is returned when the broker did not confirm a message in
+// time. The message may still have been stored.
+var ErrConfirmTimeout = errors.New("timed out waiting for the broker to confirm the message")
+
+// ErrConfirmLost is returned when the channel or its connection closed while
+// waiting for the broker to confirm a message. The message may still have
+// been stored.
+var ErrConfirmLost = errors.New("channel closed before the broker confirmed the message")
+
+// ErrNoExpiryRevertedQueue is returned when sending an expiry reverted event
+// without a queue for them.
+var ErrNoExpiryRevertedQueue = errors.New("no queue for expiry reverted events")
+
+// SendError is returned when an event could not be sent to the queue,
+// either after exhausting all retries or because the circuit breaker opened.
+// MaybePublished is set if any attempt timed out or lost the channel waiting
+// for the broker confirmation, so the event could have reached the queue
+// nonetheless.
+type SendError struct {
+	StakingTxHashHex string
+	Attempts         int
+	MaybePublished   bool
+	Err              error
+}
+
+func (e *SendError) Error() string {
+	return fmt.Sprintf(
+		"failed to send event for %s after %d attempts: %v",
+		e.StakingTxHashHex, e.Attempts, e.Err,
+	)
+}
+
+func (e *SendError) Unwrap() error {
+	return e.Err
+}
@@ -3,10 +3,14 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
 	"github.com/babylonchain/staking-expiry-checker/internal/observability/metrics"
 	"github.com/babylonchain/staking-queue-client/client"
 	queueConfig "github.com/babylonchain/staking-queue-client/config"
@@ -14,35 +18,156 @@ import (
 
 type QueueManager struct {
 	stakingExpiredEventQueue client.QueueClient
+	// expiryRevertedEventQueue is only set when reverted expiries are published.
+	expiryRevertedEventQueue client.QueueClient
+	cfg                      *config.PublisherConfig
+	breaker                  *CircuitBreaker
 }
 
-func NewQueueManager(cfg *queueConfig.QueueConfig) (*QueueManager, error) {
-	stakingEventQueue, err := client.NewQueueClient(cfg, client.ExpiredStakingQueueName)
+func NewQueueManager(cfg *queueConfig.QueueConfig, publisherCfg *config.PublisherConfig) (*QueueManager, error) {
+	stakingEventQueue, err := NewConfirmingQueue(cfg, client.ExpiredStakingQueueName, publisherCfg.ConfirmTimeout)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize staking event queue: %w", err)
 	}
 
+	return NewQueueManagerWithClient(stakingEventQueue, publisherCfg), nil
+}
+
+// NewConfirmingQueue declares the queue with the given name and returns a
+// client publishing to it with broker confirmations.
+func NewConfirmingQueue(
+	cfg *queueConfig.QueueConfig, queueName string, confirmTimeout time.Duration,
+) (client.QueueClient, error) {
+	queueClient, err := client.NewQueueClient(cfg, queueName)
+	if err != nil {
+		return nil, err
+	}
+	confirmingQueue, err := NewConfirmingQueueClient(cfg, queueClient, confirmTimeout)
+	if err != nil {
+		queueClient.Stop()
+		return nil, fmt.Errorf("failed to initialize confirming queue %s: %w", queueName, err)
+	}
+	return confirmingQueue, nil
+}
+
+// NewQueueManagerWithClient creates a QueueManager publishing through the given queue client.
+func NewQueueManagerWithClient(queueClient client.QueueClient, publisherCfg *config.PublisherConfig) *QueueManager {
 	return &QueueManager{
-		stakingExpiredEventQueue: stakingEventQueue,
-	}, nil
+		stakingExpiredEventQueue: queueClient,
+		cfg:                      publisherCfg,
+		breaker:                  NewCircuitBreaker(publisherCfg.BreakerFailureThreshold, publisherCfg.BreakerCooldown),
+	}
 }
 
+// SetExpiryRevertedQueue sets the queue client the expiry reverted events are
+// published through. The queue manager stops it on shutdown.
+func (qm *QueueManager) SetExpiryRevertedQueue(queueClient client.QueueClient) {
+	qm.expiryRevertedEventQueue = queueClient
+}
+
+// SendExpiredStakingEvent sends the event to the queue, retrying failed sends
+// with exponential backoff and jitter. A send only succeeds once the broker
+// confirmed the message, a nack, a confirm timeout or a lost channel counts as failed send. It returns a *SendError once all retries
+// are exhausted, or wrapping ErrCircuitOpen while the queue is unhealthy.
 func (qm *QueueManager) SendExpiredStakingEvent(ctx context.Context, ev client.ExpiredStakingEvent) error {
 	jsonBytes, err := json.Marshal(ev)
 	if err != nil {
 		return err
 	}
-	messageBody := string(jsonBytes)
+	return qm.send(ctx, qm.stakingExpiredEventQueue, "expired staking event", ev.StakingTxHashHex, string(jsonBytes))
+}
 
-	log.Debug().Str("tx_hash", ev.StakingTxHashHex).Msg("publishing expired staking event")
-	err = qm.stakingExpiredEventQueue.SendMessage(ctx, messageBody)
+// SendExpiryRevertedEvent sends the event to the expiry reverted queue, retrying
+// like SendExpiredStakingEvent. ErrNoExpiryRevertedQueue is returned if the
+// queue was not set.
+func (qm *QueueManager) SendExpiryRevertedEvent(ctx context.Context, ev ExpiryRevertedEvent) error {
+	if qm.expiryRevertedEventQueue == nil {
+		return ErrNoExpiryRevertedQueue
+	}
+	jsonBytes, err := json.Marshal(ev)
 	if err != nil {
+		return err
+	}
+	return qm.send(ctx, qm.expiryRevertedEventQueue, "expiry reverted event", ev.StakingTxHashHex, string(jsonBytes))
+}
+
+func (qm *QueueManager) send(
+	ctx context.Context, queueClient client.QueueClient, eventName, stakingTxHashHex, messageBody string,
+) error {
+	var lastErr error
+	attempts := 0
+	maybePublished := false
+	for attempt := 0; attempt <= qm.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			if err := sleepWithContext(ctx, qm.backoff(attempt)); err != nil {
+				lastErr = err
+				break
+			}
+		}
+		if !qm.breaker.Allow() {
+			lastErr = ErrCircuitOpen
+			break
+		}
+
+		attempts++
+		log.Debug().Str("tx_hash", stakingTxHashHex).Int("attempt", attempts).
+			Msg("publishing " + eventName)
+		err := queueClient.SendMessage(ctx, messageBody)
+		if err == nil {
+			qm.breaker.RecordSuccess()
+			log.Debug().Str("tx_hash", stakingTxHashHex).Msg("successfully published " + eventName)
+			return nil
+		}
+
+		if errors.Is(err, ErrConfirmTimeout) || errors.Is(err, ErrConfirmLost) {
+			maybePublished = true
+		}
+		qm.breaker.RecordFailure()
 		metrics.RecordQueueSendError()
-		log.Fatal().Err(err).Str("tx_hash", ev.StakingTxHashHex).Msg("failed to publish staking event")
+		log.Warn().Err(err).Str("tx_hash", stakingTxHashHex).Int("attempt", attempts).
+			Msg("failed to publish " + eventName)
+		lastErr = err
+	}
+
+	return &SendError{
+		StakingTxHashHex: stakingTxHashHex,
+		Attempts:         attempts,
+		MaybePublished:   maybePublished,
+		Err:              lastErr,
+	}
+}
+
+// IsCircuitOpen reports whether sending is paused because the queue is unhealthy.
+func (qm *QueueManager) IsCircuitOpen() bool {
+	return qm.breaker.IsOpen()
+}
+
+// backoff returns the delay before the given retry attempt: the initial
+// backoff doubled for every previous retry, capped at the max backoff, of
+// which a random half is kept to spread retries of concurrent senders.
+func (qm *QueueManager) backoff(attempt int) time.Duration {
+	delay := qm.cfg.InitialBackoff
+	for i := 1; i < attempt && delay < qm.cfg.MaxBackoff; i++ {
+		delay *= 2
 	}
-	log.Debug().Str("tx_hash", ev.StakingTxHashHex).Msg("successfully published expired staking event")
+	if delay > qm.cfg.MaxBackoff {
+		delay = qm.cfg.MaxBackoff
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
 
-	return nil
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // Shutdown gracefully stops the interaction with the queue, ensuring all resources are properly released.
@@ -51,5 +176,10 @@ func (qm *QueueManager) Shutdown() {
 	if err != nil {
 		log.Error().Err(err).Msg("failed to stop staking expired event queue")
 	}
+	if qm.expiryRevertedEventQueue != nil {
+		if err := qm.expiryRevertedEventQueue.Stop(); err != nil {
+			log.Error().Err(err).Msg("failed to stop expiry reverted event queue")
+		}
+	}
 
 }
@@ -0,0 +1,12 @@
+package queue
+
+// ExpiryRevertedEvent tells consumers that the expired staking event of the
+// staking tx was published for a height that left the best chain in a reorg.
+// The expiry is published again once its height is confirmed in the new chain.
+type ExpiryRevertedEvent struct {
+	StakingTxHashHex string `json:"staking_tx_hash_hex"`
+	TxType           string `json:"tx_type"`
+	ExpireHeight     uint64 `json:"expire_height"`
+	// ForkHeight is the lowest height replaced by the reorg.
+	ForkHeight uint64 `json:"fork_height"`
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/btcclient"
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/db"
+	"github.com/babylonchain/staking-expiry-checker/internal/db/model"
+	"github.com/babylonchain/staking-expiry-checker/internal/observability/metrics"
+	"github.com/babylonchain/staking-expiry-checker/internal/queue"
+)
+
+// trackReorgs compares the kept hashes of recent blocks with the best chain
+// and reverts the expiries published for heights that left it. The hashes of
+// the confirmed heights are kept before any expiry is published for them, so
+// that every published expiry can be checked against later reorgs.
+func (s *Service) trackReorgs(ctx context.Context, btcTip int64, confirmedHeight uint64) error {
+	blocks, err := s.db.ListRecentBlocks(ctx)
+	if err != nil {
+		return err
+	}
+
+	forkHeight, reorged, err := s.findForkHeight(ctx, blocks, btcTip)
+	if err != nil {
+		return err
+	}
+	if reorged {
+		if err := s.revertExpiries(ctx, forkHeight); err != nil {
+			return err
+		}
+		// Only the blocks below the fork are still in the best chain.
+		for len(blocks) > 0 && blocks[0].Height >= forkHeight {
+			blocks = blocks[1:]
+		}
+	}
+
+	return s.recordRecentBlocks(ctx, blocks, confirmedHeight)
+}
+
+// findForkHeight returns the lowest height at which the kept blocks, highest
+// first, differ from the best chain. As every block commits to its parent, the
+// kept blocks are in the best chain as soon as the highest one is.
+func (s *Service) findForkHeight(ctx context.Context, blocks []model.RecentBlockDocument, btcTip int64) (uint64, bool, error) {
+	mismatched := false
+	for _, block := range blocks {
+		// A lagging node does not know the block yet, only a different
+		// hash at the height tells that it left the best chain.
+		if int64(block.Height) > btcTip {
+			continue
+		}
+		hash, err := s.btc.GetBlockHash(ctx, int64(block.Height))
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to get block hash at height %d: %w", block.Height, err)
+		}
+		if hash.String() == block.Hash {
+			if !mismatched {
+				return 0, false, nil
+			}
+			return block.Height + 1, true, nil
+		}
+		mismatched = true
+	}
+	if !mismatched {
+		return 0, false, nil
+	}
+
+	oldest := blocks[len(blocks)-1].Height
+	log.Error().Uint64("oldest_kept_height", oldest).
+		Msg("reorg is deeper than the kept blocks, reverting the expiries from the oldest kept height")
+	return oldest, true, nil
+}
+
+// revertExpiries queues the delegations whose expiry was published for a
+// height at or above the fork height again, reporting every reverted expiry,
+// and rolls the processing checkpoint back below the fork.
+func (s *Service) revertExpiries(ctx context.Context, forkHeight uint64) error {
+	metrics.RecordReorg()
+	log.Warn().Uint64("fork_height", forkHeight).Msg("detected a reorg of processed blocks")
+
+	if err := s.checkLeadership(ctx); err != nil {
+		return err
+	}
+	// The writes are fenced, a stale leader that passed the leadership check
+	// is rejected by the db once another instance took over.
+	fence, err := s.fence()
+	if err != nil {
+		return err
+	}
+	expiries, err := s.db.FindPublishedExpiries(ctx, forkHeight)
+	if err != nil {
+		return err
+	}
+
+	for _, expiry := range expiries {
+		// Reported first, a failed revert is retried along with the report
+		// on the next run rather than the report getting lost.
+		if err := s.reportRevertedExpiry(ctx, expiry, forkHeight); err != nil {
+			return err
+		}
+		if err := s.checkLeadership(ctx); err != nil {
+			return err
+		}
+		if err := s.db.RevertExpiredDelegation(ctx, expiry.ID, forkHeight, fence); err != nil {
+			if db.IsNotFoundError(err) {
+				// Reverted concurrently by another instance.
+				continue
+			}
+			return err
+		}
+		metrics.RecordRevertedExpiry(expiry.TxType)
+	}
+
+	var checkpointHeight uint64
+	var checkpointHash string
+	if forkHeight > 0 {
+		checkpointHeight = forkHeight - 1
+		hash, err := s.btc.GetBlockHash(ctx, int64(checkpointHeight))
+		switch {
+		case err == nil:
+			checkpointHash = hash.String()
+		case !errors.Is(err, btcclient.ErrUnsupported):
+			return fmt.Errorf("failed to get block hash at height %d: %w", checkpointHeight, err)
+		}
+	}
+	if err := s.db.RollbackProcessingCheckpoint(ctx, checkpointHeight, checkpointHash, fence); err != nil {
+		return err
+	}
+	if err := s.db.DeleteRecentBlocks(ctx, forkHeight, fence); err != nil {
+		return err
+	}
+
+	log.Warn().Uint64("fork_height", forkHeight).Int("reverted", len(expiries)).
+		Msg("reverted the expiries of reorged blocks")
+	return nil
+}
+
+// reportRevertedExpiry publishes the expiry reverted event or raises an
+// alert, as configured.
+func (s *Service) reportRevertedExpiry(
+	ctx context.Context, expiry model.ExpiredHistoryDocument, forkHeight uint64,
+) error {
+	if s.cfg.Reorg.Compensation == config.ReorgCompensationAlert {
+		log.Error().Str("staking_tx_hash_hex", expiry.StakingTxHashHex).Str("tx_type", expiry.TxType).
+			Uint64("expire_height", expiry.ExpireHeight).Uint64("fork_height", forkHeight).
+			Msg("published expiry was reverted by a reorg, the downstream state must be repaired")
+		return nil
+	}
+
+	return s.queueManager.SendExpiryRevertedEvent(ctx, queue.ExpiryRevertedEvent{
+		StakingTxHashHex: expiry.StakingTxHashHex,
+		TxType:           expiry.TxType,
+		ExpireHeight:     expiry.ExpireHeight,
+		ForkHeight:       forkHeight,
+	})
+}
+
+// recordRecentBlocks keeps the hashes of the confirmed heights above the kept
+// blocks, highest first, within the configured window.
+func (s *Service) recordRecentBlocks(
+	ctx context.Context, blocks []model.RecentBlockDocument, confirmedHeight uint64,
+) error {
+	var keepFromHeight uint64
+	if confirmedHeight >= s.cfg.Reorg.Window {
+		keepFromHeight = confirmedHeight - s.cfg.Reorg.Window + 1
+	}
+	fromHeight := keepFromHeight
+	if len(blocks) > 0 && blocks[0].Height+1 > fromHeight {
+		fromHeight = blocks[0].Height + 1
+	}
+
+	var newBlocks []model.RecentBlockDocument
+	for height := fromHeight; height <= confirmedHeight; height++ {
+		hash, err := s.btc.GetBlockHash(ctx, int64(height))
+		if err != nil {
+			return fmt.Errorf("failed to get block hash at height %d: %w", height, err)
+		}
+		newBlocks = append(newBlocks, model.RecentBlockDocument{Height: height, Hash: hash.String()})
+	}
+	if len(newBlocks) == 0 {
+		return nil
+	}
+
+	fence, err := s.fence()
+	if err != nil {
+		return err
+	}
+	return s.db.SaveRecentBlocks(ctx, newBlocks, keepFromHeight, fence)
+}
@@ -2,55 +2,708 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/babylonchain/staking-expiry-checker/internal/btcclient"
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
 	"github.com/babylonchain/staking-expiry-checker/internal/db"
+	"github.com/babylonchain/staking-expiry-checker/internal/db/model"
+	"github.com/babylonchain/staking-expiry-checker/internal/leader"
+	"github.com/babylonchain/staking-expiry-checker/internal/observability/metrics"
 	"github.com/babylonchain/staking-expiry-checker/internal/queue"
+	"github.com/babylonchain/staking-expiry-checker/internal/staking"
 	queueclient "github.com/babylonchain/staking-queue-client/client"
 )
 
+// releaseTimeout bounds handing back a claimed document after the batch was aborted.
+const releaseTimeout = 5 * time.Second
+
 type Service struct {
+	cfg          *config.Config
+	instanceID   string
 	db           db.DbInterface
 	btc          btcclient.BtcInterface
 	queueManager *queue.QueueManager
+	elector      *leader.Elector
+	syncMonitor  *btcclient.SyncMonitor
 }
 
-func NewService(db db.DbInterface, btc btcclient.BtcInterface, qm *queue.QueueManager) *Service {
+// NewService creates the expiry processing service. The instanceID identifies
+// this process as the owner of the timelock documents it claims. When an
+// elector is given, every publish and archive is fenced by its leadership.
+func NewService(
+	cfg *config.Config, instanceID string, db db.DbInterface, btc btcclient.BtcInterface,
+	qm *queue.QueueManager, elector *leader.Elector,
+) *Service {
 	return &Service{
+		cfg:          cfg,
+		instanceID:   instanceID,
 		db:           db,
 		btc:          btc,
 		queueManager: qm,
+		elector:      elector,
+		syncMonitor:  btcclient.NewSyncMonitor(btc, &cfg.Btc),
+	}
+}
+
+// InvalidateTip drops the cached tip height when the btc client caches it, so
+// that the next processing sees a block that was just notified.
+func (s *Service) InvalidateTip() {
+	if cache, ok := s.btc.(*btcclient.CachedBtcClient); ok {
+		cache.Invalidate()
 	}
 }
 
 func (s *Service) ProcessExpiredDelegations(ctx context.Context) error {
-	// TODO: Use cache with ttl to store the tip height.
-	btcTip, err := s.btc.GetBlockCount()
+	btcTip, err := s.btc.GetBlockCount(ctx)
+	if err != nil {
+		return err
+	}
+	// The tip of a syncing node is far behind, expiries would be delayed
+	// without any sign of a problem.
+	if err := s.syncMonitor.Check(ctx, btcTip); err != nil {
+		return err
+	}
+
+	// Only heights buried under the confirmation depth are considered final,
+	// so that a reorg at the tip can not trigger an expiry that gets reverted.
+	confirmationDepth := s.cfg.Btc.GetConfirmationDepth()
+	if btcTip < 0 || uint64(btcTip) < confirmationDepth {
+		log.Debug().Int64("btc_tip", btcTip).Uint64("confirmation_depth", confirmationDepth).
+			Msg("btc tip is below the confirmation depth, skipping")
+		return nil
+	}
+	confirmedHeight := uint64(btcTip) - confirmationDepth
+
+	// Nothing can be published while the queue is unhealthy, claiming
+	// documents now would only delay other replicas picking them up.
+	if s.queueManager.IsCircuitOpen() {
+		return fmt.Errorf("skipping expired delegations: %w", queue.ErrCircuitOpen)
+	}
+
+	// Archive documents whose event was published but whose archiving failed earlier.
+	fence, err := s.fence()
+	if err != nil {
+		return err
+	}
+	if archived, err := s.db.ArchivePublishedDelegations(ctx, fence); err != nil {
+		if errors.Is(err, db.ErrFenced) {
+			return err
+		}
+		log.Error().Err(err).Msg("failed to archive published delegations")
+	} else if archived > 0 {
+		log.Info().Int64("count", archived).Msg("archived leftover published delegations")
+	}
+
+	if s.cfg.Reorg.Enabled {
+		if err := s.trackReorgs(ctx, btcTip, confirmedHeight); err != nil {
+			return err
+		}
+	}
+
+	checkpointHeight, err := s.checkpointHeight(ctx)
 	if err != nil {
 		return err
 	}
 
+	// Documents expiring at or below the checkpoint were added late, they do
+	// not hold back the checkpoint.
+	if checkpointHeight > 0 {
+		if err := s.processExpiredUpTo(ctx, min(checkpointHeight, confirmedHeight), btcTip); err != nil {
+			return err
+		}
+	}
+
+	// Heights are processed in order, jumping to the next height at which
+	// delegations expire. The checkpoint advances as long as every delegation
+	// up to the height is done. Later heights are still processed if one is
+	// not, e.g. because a delegation failed and awaits a retry.
+	processedHeight := checkpointHeight
+	advancing := true
+	for processedHeight < confirmedHeight {
+		height, err := s.db.NextExpireHeight(ctx, processedHeight)
+		if err != nil && !db.IsNotFoundError(err) {
+			return err
+		}
+		if db.IsNotFoundError(err) || height > confirmedHeight {
+			height = confirmedHeight
+		}
+
+		if err := s.processExpiredUpTo(ctx, height, btcTip); err != nil {
+			return err
+		}
+		processedHeight = height
+
+		if !advancing {
+			continue
+		}
+		remaining, err := s.db.CountExpiredDelegations(ctx, height)
+		if err != nil {
+			return err
+		}
+		if remaining > 0 {
+			log.Debug().Uint64("height", height).Int64("remaining", remaining).
+				Msg("delegations at the height are not done, holding the checkpoint")
+			advancing = false
+			continue
+		}
+		if err := s.saveCheckpoint(ctx, height); err != nil {
+			return err
+		}
+		checkpointHeight = height
+	}
+
+	metrics.RecordProcessingCheckpoint(checkpointHeight, checkpointLag(checkpointHeight, confirmedHeight))
+	return nil
+}
+
+// processExpiredUpTo publishes the delegations expiring at or below the
+// height, until none is left to claim.
+func (s *Service) processExpiredUpTo(ctx context.Context, height uint64, btcTip int64) error {
 	for {
-		expiredDelegations, err := s.db.FindExpiredDelegations(ctx, uint64(btcTip))
+		// Claimed documents are leased to this instance, so that other
+		// replicas working on the same queue do not publish them as well.
+		expiredDelegations, err := s.db.ClaimExpiredDelegations(
+			ctx, height, s.instanceID, s.cfg.Poller.LeaseDuration, s.cfg.Poller.BatchSize,
+		)
 		if err != nil {
 			return err
 		}
 		if len(expiredDelegations) == 0 {
+			return nil
+		}
+
+		if err := s.publishExpiredDelegations(ctx, expiredDelegations, uint64(btcTip)); err != nil {
+			return err
+		}
+	}
+}
+
+// checkpointHeight returns the height of the processing checkpoint, or 0 if
+// nothing was processed yet.
+func (s *Service) checkpointHeight(ctx context.Context) (uint64, error) {
+	checkpoint, err := s.db.GetProcessingCheckpoint(ctx)
+	if err != nil {
+		if db.IsNotFoundError(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return checkpoint.Height, nil
+}
+
+// saveCheckpoint advances the processing checkpoint to the height, recording
+// the hash of the block at the height if the backend knows it.
+func (s *Service) saveCheckpoint(ctx context.Context, height uint64) error {
+	var blockHash string
+	hash, err := s.btc.GetBlockHash(ctx, int64(height))
+	switch {
+	case err == nil:
+		blockHash = hash.String()
+	case !errors.Is(err, btcclient.ErrUnsupported):
+		return fmt.Errorf("failed to get block hash at height %d: %w", height, err)
+	}
+
+	fence, err := s.fence()
+	if err != nil {
+		return err
+	}
+	if err := s.db.SaveProcessingCheckpoint(ctx, height, blockHash, fence); err != nil {
+		if db.IsNotFoundError(err) {
+			// Another instance got further meanwhile.
+			log.Debug().Uint64("height", height).Msg("processing checkpoint is ahead already")
+			return nil
+		}
+		return err
+	}
+	log.Debug().Uint64("height", height).Str("block_hash", blockHash).Msg("advanced processing checkpoint")
+	return nil
+}
+
+// ReportCheckpointLag logs how far the processing checkpoint lags behind the
+// confirmed btc height, i.e. how many blocks are caught up with on startup.
+func (s *Service) ReportCheckpointLag(ctx context.Context) error {
+	checkpoint, err := s.db.GetProcessingCheckpoint(ctx)
+	if err != nil && !db.IsNotFoundError(err) {
+		return err
+	}
+	btcTip, err := s.btc.GetBlockCount(ctx)
+	if err != nil {
+		return err
+	}
+	confirmedHeight := uint64(0)
+	if depth := s.cfg.Btc.GetConfirmationDepth(); btcTip >= 0 && uint64(btcTip) >= depth {
+		confirmedHeight = uint64(btcTip) - depth
+	}
+
+	if checkpoint == nil {
+		log.Info().Int64("btc_tip", btcTip).Uint64("confirmed_height", confirmedHeight).
+			Msg("no processing checkpoint, processing all expired delegations")
+		return nil
+	}
+	lag := checkpointLag(checkpoint.Height, confirmedHeight)
+	metrics.RecordProcessingCheckpoint(checkpoint.Height, lag)
+	log.Info().Uint64("checkpoint_height", checkpoint.Height).Str("checkpoint_block_hash", checkpoint.BlockHash).
+		Time("checkpoint_updated_at", time.Unix(checkpoint.UpdatedAt, 0)).
+		Int64("btc_tip", btcTip).Uint64("confirmed_height", confirmedHeight).Uint64("lag_blocks", lag).
+		Msg("resuming from processing checkpoint")
+	return nil
+}
+
+// checkpointLag returns the number of confirmed blocks beyond the checkpoint.
+func checkpointLag(checkpointHeight, confirmedHeight uint64) uint64 {
+	if checkpointHeight >= confirmedHeight {
+		return 0
+	}
+	return confirmedHeight - checkpointHeight
+}
+
+// publishExpiredDelegations publishes a batch of claimed documents on a
+// bounded pool of workers. Failures of single documents are recorded on the
+// documents and do not stop the batch. Losing the leadership, a db failure or
+// the context being cancelled stops handing out further documents and waits
+// for the in-flight ones. Documents left unprocessed keep their lease until
+// it expires and are claimed again afterwards.
+func (s *Service) publishExpiredDelegations(
+	ctx context.Context, delegations []model.TimeLockDocument, btcTip uint64,
+) error {
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(s.cfg.Poller.Workers)
+
+	for _, delegation := range delegations {
+		if gctx.Err() != nil {
 			break
 		}
+		delegation := delegation
+		g.Go(func() error {
+			return s.publishExpiredDelegation(gctx, delegation, btcTip)
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// publishExpiredDelegation drives a claimed timelock document through the
+// publishing -> published outbox states and archives it afterwards.
+// A crash at any point leaves the document in a state from which the next run
+// resumes: publishing documents are claimed again once their lease expires,
+// published ones are archived. Failures specific to the document are recorded
+// on it, only errors that should stop the whole batch are returned.
+func (s *Service) publishExpiredDelegation(
+	ctx context.Context, delegation model.TimeLockDocument, btcTip uint64,
+) error {
+	if delegation.DecodeErr != nil {
+		return s.recordDelegationFailure(ctx, delegation, delegation.DecodeErr, true)
+	}
+
+	if err := s.checkLeadership(ctx); err != nil {
+		return err
+	}
+	if s.cfg.ExpiryValidation.Enabled {
+		reason, computedExpireHeight, err := s.validateExpireHeight(ctx, delegation)
+		if err != nil {
+			return s.handleBtcFailure(ctx, delegation, err)
+		}
+		if reason != "" {
+			return s.quarantineDelegation(ctx, delegation, reason, computedExpireHeight)
+		}
+	}
+	if s.cfg.Poller.VerifyUnspent {
+		spent, err := s.timeLockOutputSpent(ctx, delegation)
+		if err != nil {
+			return s.handleBtcFailure(ctx, delegation, err)
+		}
+		if spent {
+			return s.archiveSpentDelegation(ctx, delegation, btcTip)
+		}
+	}
+	alreadyPublished, err := s.db.IsEventPublished(ctx, delegation.StakingTxHashHex, delegation.TxType)
+	if err != nil {
+		return s.recordDelegationFailure(ctx, delegation, err, true)
+	}
+	if alreadyPublished {
+		// The same event was emitted before, e.g. for a document inserted
+		// again upstream. The document is completed without publishing.
+		metrics.RecordSuppressedDuplicate()
+		log.Warn().Str("staking_tx_hash_hex", delegation.StakingTxHashHex).
+			Str("tx_type", delegation.TxType).
+			Msg("expired staking event was already published, suppressing duplicate")
+	} else {
+		if delegation.Status == model.TimeLockStatusPublishing {
+			// The document was reclaimed from an expired lease, its previous
+			// owner may have emitted the event before it stopped.
+			metrics.RecordRepublishedEvent()
+			log.Warn().Str("staking_tx_hash_hex", delegation.StakingTxHashHex).
+				Str("previous_owner", delegation.LeaseOwner).
+				Bool("maybe_published", delegation.MaybePublished).
+				Msg("republishing expired staking event, consumers may see a duplicate")
+		}
+		ev := queueclient.NewExpiredStakingEvent(delegation.StakingTxHashHex, delegation.TxType)
+		if err := s.queueManager.SendExpiredStakingEvent(ctx, ev); err != nil {
+			return s.handleSendFailure(ctx, delegation, err)
+		}
+	}
 
-		for _, delegation := range expiredDelegations {
-			ev := queueclient.NewExpiredStakingEvent(delegation.StakingTxHashHex, delegation.TxType)
-			if err := s.queueManager.SendExpiredStakingEvent(ctx, ev); err != nil {
-				return err
-			}
-			// After successfully sending the event, delete the entry from the database.
-			if err := s.db.DeleteExpiredDelegation(ctx, delegation.ID); err != nil {
-				return err
-			}
+	// The writes are fenced, a stale leader that passed the leadership check
+	// above is rejected by the db once another instance took over.
+	fence, err := s.fence()
+	if err != nil {
+		return err
+	}
+	if err := s.db.MarkDelegationPublished(ctx, delegation.ID, s.instanceID, btcTip, !alreadyPublished, fence); err != nil {
+		if errors.Is(err, db.ErrFenced) {
+			// The new leader claims the document again once its lease
+			// expired and publishes the event again.
+			metrics.RecordRepublishedEvent()
+			return err
+		}
+		if db.IsNotFoundError(err) {
+			// The lease expired while publishing and another instance
+			// claimed the document, it will publish the event again.
+			metrics.RecordRepublishedEvent()
+			log.Warn().Str("staking_tx_hash_hex", delegation.StakingTxHashHex).
+				Msg("lease lost while publishing, consumers may see a duplicate")
+			return nil
 		}
+		return s.recordDelegationFailure(ctx, delegation, err, false)
+	}
 
+	// The event is published, a failed archive is retried on the next run.
+	if err := s.db.ArchiveExpiredDelegation(ctx, delegation.ID, fence); err != nil {
+		if errors.Is(err, db.ErrFenced) {
+			return err
+		}
+		log.Error().Err(err).Str("staking_tx_hash_hex", delegation.StakingTxHashHex).
+			Msg("failed to archive published delegation")
 	}
 
 	return nil
 }
+
+// validateExpireHeight derives the expiry of the delegation from the
+// confirmation height and the timelock of its transaction. A reason is
+// returned if the stored expire height cannot be trusted, along with the
+// derived expiry if known. Errors are returned for failed lookups and for
+// staking txs without staking data of the configured tag, which are retried.
+func (s *Service) validateExpireHeight(
+	ctx context.Context, delegation model.TimeLockDocument,
+) (string, uint64, error) {
+	var (
+		txHashHex string
+		timeLock  uint16
+	)
+	switch delegation.TxType {
+	case model.TimeLockTxTypeActive:
+		txHashHex = delegation.StakingTxHashHex
+	case model.TimeLockTxTypeUnbonding:
+		if delegation.UnbondingTxHashHex == "" || s.cfg.ExpiryValidation.UnbondingTime == 0 {
+			log.Debug().Str("staking_tx_hash_hex", delegation.StakingTxHashHex).
+				Msg("unbonding tx or time unknown, skipping the expire height validation")
+			return "", 0, nil
+		}
+		txHashHex = delegation.UnbondingTxHashHex
+		timeLock = s.cfg.ExpiryValidation.UnbondingTime
+	default:
+		return fmt.Sprintf("unknown tx type %q", delegation.TxType), 0, nil
+	}
+
+	txHash, err := chainhash.NewHashFromStr(txHashHex)
+	if err != nil {
+		return fmt.Sprintf("invalid tx hash %s: %v", txHashHex, err), 0, nil
+	}
+	if delegation.TxType == model.TimeLockTxTypeActive {
+		tx, err := s.btc.GetRawTransaction(ctx, txHash)
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to look up staking tx %s: %w", txHashHex, err)
+		}
+		tag := s.cfg.ExpiryValidation.GetTag()
+		if len(tag) == 0 {
+			return "", 0, errors.New("no staking tag configured for the expire height validation")
+		}
+		timeLock, err = staking.ParseStakingTime(tx, tag)
+		if errors.Is(err, staking.ErrNoStakingData) {
+			// A tag not matching the network is as likely as a bad
+			// document, the delegation is retried rather than quarantined.
+			return "", 0, fmt.Errorf("failed to parse staking tx %s: %w", txHashHex, err)
+		}
+		if err != nil {
+			return fmt.Sprintf("invalid staking tx %s: %v", txHashHex, err), 0, nil
+		}
+	}
+
+	// An unconfirmed tx may have been reorged out, the lookup is retried
+	// until the document is dead lettered.
+	height, err := s.btc.GetTxBlockHeight(ctx, txHash)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to look up the confirmation height of tx %s: %w", txHashHex, err)
+	}
+
+	computedExpireHeight := uint64(height) + uint64(timeLock)
+	if computedExpireHeight != delegation.ExpireHeight {
+		return fmt.Sprintf(
+			"expire height %d does not match the expiry %d computed from tx %s confirmed at height %d with timelock %d",
+			delegation.ExpireHeight, computedExpireHeight, txHashHex, height, timeLock,
+		), computedExpireHeight, nil
+	}
+	return "", computedExpireHeight, nil
+}
+
+// quarantineDelegation moves a delegation whose expire height cannot be
+// trusted out of the queue without publishing its expiry.
+func (s *Service) quarantineDelegation(
+	ctx context.Context, delegation model.TimeLockDocument, reason string, computedExpireHeight uint64,
+) error {
+	fence, err := s.fence()
+	if err != nil {
+		return err
+	}
+	err = s.db.QuarantineDelegation(ctx, delegation.ID, s.instanceID, reason, computedExpireHeight, fence)
+	if err != nil {
+		if errors.Is(err, db.ErrFenced) {
+			// The new leader claims the document again once its lease
+			// expired and validates the expire height again.
+			return err
+		}
+		if db.IsNotFoundError(err) {
+			// The lease expired and another instance claimed the document,
+			// it validates the expire height again.
+			log.Warn().Str("staking_tx_hash_hex", delegation.StakingTxHashHex).
+				Msg("lease lost while quarantining delegation")
+			return nil
+		}
+		return s.recordDelegationFailure(ctx, delegation, err, true)
+	}
+
+	metrics.RecordExpireHeightMismatch(delegation.TxType)
+	log.Error().Str("staking_tx_hash_hex", delegation.StakingTxHashHex).
+		Str("tx_type", delegation.TxType).
+		Uint64("expire_height", delegation.ExpireHeight).
+		Uint64("computed_expire_height", computedExpireHeight).
+		Str("reason", reason).
+		Msg("expire height does not match the chain, quarantined the delegation")
+	return nil
+}
+
+// timeLockOutputSpent reports whether the output locked until the expiry was
+// spent before the expire height, e.g. by slashing, in which case no expiry
+// must be published. Spends at or after the expire height, spends not
+// confirmed yet and documents not telling which output is locked are treated
+// as unspent.
+func (s *Service) timeLockOutputSpent(ctx context.Context, delegation model.TimeLockDocument) (bool, error) {
+	txHashHex, index, ok := delegation.TimeLockOutpoint()
+	if !ok {
+		log.Debug().Str("staking_tx_hash_hex", delegation.StakingTxHashHex).
+			Str("tx_type", delegation.TxType).
+			Msg("timelocked output unknown, skipping the unspent check")
+		return false, nil
+	}
+	txHash, err := chainhash.NewHashFromStr(txHashHex)
+	if err != nil {
+		return false, fmt.Errorf("invalid timelock tx hash %s: %w", txHashHex, err)
+	}
+
+	txOut, err := s.btc.GetTxOut(ctx, txHash, index)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up output %s:%d: %w", txHashHex, index, err)
+	}
+	if txOut != nil {
+		return false, nil
+	}
+
+	// No unspent output is returned for spent outputs as well as unknown
+	// ones, only the former may skip the expiry.
+	tx, err := s.btc.GetRawTransaction(ctx, txHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up timelock tx %s: %w", txHashHex, err)
+	}
+	if int(index) >= len(tx.TxOut) {
+		return false, fmt.Errorf("timelock tx %s has no output %d", txHashHex, index)
+	}
+
+	// Once the timelock ended the output is expected to be spent, e.g. by a
+	// withdrawal, the expiry is only skipped for spends before the expiry.
+	spendHeight, err := s.btc.GetTxOutSpendHeight(ctx, txHash, index)
+	switch {
+	case errors.Is(err, btcclient.ErrTxNotConfirmed):
+		// A spend only seen in the mempool may still be replaced.
+		return false, nil
+	case errors.Is(err, btcclient.ErrUnsupported):
+		log.Debug().Str("staking_tx_hash_hex", delegation.StakingTxHashHex).
+			Str("tx_type", delegation.TxType).
+			Msg("spend height of the timelocked output unknown, not skipping the expiry")
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("failed to look up the spend of output %s:%d: %w", txHashHex, index, err)
+	}
+	return spendHeight >= 0 && uint64(spendHeight) < delegation.ExpireHeight, nil
+}
+
+// archiveSpentDelegation completes a delegation whose timelocked output was
+// already spent without publishing its expiry.
+func (s *Service) archiveSpentDelegation(
+	ctx context.Context, delegation model.TimeLockDocument, btcTip uint64,
+) error {
+	fence, err := s.fence()
+	if err != nil {
+		return err
+	}
+	if err := s.db.ArchiveSpentDelegation(ctx, delegation.ID, s.instanceID, btcTip, fence); err != nil {
+		if errors.Is(err, db.ErrFenced) {
+			// The new leader claims the document again once its lease
+			// expired and checks the output again.
+			return err
+		}
+		if db.IsNotFoundError(err) {
+			// The lease expired and another instance claimed the document,
+			// it checks the output again.
+			log.Warn().Str("staking_tx_hash_hex", delegation.StakingTxHashHex).
+				Msg("lease lost while archiving spent delegation")
+			return nil
+		}
+		return s.recordDelegationFailure(ctx, delegation, err, true)
+	}
+
+	metrics.RecordSpentDelegation(delegation.TxType)
+	log.Warn().Str("staking_tx_hash_hex", delegation.StakingTxHashHex).
+		Str("tx_type", delegation.TxType).
+		Msg("timelocked output already spent, archived without publishing the expiry")
+	return nil
+}
+
+// handleSendFailure records a failed send on the document. If the queue is
+// unhealthy rather than the document, the document is handed back instead
+// and the error is returned to stop the batch.
+func (s *Service) handleSendFailure(ctx context.Context, delegation model.TimeLockDocument, err error) error {
+	if errors.Is(err, queue.ErrCircuitOpen) {
+		s.releaseDelegation(delegation)
+		return err
+	}
+	// The broker may have stored an event it did not confirm, which says
+	// nothing about the document, so it does not count as a failure.
+	var sendErr *queue.SendError
+	if errors.As(err, &sendErr) && sendErr.MaybePublished {
+		return s.recordMaybePublished(ctx, delegation, err)
+	}
+	// Otherwise the event was not published, so the next attempt is not a
+	// duplicate.
+	return s.recordDelegationFailure(ctx, delegation, err, true)
+}
+
+// recordMaybePublished records a send the broker did not confirm on the
+// document, which keeps its lease and is retried once the lease expired. The
+// retry checks the published event ledger before sending the event again.
+func (s *Service) recordMaybePublished(ctx context.Context, delegation model.TimeLockDocument, failure error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	log.Warn().Err(failure).Str("id", delegation.ID.Hex()).
+		Str("staking_tx_hash_hex", delegation.StakingTxHashHex).
+		Msg("expired staking event may have been published without a confirmation")
+
+	if err := s.db.RecordMaybePublished(ctx, delegation.ID, s.instanceID, failure); err != nil {
+		if db.IsNotFoundError(err) {
+			// The lease was lost, the new owner publishes the event again.
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// handleBtcFailure records a failed btc lookup on the document. If the node
+// is unavailable or rejects the credentials rather than failing on the
+// document, the document is handed back instead and the error is returned to
+// stop the batch, so that an outage does not dead letter the delegations.
+func (s *Service) handleBtcFailure(ctx context.Context, delegation model.TimeLockDocument, err error) error {
+	switch btcclient.ClassOf(err) {
+	case btcclient.ErrorClassTransient, btcclient.ErrorClassAuth:
+		s.releaseDelegation(delegation)
+		return err
+	default:
+		return s.recordDelegationFailure(ctx, delegation, err, true)
+	}
+}
+
+// recordDelegationFailure records a failed attempt on the document, moving it
+// to the dead letter collection once it failed too often. It returns an error
+// only if the failure could not be recorded.
+func (s *Service) recordDelegationFailure(
+	ctx context.Context, delegation model.TimeLockDocument, failure error, notPublished bool,
+) error {
+	if ctx.Err() != nil {
+		// Failures caused by shutting down say nothing about the document.
+		return ctx.Err()
+	}
+
+	metrics.RecordDelegationFailure()
+	log.Error().Err(failure).Str("id", delegation.ID.Hex()).
+		Str("staking_tx_hash_hex", delegation.StakingTxHashHex).
+		Msg("failed to process expired delegation")
+
+	fence, err := s.fence()
+	if err != nil {
+		return err
+	}
+	deadLettered, err := s.db.RecordDelegationFailure(
+		ctx, delegation.ID, s.instanceID, failure, notPublished, s.cfg.Poller.MaxFailures, fence,
+	)
+	if err != nil {
+		if db.IsNotFoundError(err) {
+			// The lease was lost, the new owner records its own failures.
+			return nil
+		}
+		return err
+	}
+	if deadLettered {
+		metrics.RecordDeadLetter()
+		log.Warn().Str("id", delegation.ID.Hex()).
+			Str("staking_tx_hash_hex", delegation.StakingTxHashHex).
+			Int("max_failures", s.cfg.Poller.MaxFailures).
+			Msg("moved expired delegation to the dead letter collection")
+	}
+
+	return nil
+}
+
+// releaseDelegation hands a claimed document back so that it is claimed again
+// once the queue recovered. It runs detached from the batch context, which is
+// cancelled by the time the release happens.
+func (s *Service) releaseDelegation(delegation model.TimeLockDocument) {
+	ctx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancel()
+
+	err := s.db.ReleaseDelegation(ctx, delegation.ID, s.instanceID, delegation.Status)
+	if err != nil && !db.IsNotFoundError(err) {
+		// The document is claimed again once its lease expired.
+		log.Error().Err(err).Str("staking_tx_hash_hex", delegation.StakingTxHashHex).
+			Msg("failed to release delegation")
+	}
+}
+
+// fence returns the fence of the current leadership for the db writes that
+// must not land after another instance took over, or nil without an elector.
+func (s *Service) fence() (*model.LeaderFence, error) {
+	if s.elector == nil {
+		return nil, nil
+	}
+	return s.elector.Fence()
+}
+
+// checkLeadership makes sure a stale leader, replaced while it was processing,
+// stops before performing any further side effect.
+func (s *Service) checkLeadership(ctx context.Context) error {
+	if s.elector == nil {
+		return nil
+	}
+	return s.elector.CheckFencingToken(ctx)
+}
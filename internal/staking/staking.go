@@ -0,0 +1,67 @@
+package staking
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	tagLength      = 4
+	versionLength  = 1
+	pubKeyLength   = 32
+	stakingVersion = 0
+
+	// opReturnDataLength is the length of the OP_RETURN data of staking
+	// transactions: tag, version, staker and finality provider keys and the
+	// staking time.
+	opReturnDataLength = tagLength + versionLength + 2*pubKeyLength + 2
+)
+
+// ErrNoStakingData is returned for transactions without a staking OP_RETURN output.
+var ErrNoStakingData = errors.New("no staking OP_RETURN output found")
+
+// ParseStakingTime returns the timelock of the staking output in blocks, read
+// from the OP_RETURN output carrying the staking data with the given tag. The
+// staking output itself is a taproot output, which does not reveal it.
+func ParseStakingTime(tx *wire.MsgTx, tag []byte) (uint16, error) {
+	var stakingTime uint16
+	found := false
+	for _, out := range tx.TxOut {
+		data, ok := opReturnData(out.PkScript)
+		if !ok || len(data) != opReturnDataLength || !bytes.HasPrefix(data, tag) {
+			continue
+		}
+		if found {
+			return 0, errors.New("multiple staking OP_RETURN outputs found")
+		}
+		if version := data[tagLength]; version != stakingVersion {
+			return 0, fmt.Errorf("unsupported staking data version %d", version)
+		}
+		stakingTime = binary.BigEndian.Uint16(data[opReturnDataLength-2:])
+		found = true
+	}
+	if !found {
+		return 0, ErrNoStakingData
+	}
+	if stakingTime == 0 {
+		return 0, errors.New("staking time must be positive")
+	}
+	return stakingTime, nil
+}
+
+// opReturnData returns the data pushed by an OP_RETURN script.
+func opReturnData(pkScript []byte) ([]byte, bool) {
+	if len(pkScript) == 0 || pkScript[0] != txscript.OP_RETURN {
+		return nil, false
+	}
+	pushes, err := txscript.PushedData(pkScript[1:])
+	if err != nil || len(pushes) != 1 {
+		return nil, false
+	}
+	return pushes[0], true
+}
@@ -1,6 +1,9 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
 	"runtime"
 	"strings"
 
@@ -49,6 +52,20 @@ func GetValidNetParams() map[string]bool {
 	return params
 }
 
+// GetDefaultConfirmationDepth returns the number of confirmations a block needs
+// before the checker treats it as final on the given network. Testnet reorgs
+// as often as mainnet, signet blocks are signed by a few miners and reorg
+// rarely. Only the local networks default to no confirmations.
+func GetDefaultConfirmationDepth(net string) uint64 {
+	switch net {
+	case BtcMainnet.String(), BtcTestnet.String():
+		return 6
+	case BtcSignet.String():
+		return 3
+	}
+	return 0
+}
+
 // GetFunctionName retrieves the name of the function at the specified call depth.
 // depth 0 = getFunctionName, depth 1 = caller of getFunctionName, depth 2 = caller of that caller, etc.
 func GetFunctionName(depth int) string {
@@ -77,3 +94,20 @@ func shortFuncName(fullName string) string {
 	}
 	return fullName
 }
+
+// NewInstanceID returns an identifier that is unique to this process. It is
+// made of the hostname and a random suffix, so that it stays readable in logs
+// while restarted processes on the same host do not share the same ID.
+func NewInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "unknown"
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return hostname
+	}
+
+	return hostname + "-" + hex.EncodeToString(suffix)
+}
@@ -0,0 +1,170 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/babylonchain/staking-queue-client/client"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/btcclient"
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/db/model"
+)
+
+func testBabylonConfig() *config.HttpRetryConfig {
+	return &config.HttpRetryConfig{
+		RequestTimeout: 200 * time.Millisecond,
+		MaxRetries:     2,
+		RetryBackoff:   10 * time.Millisecond,
+	}
+}
+
+func TestBabylonClient_GetBlockCount(t *testing.T) {
+	initTestMetrics(t)
+	chain := mineRegtestHeaders(regtestGenesisHeader(), 11, "babylon", -1)
+	node := NewFakeBabylonNode(t, 990, chain)
+
+	client := btcclient.NewBabylonClient(node.URL()+"/", testBabylonConfig())
+	tip, err := client.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), tip)
+
+	// The tip follows the light client as it is extended.
+	node.SetChain(append(chain, mineRegtestHeaders(chain[len(chain)-1], 2, "babylon-next", -1)...))
+	tip, err = client.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(1002), tip)
+}
+
+func TestBabylonClient_GetBlockHash(t *testing.T) {
+	initTestMetrics(t)
+	chain := mineRegtestHeaders(regtestGenesisHeader(), 11, "babylon", -1)
+	node := NewFakeBabylonNode(t, 990, chain)
+	client := btcclient.NewBabylonClient(node.URL(), testBabylonConfig())
+
+	for height, header := range map[int64]int{1000: 10, 995: 5, 990: 0} {
+		hash, err := client.GetBlockHash(context.Background(), height)
+		require.NoError(t, err)
+		require.Equal(t, chain[header].BlockHash(), *hash)
+	}
+
+	// Heights above the tip or below the base of the light client are unknown.
+	_, err := client.GetBlockHash(context.Background(), 1001)
+	require.Error(t, err)
+	_, err = client.GetBlockHash(context.Background(), 989)
+	require.Error(t, err)
+
+	// A reorg of the light client replaces the hashes from the fork on.
+	forked := append(chain[:6:6], mineRegtestHeaders(chain[5], 5, "babylon-fork", -1)...)
+	node.SetChain(forked)
+	hash, err := client.GetBlockHash(context.Background(), 1000)
+	require.NoError(t, err)
+	require.Equal(t, forked[10].BlockHash(), *hash)
+	require.NotEqual(t, chain[10].BlockHash(), *hash)
+	hash, err = client.GetBlockHash(context.Background(), 995)
+	require.NoError(t, err)
+	require.Equal(t, chain[5].BlockHash(), *hash)
+}
+
+func TestBabylonClient_GetSyncStatus(t *testing.T) {
+	initTestMetrics(t)
+	node := NewFakeBabylonNode(t, 990, mineRegtestHeaders(regtestGenesisHeader(), 11, "babylon", -1))
+	client := btcclient.NewBabylonClient(node.URL(), testBabylonConfig())
+
+	status, err := client.GetSyncStatus(context.Background())
+	require.NoError(t, err)
+	require.False(t, status.IsSyncing())
+	require.Equal(t, int64(1000), status.Blocks)
+
+	// The light client of a catching up node lags behind the btc chain.
+	node.SetSyncing(true)
+	status, err = client.GetSyncStatus(context.Background())
+	require.NoError(t, err)
+	require.True(t, status.IsSyncing())
+}
+
+func TestBabylonClient_TransactionLookupsUnsupported(t *testing.T) {
+	initTestMetrics(t)
+	node := NewFakeBabylonNode(t, 990, mineRegtestHeaders(regtestGenesisHeader(), 11, "babylon", -1))
+	client := btcclient.NewBabylonClient(node.URL(), testBabylonConfig())
+	txHash := chainhash.Hash{1}
+
+	_, err := client.GetRawTransaction(context.Background(), &txHash)
+	require.ErrorIs(t, err, btcclient.ErrUnsupported)
+	_, err = client.GetTxOut(context.Background(), &txHash, 0)
+	require.ErrorIs(t, err, btcclient.ErrUnsupported)
+	_, err = client.GetTxBlockHeight(context.Background(), &txHash)
+	require.ErrorIs(t, err, btcclient.ErrUnsupported)
+}
+
+func TestBabylonClient_RetriesServerErrors(t *testing.T) {
+	initTestMetrics(t)
+	node := NewFakeBabylonNode(t, 990, mineRegtestHeaders(regtestGenesisHeader(), 11, "babylon", -1))
+	client := btcclient.NewBabylonClient(node.URL(), testBabylonConfig())
+
+	node.FailNext(2)
+	tip, err := client.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), tip)
+	require.Equal(t, 3, node.Requests("/babylon/btclightclient/v1/tip"))
+
+	// Once the retries are exhausted the status of the last answer is returned.
+	node.FailNext(3)
+	_, err = client.GetBlockCount(context.Background())
+	var statusErr *btcclient.HttpStatusError
+	require.True(t, errors.As(err, &statusErr))
+	require.Equal(t, http.StatusServiceUnavailable, statusErr.StatusCode)
+}
+
+func TestBtcConfig_ValidateBabylon(t *testing.T) {
+	cfg := config.BtcConfig{
+		Backend:   config.BackendBabylon,
+		Endpoint:  "http://localhost:1317",
+		NetParams: "regtest",
+		Babylon:   *testBabylonConfig(),
+	}
+	require.NoError(t, cfg.Validate())
+
+	cfg.Endpoint = "localhost:1317"
+	require.Error(t, cfg.Validate())
+
+	cfg.Endpoint = "http://localhost:1317"
+	cfg.Babylon.RequestTimeout = 0
+	require.Error(t, cfg.Validate())
+}
+
+func TestProcessExpiredDelegations_BabylonLightClient(t *testing.T) {
+	node := NewFakeBabylonNode(t, 990, mineRegtestHeaders(regtestGenesisHeader(), 11, "babylon", -1))
+
+	cfg, err := config.New("./config-test.yml")
+	require.NoError(t, err)
+	btcCfg := cfg.Btc
+	btcCfg.Backend = config.BackendBabylon
+	btcCfg.Endpoint = node.URL()
+	btcCfg.Babylon = *testBabylonConfig()
+
+	_, conn, teardown := setupTestServer(t, &TestServerDependency{
+		ConfigOverrides: &config.Config{Btc: btcCfg},
+	})
+	defer teardown()
+
+	// Only the delegation expired at the light client tip is published.
+	insertTestDelegations(t, []model.TimeLockDocument{
+		{ID: primitive.NewObjectID(), StakingTxHashHex: "stakingTxHashHex1", ExpireHeight: 1000, TxType: "active"},
+		{ID: primitive.NewObjectID(), StakingTxHashHex: "stakingTxHashHex2", ExpireHeight: 1001, TxType: "active"},
+	})
+	require.Eventually(
+		t, func() bool {
+			count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+			return err == nil && count == 1 && len(fetchAllTestDelegations(t)) == 1
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+	require.Equal(t, "stakingTxHashHex2", fetchAllTestDelegations(t)[0].StakingTxHashHex)
+	require.Positive(t, node.Requests("/babylon/btclightclient/v1/tip"))
+}
@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/babylonchain/staking-queue-client/client"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/btcclient"
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/db/model"
+	"github.com/babylonchain/staking-expiry-checker/tests/mocks"
+)
+
+func TestBlockSubscriber_SignalsNewBlocks(t *testing.T) {
+	publisher := NewFakeBlockPublisher(t)
+	subscriber := btcclient.NewBlockSubscriber(publisher.Endpoint())
+	go subscriber.Start(context.Background())
+	defer subscriber.Stop()
+
+	// Notifications published before the subscription is established are
+	// lost, so keep announcing blocks until one arrives.
+	require.Eventually(
+		t, func() bool {
+			publisher.PublishBlock(t)
+			select {
+			case <-subscriber.Notifications():
+				return true
+			case <-time.After(50 * time.Millisecond):
+				return false
+			}
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+
+	// Drop a signal of a block announced while waiting for the subscription.
+	time.Sleep(200 * time.Millisecond)
+	select {
+	case <-subscriber.Notifications():
+	default:
+	}
+
+	// Notifications of other topics are ignored.
+	publisher.publish(t, "hashtx", make([]byte, 32))
+	select {
+	case <-subscriber.Notifications():
+		t.Fatal("received a signal for a non block notification")
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	// Blocks arriving while the consumer is busy are coalesced into a single signal.
+	for i := 0; i < 3; i++ {
+		publisher.PublishBlock(t)
+	}
+	time.Sleep(500 * time.Millisecond)
+	select {
+	case <-subscriber.Notifications():
+	case <-time.After(5 * time.Second):
+		t.Fatal("no signal for new blocks")
+	}
+	select {
+	case <-subscriber.Notifications():
+		t.Fatal("blocks were signalled more than once")
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestProcessExpiredDelegations_TriggeredByNewBlock(t *testing.T) {
+	mockBtc := new(mocks.BtcInterface)
+	mockBtc.On("GetBlockCount", mock.Anything).Return(int64(1000), nil)
+	publisher := NewFakeBlockPublisher(t)
+
+	cfg, err := config.New("./config-test.yml")
+	require.NoError(t, err)
+	// The fallback ticker never fires during the test.
+	pollerCfg := cfg.Poller
+	pollerCfg.Interval = time.Hour
+	btcCfg := cfg.Btc
+	btcCfg.ZmqBlockEndpoint = publisher.Endpoint()
+
+	_, conn, teardown := setupTestServer(t, &TestServerDependency{
+		ConfigOverrides: &config.Config{Poller: pollerCfg, Btc: btcCfg},
+		MockBtcClient:   mockBtc,
+	})
+	defer teardown()
+
+	insertTestDelegations(t, []model.TimeLockDocument{
+		{
+			ID:               primitive.NewObjectID(),
+			StakingTxHashHex: "mockStakingTxHashHex",
+			ExpireHeight:     999,
+			TxType:           "active",
+		},
+	})
+
+	require.Eventually(
+		t, func() bool {
+			publisher.PublishBlock(t)
+			count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+			return err == nil && count == 1
+		}, 10*time.Second, 200*time.Millisecond,
+	)
+}
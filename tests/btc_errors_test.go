@@ -0,0 +1,159 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/btcclient"
+	"github.com/babylonchain/staking-expiry-checker/internal/db/model"
+	"github.com/babylonchain/staking-expiry-checker/internal/fakebtc"
+	"github.com/babylonchain/staking-expiry-checker/internal/queue"
+	"github.com/babylonchain/staking-expiry-checker/internal/services"
+	"github.com/babylonchain/staking-expiry-checker/tests/mocks"
+)
+
+func TestBtcErrors_ClassifiesRpcErrors(t *testing.T) {
+	initTestMetrics(t)
+	fake := fakebtc.NewServer(100)
+	t.Cleanup(fake.Close)
+	client := newFakeBitcoindClient(t, fake)
+
+	fake.RejectAuth(true)
+	_, err := client.GetBlockCount(context.Background())
+	require.ErrorIs(t, err, btcclient.ErrRpcUnauthorized)
+	require.True(t, btcclient.IsAuthError(err))
+	fake.RejectAuth(false)
+
+	// A starting node answers once it loaded its state.
+	fake.FailNext("getblockcount", 1, &btcjson.RPCError{
+		Code:    btcjson.ErrRPCInWarmup,
+		Message: "Loading block index...",
+	})
+	_, err = client.GetBlockCount(context.Background())
+	var btcErr *btcclient.Error
+	require.True(t, errors.As(err, &btcErr))
+	require.Equal(t, btcclient.ErrorClassTransient, btcErr.Class)
+
+	unknown := chainhash.Hash{1}
+	_, err = client.GetRawTransaction(context.Background(), &unknown)
+	require.Equal(t, btcclient.ErrorClassPermanent, btcclient.ClassOf(err))
+}
+
+func TestBtcErrors_RpcRequestHonoursContext(t *testing.T) {
+	initTestMetrics(t)
+	fake := fakebtc.NewServer(100)
+	t.Cleanup(fake.Close)
+	client := newFakeBitcoindClient(t, fake)
+
+	fake.SetLatency(time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.GetBlockCount(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.True(t, btcclient.IsTransientError(err))
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestBtcErrors_ClassifiesHttpStatuses(t *testing.T) {
+	initTestMetrics(t)
+	for status, class := range map[int]btcclient.ErrorClass{
+		http.StatusServiceUnavailable: btcclient.ErrorClassTransient,
+		http.StatusTooManyRequests:    btcclient.ErrorClassTransient,
+		http.StatusUnauthorized:       btcclient.ErrorClassAuth,
+		http.StatusNotFound:           btcclient.ErrorClassPermanent,
+	} {
+		status := status
+		server, _ := newFakeEsplora(t, func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, http.StatusText(status), status)
+		})
+
+		client := btcclient.NewEsploraClient(server.URL+"/api", testEsploraConfig())
+		_, err := client.GetBlockCount(context.Background())
+		require.Equal(t, class, btcclient.ClassOf(err), "status %d", status)
+	}
+}
+
+func TestBtcErrors_CancelStopsRetries(t *testing.T) {
+	initTestMetrics(t)
+	var requests atomic.Int32
+	ctx, cancel := context.WithCancel(context.Background())
+	server, _ := newFakeEsplora(t, func(w http.ResponseWriter, r *http.Request) {
+		// The caller gives up while the node is overloaded.
+		requests.Add(1)
+		cancel()
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	})
+
+	cfg := testEsploraConfig()
+	cfg.RetryBackoff = time.Second
+	client := btcclient.NewEsploraClient(server.URL+"/api", cfg)
+	start := time.Now()
+	_, err := client.GetBlockCount(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+	require.True(t, btcclient.IsTransientError(err))
+	require.Equal(t, int32(1), requests.Load())
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestBtcErrors_OutageReleasesDelegations(t *testing.T) {
+	cfg := testPublisherConfig(t)
+	cfg.Poller.VerifyUnspent = true
+	cfg.Poller.Workers = 1
+	qm := queue.NewQueueManagerWithClient(&fakeQueueClient{}, &cfg.Publisher)
+
+	outputIndex := uint32(0)
+	unknownHash, unavailableHash := chainhash.Hash{1}, chainhash.Hash{2}
+	unknown := model.TimeLockDocument{
+		ID:                 primitive.NewObjectID(),
+		StakingTxHashHex:   unknownHash.String(),
+		StakingOutputIndex: &outputIndex,
+		ExpireHeight:       999,
+		TxType:             "active",
+	}
+	unavailable := model.TimeLockDocument{
+		ID:                 primitive.NewObjectID(),
+		StakingTxHashHex:   unavailableHash.String(),
+		StakingOutputIndex: &outputIndex,
+		ExpireHeight:       999,
+		TxType:             "active",
+	}
+	outage := &btcclient.Error{Class: btcclient.ErrorClassTransient, Err: fmt.Errorf("connection refused")}
+
+	mockBtc := new(mocks.BtcInterface)
+	mockBtc.On("GetBlockCount", mock.Anything).Return(int64(1000), nil)
+	mockBtc.On("GetTxOut", mock.Anything, &unknownHash, outputIndex).
+		Return(nil, &btcclient.Error{Class: btcclient.ErrorClassPermanent, Err: fmt.Errorf("no such tx")})
+	mockBtc.On("GetTxOut", mock.Anything, &unavailableHash, outputIndex).Return(nil, outage)
+	mockDB := new(mocks.DbInterface)
+	mockDB.On("ArchivePublishedDelegations", mock.Anything, mock.Anything).Return(int64(0), nil)
+	mockDB.On("ClaimExpiredDelegations", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return([]model.TimeLockDocument{unknown, unavailable}, nil).Once()
+	mockDB.On("RecordDelegationFailure", mock.Anything, unknown.ID, mock.Anything, mock.Anything, true, mock.Anything, mock.Anything).
+		Return(false, nil)
+	mockDB.On("ReleaseDelegation", mock.Anything, unavailable.ID, mock.Anything, model.TimeLockStatus("")).
+		Return(nil)
+	mockNoProcessingCheckpoint(mockDB)
+
+	service := services.NewService(cfg, "instance", mockDB, mockBtc, qm, nil)
+
+	// A lookup failing on the document counts against it, the node being
+	// unavailable hands the document back and stops the batch.
+	err := service.ProcessExpiredDelegations(context.Background())
+	require.ErrorIs(t, err, outage)
+	mockDB.AssertCalled(t, "RecordDelegationFailure", mock.Anything, unknown.ID, mock.Anything, mock.Anything, true, mock.Anything, mock.Anything)
+	mockDB.AssertCalled(t, "ReleaseDelegation", mock.Anything, unavailable.ID, mock.Anything, model.TimeLockStatus(""))
+	mockDB.AssertNotCalled(t, "RecordDelegationFailure", mock.Anything, unavailable.ID, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
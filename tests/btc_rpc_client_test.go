@@ -0,0 +1,202 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/btcclient"
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/fakebtc"
+)
+
+func testRpcBtcConfig(endpoint config.BtcEndpointConfig) *config.BtcConfig {
+	return &config.BtcConfig{
+		NetParams:      "testnet",
+		Endpoints:      []config.BtcEndpointConfig{endpoint},
+		RequestTimeout: time.Second,
+	}
+}
+
+func TestBtcClient_CookieAuth(t *testing.T) {
+	initTestMetrics(t)
+	cookie := filepath.Join(t.TempDir(), ".cookie")
+	writeCookie := func(pass string) {
+		require.NoError(t, os.WriteFile(cookie, []byte("__cookie__:"+pass), 0o600))
+	}
+	writeCookie("first")
+
+	fake := fakebtc.NewServer(840000)
+	t.Cleanup(fake.Close)
+	fake.SetCredentials("__cookie__", "first")
+
+	client, err := btcclient.NewBtcClient(testRpcBtcConfig(config.BtcEndpointConfig{
+		Endpoint:      fake.Endpoint(),
+		DisableTLS:    true,
+		RpcCookieFile: cookie,
+	}))
+	require.NoError(t, err)
+	tip, err := client.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(840000), tip)
+
+	// A restarted node rotates the cookie, the new one is picked up even if
+	// the modification time did not visibly change.
+	info, err := os.Stat(cookie)
+	require.NoError(t, err)
+	writeCookie("second")
+	require.NoError(t, os.Chtimes(cookie, info.ModTime(), info.ModTime()))
+	fake.SetCredentials("__cookie__", "second")
+	tip, err = client.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(840000), tip)
+}
+
+func TestBtcClient_RejectedCredentials(t *testing.T) {
+	initTestMetrics(t)
+	fake := fakebtc.NewServer(840000)
+	t.Cleanup(fake.Close)
+
+	client, err := btcclient.NewBtcClient(testRpcBtcConfig(config.BtcEndpointConfig{
+		Endpoint:   fake.Endpoint(),
+		DisableTLS: true,
+		RpcUser:    fakebtc.DefaultRpcUser,
+		RpcPass:    "wrong",
+	}))
+	require.NoError(t, err)
+	_, err = client.GetBlockCount(context.Background())
+	require.ErrorIs(t, err, btcclient.ErrRpcUnauthorized)
+}
+
+func TestBtcClient_RequestTimeout(t *testing.T) {
+	initTestMetrics(t)
+	fake := fakebtc.NewServer(840000)
+	t.Cleanup(fake.Close)
+	fake.SetLatency(time.Minute)
+
+	cfg := testRpcBtcConfig(config.BtcEndpointConfig{
+		Endpoint:   fake.Endpoint(),
+		DisableTLS: true,
+		RpcUser:    fakebtc.DefaultRpcUser,
+		RpcPass:    fakebtc.DefaultRpcPass,
+	})
+	cfg.RequestTimeout = 100 * time.Millisecond
+	client, err := btcclient.NewBtcClient(cfg)
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = client.GetBlockCount(context.Background())
+	require.Error(t, err)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestBtcClient_TLSClientCertificate(t *testing.T) {
+	initTestMetrics(t)
+	dir := t.TempDir()
+	clientCert, clientKey := writeTestClientCert(t, dir)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AppendCertsFromPEM(readFile(t, clientCert))
+	fake := fakebtc.NewTLSServer(840000, &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	})
+	t.Cleanup(fake.Close)
+
+	caCert := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caCert, pem.EncodeToMemory(&pem.Block{
+		Type: "CERTIFICATE", Bytes: fake.Certificate().Raw,
+	}), 0o600))
+
+	endpoint := config.BtcEndpointConfig{
+		Endpoint: fake.Endpoint(),
+		RpcUser:  fakebtc.DefaultRpcUser,
+		RpcPass:  fakebtc.DefaultRpcPass,
+		TLS: config.BtcTLSConfig{
+			CACert:     caCert,
+			ClientCert: clientCert,
+			ClientKey:  clientKey,
+		},
+	}
+	client, err := btcclient.NewBtcClient(testRpcBtcConfig(endpoint))
+	require.NoError(t, err)
+	tip, err := client.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(840000), tip)
+
+	// Without the client certificate the handshake is rejected.
+	endpoint.TLS.ClientCert, endpoint.TLS.ClientKey = "", ""
+	client, err = btcclient.NewBtcClient(testRpcBtcConfig(endpoint))
+	require.NoError(t, err)
+	_, err = client.GetBlockCount(context.Background())
+	require.Error(t, err)
+}
+
+func TestBtcEndpointConfig_Validate(t *testing.T) {
+	valid := config.BtcEndpointConfig{Endpoint: "localhost:8332", RpcCookieFile: "/data/.cookie"}
+	require.NoError(t, valid.Validate())
+
+	withPass := valid
+	withPass.RpcPass = "rpcpass"
+	require.Error(t, withPass.Validate())
+
+	certWithoutKey := valid
+	certWithoutKey.TLS.ClientCert = "client.pem"
+	require.Error(t, certWithoutKey.Validate())
+
+	tlsDisabled := valid
+	tlsDisabled.DisableTLS = true
+	tlsDisabled.TLS.CACert = "ca.pem"
+	require.Error(t, tlsDisabled.Validate())
+
+	socksProxy := valid
+	socksProxy.Proxy = "socks5://localhost:9050"
+	require.NoError(t, socksProxy.Validate())
+	socksProxy.Proxy = "ftp://localhost:21"
+	require.Error(t, socksProxy.Validate())
+}
+
+// writeTestClientCert writes a self-signed client certificate and its key,
+// returning their paths.
+func writeTestClientCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "staking-expiry-checker"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPath := filepath.Join(dir, "client.pem")
+	keyPath := filepath.Join(dir, "client-key.pem")
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+	return certPath, keyPath
+}
+
+func readFile(t *testing.T, path string) []byte {
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return content
+}
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+)
+
+// legacyConfig only sets the keys known before the replicas, the publisher
+// and the other btc backends were added.
+const legacyConfig = `
+poller:
+  interval: 5s
+  log-level: debug
+db:
+  username: root
+  password: example
+  address: "mongodb://localhost:27017"
+  db-name: staking-api-service
+btc:
+  endpoint: localhost:18332
+  disable-tls: false
+  net-params: testnet
+  rpc-user: rpcuser
+  rpc-pass: rpcpass
+queue:
+  queue_user: guest
+  queue_password: guest
+  url: "localhost:5672"
+  processing_timeout: 5
+  msg_max_retry_attempts: 3
+  requeue_delay_time: 60
+  queue_type: quorum
+metrics:
+  host: 0.0.0.0
+  port: 2112
+`
+
+func TestConfig_DefaultsKeysMissingFromOlderFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	require.NoError(t, os.WriteFile(path, []byte(legacyConfig), 0o600))
+
+	cfg, err := config.New(path)
+	require.NoError(t, err)
+	require.Equal(t, time.Minute, cfg.Poller.LeaseDuration)
+	require.Equal(t, 100, cfg.Poller.BatchSize)
+	require.Equal(t, 8, cfg.Poller.Workers)
+	require.Equal(t, 10, cfg.Poller.MaxFailures)
+	require.Positive(t, cfg.Db.HistoryRetention)
+	require.Positive(t, cfg.Db.DedupWindow)
+	require.Equal(t, 5*time.Second, cfg.Publisher.ConfirmTimeout)
+	require.Equal(t, 5, cfg.Publisher.BreakerFailureThreshold)
+	require.False(t, cfg.LeaderElection.Enabled)
+	require.False(t, cfg.ExpiryValidation.Enabled)
+	require.False(t, cfg.Reorg.Enabled)
+
+	// Explicit values still take precedence over the defaults.
+	overridden := strings.Replace(legacyConfig, "  log-level: debug\n", "  log-level: debug\n  workers: 2\n", 1)
+	require.NoError(t, os.WriteFile(path, []byte(overridden), 0o600))
+	cfg, err = config.New(path)
+	require.NoError(t, err)
+	require.Equal(t, 2, cfg.Poller.Workers)
+}
+
+func TestConfig_ShippedConfigsLoad(t *testing.T) {
+	for _, path := range []string{"../config/config-local.yml", "../config/config-docker.yml"} {
+		cfg, err := config.New(path)
+		require.NoError(t, err, path)
+		// No tag fits every network, the validation is opted into with one.
+		require.False(t, cfg.ExpiryValidation.Enabled, path)
+		require.Empty(t, cfg.ExpiryValidation.Tag, path)
+	}
+}
+
+func TestConfig_ExpiryValidationRequiresTag(t *testing.T) {
+	cfg := config.ExpiryValidationConfig{Enabled: true, UnbondingTime: 100}
+	require.ErrorContains(t, cfg.Validate(), "staking tag is required")
+
+	cfg.Tag = "010203"
+	require.Error(t, cfg.Validate())
+
+	cfg.Tag = "01020304"
+	require.NoError(t, cfg.Validate())
+
+	require.NoError(t, (&config.ExpiryValidationConfig{}).Validate())
+}
+
+func TestConfig_VerifyUnspentRequiresSpendLookups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	verifying := strings.Replace(legacyConfig, "  log-level: debug\n", "  log-level: debug\n  verify-unspent: true\n", 1)
+	require.NoError(t, os.WriteFile(path, []byte(verifying), 0o600))
+	cfg, err := config.New(path)
+	require.NoError(t, err)
+	require.True(t, cfg.Poller.VerifyUnspent)
+	require.Equal(t, config.BackendBitcoind, cfg.Btc.GetBackend())
+
+	electrum := strings.Replace(verifying, "btc:\n", "btc:\n  backend: electrum\n", 1)
+	require.NoError(t, os.WriteFile(path, []byte(electrum), 0o600))
+	_, err = config.New(path)
+	require.ErrorContains(t, err, "verifying unspent outputs is not supported by the electrum btc backend")
+}
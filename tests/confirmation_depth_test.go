@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/babylonchain/staking-queue-client/client"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/db/model"
+	"github.com/babylonchain/staking-expiry-checker/tests/mocks"
+)
+
+func testBtcConfigWithConfirmationDepth(depth uint64) config.BtcConfig {
+	return config.BtcConfig{
+		Endpoint:          "localhost:18332",
+		NetParams:         "testnet",
+		RpcUser:           "rpcuser",
+		RpcPass:           "rpcpass",
+		ConfirmationDepth: &depth,
+	}
+}
+
+func TestProcessExpiredDelegations_ConfirmationDepthSurvivesReorg(t *testing.T) {
+	chain := NewFakeChain(1000)
+
+	_, conn, teardown := setupTestServer(t, &TestServerDependency{
+		ConfigOverrides: &config.Config{
+			Btc: testBtcConfigWithConfirmationDepth(6),
+		},
+		MockBtcClient: chain,
+	})
+	defer teardown()
+
+	confirmed := model.TimeLockDocument{
+		ID:               primitive.NewObjectID(),
+		StakingTxHashHex: "confirmedStakingTxHashHex",
+		ExpireHeight:     994,
+		TxType:           "active",
+	}
+	shallow := model.TimeLockDocument{
+		ID:               primitive.NewObjectID(),
+		StakingTxHashHex: "shallowStakingTxHashHex",
+		ExpireHeight:     995,
+		TxType:           "active",
+	}
+	insertTestDelegations(t, []model.TimeLockDocument{confirmed, shallow})
+
+	// Only the delegation buried under the confirmation depth is emitted.
+	require.Eventually(
+		t, func() bool {
+			count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+			return err == nil && count == 1
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+
+	// Reorg the tip backwards, the shallow delegation must still not be emitted.
+	chain.SetTip(998)
+	require.True(t, chain.WaitForPolls(2, 10*time.Second))
+	count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	docs := fetchAllTestDelegations(t)
+	require.Len(t, docs, 1)
+	require.Equal(t, shallow.ID, docs[0].ID)
+
+	// Once the chain grows past the confirmation depth again the remaining delegation is emitted.
+	chain.SetTip(1001)
+	require.Eventually(
+		t, func() bool {
+			count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+			return err == nil && count == 2
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+	require.Empty(t, fetchAllTestDelegations(t))
+}
+
+func TestProcessExpiredDelegations_QueriesConfirmedHeight(t *testing.T) {
+	mockDB := new(mocks.DbInterface)
+	chain := NewFakeChain(1000)
+
+	mockDB.On("ArchivePublishedDelegations", mock.Anything, mock.Anything).Return(int64(0), nil)
+	mockDB.On("ClaimExpiredDelegations", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return([]model.TimeLockDocument{}, nil)
+
+	_, _, teardown := setupTestServer(t, &TestServerDependency{
+		ConfigOverrides: &config.Config{
+			Btc: testBtcConfigWithConfirmationDepth(6),
+		},
+		MockDbClient:  mockDB,
+		MockBtcClient: chain,
+	})
+	defer teardown()
+
+	require.True(t, chain.WaitForPolls(2, 10*time.Second))
+	mockDB.AssertCalled(t, "ClaimExpiredDelegations", mock.Anything, uint64(994), mock.Anything, mock.Anything, mock.Anything)
+
+	// The tip moving backwards lowers the queried height accordingly.
+	chain.SetTip(997)
+	require.True(t, chain.WaitForPolls(2, 10*time.Second))
+	mockDB.AssertCalled(t, "ClaimExpiredDelegations", mock.Anything, uint64(991), mock.Anything, mock.Anything, mock.Anything)
+	mockDB.AssertNotCalled(t, "ClaimExpiredDelegations", mock.Anything, uint64(997), mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestProcessExpiredDelegations_TipBelowConfirmationDepth(t *testing.T) {
+	mockDB := new(mocks.DbInterface)
+	chain := NewFakeChain(3)
+
+	_, _, teardown := setupTestServer(t, &TestServerDependency{
+		ConfigOverrides: &config.Config{
+			Btc: testBtcConfigWithConfirmationDepth(6),
+		},
+		MockDbClient:  mockDB,
+		MockBtcClient: chain,
+	})
+	defer teardown()
+
+	require.True(t, chain.WaitForPolls(2, 10*time.Second))
+	mockDB.AssertNotCalled(t, "ClaimExpiredDelegations", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestBtcConfig_GetConfirmationDepth(t *testing.T) {
+	zero, three := uint64(0), uint64(3)
+	for _, tc := range []struct {
+		net      string
+		depth    *uint64
+		expected uint64
+	}{
+		{net: "mainnet", expected: 6},
+		{net: "testnet", expected: 6},
+		{net: "signet", expected: 3},
+		{net: "regtest", expected: 0},
+		// An explicit depth, including 0, overrides the network default.
+		{net: "mainnet", depth: &zero, expected: 0},
+		{net: "testnet", depth: &three, expected: 3},
+	} {
+		cfg := config.BtcConfig{NetParams: tc.net, ConfirmationDepth: tc.depth}
+		require.Equal(t, tc.expected, cfg.GetConfirmationDepth(), tc.net)
+	}
+}
@@ -0,0 +1,259 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/babylonchain/staking-queue-client/client"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/db"
+	"github.com/babylonchain/staking-expiry-checker/internal/db/model"
+	"github.com/babylonchain/staking-expiry-checker/tests/mocks"
+)
+
+func TestProcessExpiredDelegations_PoisonDocumentDoesNotBlockOthers(t *testing.T) {
+	mockDB := new(mocks.DbInterface)
+	mockBtc := new(mocks.BtcInterface)
+	mockBtc.On("GetBlockCount", mock.Anything).Return(int64(1000), nil)
+
+	poison := model.TimeLockDocument{
+		ID:        primitive.NewObjectID(),
+		DecodeErr: errors.New("cannot decode string into an integer type"),
+	}
+	healthy := model.TimeLockDocument{
+		ID:               primitive.NewObjectID(),
+		StakingTxHashHex: "mockStakingTxHashHex",
+		ExpireHeight:     999,
+		TxType:           "active",
+	}
+
+	mockDB.On("ArchivePublishedDelegations", mock.Anything, mock.Anything).Return(int64(0), nil)
+	mockDB.On("IsEventPublished", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+	mockDB.On("ClaimExpiredDelegations", mock.Anything, uint64(1000), mock.Anything, mock.Anything, mock.Anything).
+		Return([]model.TimeLockDocument{poison, healthy}, nil).Once()
+	mockDB.On("ClaimExpiredDelegations", mock.Anything, uint64(1000), mock.Anything, mock.Anything, mock.Anything).
+		Return([]model.TimeLockDocument{}, nil)
+	mockDB.On("RecordDelegationFailure", mock.Anything, poison.ID, mock.Anything, poison.DecodeErr, true, mock.Anything, mock.Anything).
+		Return(true, nil)
+	mockDB.On("MarkDelegationPublished", mock.Anything, healthy.ID, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	mockDB.On("ArchiveExpiredDelegation", mock.Anything, healthy.ID, mock.Anything).Return(nil)
+
+	_, conn, teardown := setupTestServer(t, &TestServerDependency{
+		MockDbClient:  mockDB,
+		MockBtcClient: mockBtc,
+	})
+	defer teardown()
+
+	require.Eventually(
+		t, func() bool {
+			count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+			return err == nil && count == 1
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+	mockDB.AssertCalled(t, "RecordDelegationFailure", mock.Anything, poison.ID, mock.Anything, poison.DecodeErr, true, mock.Anything, mock.Anything)
+	mockDB.AssertNotCalled(t, "MarkDelegationPublished", mock.Anything, poison.ID, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestProcessExpiredDelegations_MovesUndecodableDocumentToDeadLetter(t *testing.T) {
+	mockBtc := new(mocks.BtcInterface)
+	mockBtc.On("GetBlockCount", mock.Anything).Return(int64(1000), nil)
+
+	cfg, err := config.New("./config-test.yml")
+	require.NoError(t, err)
+	pollerCfg := cfg.Poller
+	pollerCfg.MaxFailures = 1
+
+	_, conn, teardown := setupTestServer(t, &TestServerDependency{
+		ConfigOverrides: &config.Config{Poller: pollerCfg},
+		MockBtcClient:   mockBtc,
+	})
+	defer teardown()
+
+	poisonID := primitive.NewObjectID()
+	insertRawTestDelegation(t, bson.M{
+		"_id":                 poisonID,
+		"staking_tx_hash_hex": 12345,
+		"expire_height":       999,
+		"tx_type":             "active",
+	})
+	insertTestDelegations(t, []model.TimeLockDocument{
+		{
+			ID:               primitive.NewObjectID(),
+			StakingTxHashHex: "mockStakingTxHashHex",
+			ExpireHeight:     999,
+			TxType:           "active",
+		},
+	})
+
+	require.Eventually(
+		t, func() bool {
+			count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+			return err == nil && count == 1 && countTestDocuments(t, model.TimeLockCollection) == 0
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+
+	dbClient, err := db.New(context.Background(), cfg.Db)
+	require.NoError(t, err)
+	deadLetters, err := dbClient.ListDeadLetters(context.Background(), 10)
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 1)
+	require.Equal(t, poisonID, deadLetters[0].ID)
+	require.Equal(t, int64(1), deadLetters[0].FailureCount)
+	require.NotEmpty(t, deadLetters[0].LastError)
+	require.NotZero(t, deadLetters[0].FirstFailedAt)
+	require.NotZero(t, deadLetters[0].DeadLetteredAt)
+}
+
+func TestRequeueDeadLetter(t *testing.T) {
+	mockBtc := new(mocks.BtcInterface)
+	mockBtc.On("GetBlockCount", mock.Anything).Return(int64(1000), nil)
+
+	_, conn, teardown := setupTestServer(t, &TestServerDependency{
+		MockBtcClient: mockBtc,
+	})
+	defer teardown()
+
+	// A document that failed earlier, e.g. while the queue was unavailable.
+	id := primitive.NewObjectID()
+	document, err := bson.Marshal(model.TimeLockDocument{
+		ID:               id,
+		StakingTxHashHex: "mockStakingTxHashHex",
+		ExpireHeight:     999,
+		TxType:           "active",
+		Status:           model.TimeLockStatusPending,
+		FailureCount:     10,
+		LastError:        "queue unavailable",
+	})
+	require.NoError(t, err)
+	insertRawTestDocument(t, model.TimeLockDeadLetterCollection, model.TimeLockDeadLetterDocument{
+		ID:             id,
+		Document:       document,
+		LastError:      "queue unavailable",
+		FailureCount:   10,
+		DeadLetteredAt: time.Now().Unix(),
+	})
+
+	cfg, err := config.New("./config-test.yml")
+	require.NoError(t, err)
+	dbClient, err := db.New(context.Background(), cfg.Db)
+	require.NoError(t, err)
+	require.NoError(t, dbClient.RequeueDeadLetter(context.Background(), id))
+	require.True(t, db.IsNotFoundError(dbClient.RequeueDeadLetter(context.Background(), id)))
+
+	// The requeued document is processed from scratch.
+	require.Eventually(
+		t, func() bool {
+			count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+			return err == nil && count == 1
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+	require.Zero(t, countTestDocuments(t, model.TimeLockDeadLetterCollection))
+}
+
+func TestRecordDelegationFailure_LostLeaseIsNotDeadLettered(t *testing.T) {
+	cfg, err := config.New("./config-test.yml")
+	require.NoError(t, err)
+	setupTestDB(cfg)
+	dbClient, err := db.New(context.Background(), cfg.Db)
+	require.NoError(t, err)
+
+	// The lease of the failing instance expired and another instance
+	// reclaimed the document, which may publish it.
+	id := primitive.NewObjectID()
+	insertTestDelegations(t, []model.TimeLockDocument{{
+		ID:               id,
+		StakingTxHashHex: "mockStakingTxHashHex",
+		ExpireHeight:     999,
+		TxType:           "active",
+		Status:           model.TimeLockStatusPublishing,
+		LeaseOwner:       "otherInstance",
+		FailureCount:     9,
+	}})
+
+	deadLettered, err := dbClient.RecordDelegationFailure(
+		context.Background(), id, "staleInstance", errors.New("queue unavailable"), true, 10, nil,
+	)
+	require.True(t, db.IsNotFoundError(err))
+	require.False(t, deadLettered)
+	require.Zero(t, countTestDocuments(t, model.TimeLockDeadLetterCollection))
+	require.Equal(t, int64(1), countTestDocuments(t, model.TimeLockCollection))
+
+	// The owner of the lease dead letters it once it failed too often.
+	deadLettered, err = dbClient.RecordDelegationFailure(
+		context.Background(), id, "otherInstance", errors.New("queue unavailable"), true, 10, nil,
+	)
+	require.NoError(t, err)
+	require.True(t, deadLettered)
+	require.Equal(t, int64(1), countTestDocuments(t, model.TimeLockDeadLetterCollection))
+	require.Zero(t, countTestDocuments(t, model.TimeLockCollection))
+}
+
+func TestRecordMaybePublished_DoesNotCountTowardsDeadLetter(t *testing.T) {
+	cfg, err := config.New("./config-test.yml")
+	require.NoError(t, err)
+	setupTestDB(cfg)
+	dbClient, err := db.New(context.Background(), cfg.Db)
+	require.NoError(t, err)
+
+	id := primitive.NewObjectID()
+	insertTestDelegations(t, []model.TimeLockDocument{{
+		ID:               id,
+		StakingTxHashHex: "mockStakingTxHashHex",
+		ExpireHeight:     999,
+		TxType:           "active",
+		Status:           model.TimeLockStatusPublishing,
+		LeaseOwner:       "instance",
+		FailureCount:     9,
+	}})
+
+	err = dbClient.RecordMaybePublished(context.Background(), id, "instance", errors.New("confirm timed out"))
+	require.NoError(t, err)
+	delegations := fetchAllTestDelegations(t)
+	require.Len(t, delegations, 1)
+	require.True(t, delegations[0].MaybePublished)
+	require.Equal(t, int64(9), delegations[0].FailureCount)
+	require.Equal(t, model.TimeLockStatusPublishing, delegations[0].Status)
+	require.Zero(t, countTestDocuments(t, model.TimeLockDeadLetterCollection))
+
+	err = dbClient.RecordMaybePublished(context.Background(), id, "otherInstance", errors.New("confirm timed out"))
+	require.True(t, db.IsNotFoundError(err))
+}
+
+func testDatabase(t *testing.T) *mongo.Database {
+	cfg, err := config.New("./config-test.yml")
+	if err != nil {
+		t.Fatalf("Failed to load test config: %v", err)
+	}
+	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(cfg.Db.Address))
+	if err != nil {
+		t.Fatalf("Failed to connect to db: %v", err)
+	}
+	return client.Database(cfg.Db.DbName)
+}
+
+func insertRawTestDelegation(t *testing.T, doc interface{}) {
+	insertRawTestDocument(t, model.TimeLockCollection, doc)
+}
+
+func insertRawTestDocument(t *testing.T, collection string, doc interface{}) {
+	if _, err := testDatabase(t).Collection(collection).InsertOne(context.Background(), doc); err != nil {
+		t.Fatalf("Failed to insert test document: %v", err)
+	}
+}
+
+func countTestDocuments(t *testing.T, collection string) int64 {
+	count, err := testDatabase(t).Collection(collection).CountDocuments(context.Background(), bson.M{})
+	if err != nil {
+		t.Fatalf("Failed to count test documents: %v", err)
+	}
+	return count
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/btcclient"
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+)
+
+func testElectrumConfig() *config.ElectrumConfig {
+	return &config.ElectrumConfig{
+		RequestTimeout:    time.Second,
+		PingInterval:      200 * time.Millisecond,
+		ReconnectInterval: 50 * time.Millisecond,
+	}
+}
+
+func startTestElectrumClient(t *testing.T, endpoint string) *btcclient.ElectrumClient {
+	client := btcclient.NewElectrumClient(
+		config.BtcEndpointConfig{Endpoint: endpoint, DisableTLS: true}, testElectrumConfig(),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		client.Stop()
+		cancel()
+	})
+	go client.Start(ctx)
+	return client
+}
+
+func requireElectrumTip(t *testing.T, client *btcclient.ElectrumClient, expected int64) {
+	require.Eventually(
+		t, func() bool {
+			tip, err := client.GetBlockCount(context.Background())
+			return err == nil && tip == expected
+		}, 5*time.Second, 20*time.Millisecond,
+	)
+}
+
+func TestElectrumClient_TracksPushedTip(t *testing.T) {
+	initTestMetrics(t)
+	server := NewFakeElectrumServer(t, 1000)
+	client := startTestElectrumClient(t, server.Endpoint())
+
+	requireElectrumTip(t, client, 1000)
+	select {
+	case <-client.Notifications():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a notification for the initial tip")
+	}
+
+	server.SetTip(1001)
+	select {
+	case <-client.Notifications():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a notification for the pushed tip")
+	}
+	requireElectrumTip(t, client, 1001)
+	require.Equal(t, 1, server.Subscribers())
+}
+
+func TestElectrumClient_NotConnected(t *testing.T) {
+	initTestMetrics(t)
+	server := NewFakeElectrumServer(t, 1000)
+	client := btcclient.NewElectrumClient(
+		config.BtcEndpointConfig{Endpoint: server.Endpoint(), DisableTLS: true}, testElectrumConfig(),
+	)
+
+	// Nothing is known before the client subscribed.
+	_, err := client.GetBlockCount(context.Background())
+	require.True(t, errors.Is(err, btcclient.ErrElectrumNotConnected))
+}
+
+func TestElectrumClient_ReconnectsAfterDroppedConnection(t *testing.T) {
+	initTestMetrics(t)
+	server := NewFakeElectrumServer(t, 1000)
+	client := startTestElectrumClient(t, server.Endpoint())
+	requireElectrumTip(t, client, 1000)
+
+	server.DropConnections()
+	server.SetTip(1002)
+
+	// The tip pushed after reconnecting is picked up.
+	requireElectrumTip(t, client, 1002)
+	require.GreaterOrEqual(t, server.Subscribers(), 2)
+}
+
+func TestElectrumClient_DetectsHangingServer(t *testing.T) {
+	initTestMetrics(t)
+	server := NewFakeElectrumServer(t, 1000)
+	client := startTestElectrumClient(t, server.Endpoint())
+	requireElectrumTip(t, client, 1000)
+
+	// Unanswered pings fail the connection instead of serving a stale tip.
+	server.SetSilent(true)
+	require.Eventually(
+		t, func() bool {
+			_, err := client.GetBlockCount(context.Background())
+			return errors.Is(err, btcclient.ErrElectrumNotConnected)
+		}, 5*time.Second, 20*time.Millisecond,
+	)
+
+	server.SetSilent(false)
+	requireElectrumTip(t, client, 1000)
+}
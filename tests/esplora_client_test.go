@@ -0,0 +1,261 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/btcclient"
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+)
+
+func testEsploraConfig() *config.HttpRetryConfig {
+	return &config.HttpRetryConfig{
+		RequestTimeout: 200 * time.Millisecond,
+		MaxRetries:     2,
+		RetryBackoff:   10 * time.Millisecond,
+	}
+}
+
+// newFakeEsplora serves the tip height endpoint with the given handler and
+// counts the requests it received.
+func newFakeEsplora(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/blocks/tip/height", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		handler(w, r)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestEsploraClient_GetBlockCount(t *testing.T) {
+	initTestMetrics(t)
+	server, requests := newFakeEsplora(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "840000")
+	})
+
+	client := btcclient.NewEsploraClient(server.URL+"/api/", testEsploraConfig())
+	tip, err := client.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(840000), tip)
+	require.Equal(t, int32(1), requests.Load())
+}
+
+func TestEsploraClient_RetriesServerErrors(t *testing.T) {
+	initTestMetrics(t)
+	var failures atomic.Int32
+	server, requests := newFakeEsplora(t, func(w http.ResponseWriter, r *http.Request) {
+		if failures.Add(1) < 3 {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "840000")
+	})
+
+	client := btcclient.NewEsploraClient(server.URL+"/api", testEsploraConfig())
+	tip, err := client.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(840000), tip)
+	require.Equal(t, int32(3), requests.Load())
+}
+
+func TestEsploraClient_GivesUpAfterMaxRetries(t *testing.T) {
+	initTestMetrics(t)
+	server, requests := newFakeEsplora(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	})
+
+	client := btcclient.NewEsploraClient(server.URL+"/api", testEsploraConfig())
+	_, err := client.GetBlockCount(context.Background())
+	var statusErr *btcclient.HttpStatusError
+	require.True(t, errors.As(err, &statusErr))
+	require.Equal(t, http.StatusTooManyRequests, statusErr.StatusCode)
+	require.Equal(t, int32(3), requests.Load())
+}
+
+func TestEsploraClient_DoesNotRetryClientErrors(t *testing.T) {
+	initTestMetrics(t)
+	server, requests := newFakeEsplora(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+
+	client := btcclient.NewEsploraClient(server.URL+"/api", testEsploraConfig())
+	_, err := client.GetBlockCount(context.Background())
+	require.Error(t, err)
+	require.Equal(t, int32(1), requests.Load())
+}
+
+func TestEsploraClient_TimesOutSlowRequests(t *testing.T) {
+	initTestMetrics(t)
+	server, requests := newFakeEsplora(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	})
+
+	client := btcclient.NewEsploraClient(server.URL+"/api", testEsploraConfig())
+	start := time.Now()
+	_, err := client.GetBlockCount(context.Background())
+	require.Error(t, err)
+	require.Equal(t, int32(3), requests.Load())
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestEsploraClient_RejectsInvalidTip(t *testing.T) {
+	initTestMetrics(t)
+	server, _ := newFakeEsplora(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html>maintenance</html>")
+	})
+
+	client := btcclient.NewEsploraClient(server.URL+"/api", testEsploraConfig())
+	_, err := client.GetBlockCount(context.Background())
+	require.Error(t, err)
+}
+
+// newFakeEsploraTx serves the transaction lookups of a confirmed transaction
+// whose first output is spent as given.
+func newFakeEsploraTx(t *testing.T, tx *wire.MsgTx, spent bool) *httptest.Server {
+	var raw bytes.Buffer
+	require.NoError(t, tx.Serialize(&raw))
+	txID := tx.TxHash().String()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/tx/"+txID+"/hex", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, hex.EncodeToString(raw.Bytes()))
+	})
+	mux.HandleFunc("/api/tx/"+txID, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"vout":[{"scriptpubkey":"%x","value":%d}],"status":{"confirmed":true}}`,
+			tx.TxOut[0].PkScript, tx.TxOut[0].Value)
+	})
+	mux.HandleFunc("/api/tx/"+txID+"/outspend/0", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"spent":%t,"status":{"confirmed":%t}}`, spent, spent)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestEsploraClient_GetRawTransaction(t *testing.T) {
+	initTestMetrics(t)
+	tx := newTestTimeLockTx(1)
+	server := newFakeEsploraTx(t, tx, false)
+
+	client := btcclient.NewEsploraClient(server.URL+"/api/", testEsploraConfig())
+	txHash := tx.TxHash()
+	got, err := client.GetRawTransaction(context.Background(), &txHash)
+	require.NoError(t, err)
+	require.Equal(t, txHash, got.TxHash())
+}
+
+func TestEsploraClient_GetTxOut(t *testing.T) {
+	initTestMetrics(t)
+	tx := newTestTimeLockTx(1)
+	txHash := tx.TxHash()
+
+	unspent := btcclient.NewEsploraClient(newFakeEsploraTx(t, tx, false).URL+"/api/", testEsploraConfig())
+	out, err := unspent.GetTxOut(context.Background(), &txHash, 0)
+	require.NoError(t, err)
+	require.Equal(t, tx.TxOut[0], out)
+
+	// Out of range outputs do not exist.
+	out, err = unspent.GetTxOut(context.Background(), &txHash, 1)
+	require.NoError(t, err)
+	require.Nil(t, out)
+
+	spent := btcclient.NewEsploraClient(newFakeEsploraTx(t, tx, true).URL+"/api/", testEsploraConfig())
+	out, err = spent.GetTxOut(context.Background(), &txHash, 0)
+	require.NoError(t, err)
+	require.Nil(t, out)
+
+	// Unknown transactions are reported as not found.
+	otherHash := newTestTimeLockTx(2).TxHash()
+	out, err = spent.GetTxOut(context.Background(), &otherHash, 0)
+	require.NoError(t, err)
+	require.Nil(t, out)
+}
+
+func TestEsploraClient_GetTxBlockHeight(t *testing.T) {
+	initTestMetrics(t)
+	confirmedHash := newTestTimeLockTx(1).TxHash()
+	pendingHash := newTestTimeLockTx(2).TxHash()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/tx/"+confirmedHash.String()+"/status", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"confirmed":true,"block_height":840000}`)
+	})
+	mux.HandleFunc("/api/tx/"+pendingHash.String()+"/status", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"confirmed":false}`)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := btcclient.NewEsploraClient(server.URL+"/api/", testEsploraConfig())
+	height, err := client.GetTxBlockHeight(context.Background(), &confirmedHash)
+	require.NoError(t, err)
+	require.Equal(t, int64(840000), height)
+
+	_, err = client.GetTxBlockHeight(context.Background(), &pendingHash)
+	require.ErrorIs(t, err, btcclient.ErrTxNotConfirmed)
+}
+
+func TestEsploraClient_GetTxOutSpendHeight(t *testing.T) {
+	initTestMetrics(t)
+	txHash := newTestTimeLockTx(1).TxHash()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/tx/"+txHash.String()+"/outspend/0", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"spent":true,"status":{"confirmed":true,"block_height":840000}}`)
+	})
+	mux.HandleFunc("/api/tx/"+txHash.String()+"/outspend/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"spent":true,"status":{"confirmed":false}}`)
+	})
+	mux.HandleFunc("/api/tx/"+txHash.String()+"/outspend/2", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"spent":false}`)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := btcclient.NewEsploraClient(server.URL+"/api/", testEsploraConfig())
+	height, err := client.GetTxOutSpendHeight(context.Background(), &txHash, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(840000), height)
+
+	// Spends only seen in the mempool do not count.
+	_, err = client.GetTxOutSpendHeight(context.Background(), &txHash, 1)
+	require.ErrorIs(t, err, btcclient.ErrTxNotConfirmed)
+
+	_, err = client.GetTxOutSpendHeight(context.Background(), &txHash, 2)
+	require.ErrorIs(t, err, btcclient.ErrTxNotConfirmed)
+}
+
+func TestEsploraClient_GetBlockHash(t *testing.T) {
+	initTestMetrics(t)
+	expected := chainhash.Hash{1, 2, 3}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/block-height/840000", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, expected.String())
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client := btcclient.NewEsploraClient(server.URL+"/api/", testEsploraConfig())
+	hash, err := client.GetBlockHash(context.Background(), 840000)
+	require.NoError(t, err)
+	require.Equal(t, expected, *hash)
+
+	_, err = client.GetBlockHash(context.Background(), 840001)
+	require.Error(t, err)
+}
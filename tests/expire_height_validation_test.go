@@ -0,0 +1,194 @@
+package tests
+
+import (
+	"context"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/babylonchain/staking-queue-client/client"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/db/model"
+	"github.com/babylonchain/staking-expiry-checker/internal/staking"
+)
+
+var testStakingTag = []byte{0x01, 0x02, 0x03, 0x04}
+
+// newTestStakingTx creates a staking transaction whose OP_RETURN output
+// carries the given tag and staking time, made unique by the unique byte.
+func newTestStakingTx(t *testing.T, tag []byte, stakingTime uint16, unique byte) *wire.MsgTx {
+	data := append([]byte{}, tag...)
+	data = append(data, 0)                   // version
+	data = append(data, make([]byte, 64)...) // staker and finality provider keys
+	data = binary.BigEndian.AppendUint16(data, stakingTime)
+	opReturn, err := txscript.NullDataScript(data)
+	require.NoError(t, err)
+
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{unique}, 0), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(100000, []byte{0x51}))
+	tx.AddTxOut(wire.NewTxOut(0, opReturn))
+	return tx
+}
+
+func TestParseStakingTime(t *testing.T) {
+	stakingTime, err := staking.ParseStakingTime(newTestStakingTx(t, testStakingTag, 64000, 1), testStakingTag)
+	require.NoError(t, err)
+	require.Equal(t, uint16(64000), stakingTime)
+
+	// Staking data of another tag is ignored.
+	_, err = staking.ParseStakingTime(newTestStakingTx(t, []byte{9, 9, 9, 9}, 64000, 1), testStakingTag)
+	require.ErrorIs(t, err, staking.ErrNoStakingData)
+
+	_, err = staking.ParseStakingTime(newTestTimeLockTx(1), testStakingTag)
+	require.ErrorIs(t, err, staking.ErrNoStakingData)
+
+	_, err = staking.ParseStakingTime(newTestStakingTx(t, testStakingTag, 0, 1), testStakingTag)
+	require.Error(t, err)
+}
+
+func testExpiryValidationConfig() config.ExpiryValidationConfig {
+	return config.ExpiryValidationConfig{
+		Enabled:       true,
+		Tag:           "01020304",
+		UnbondingTime: 100,
+	}
+}
+
+func TestProcessExpiredDelegations_QuarantinesExpireHeightMismatch(t *testing.T) {
+	chain := NewFakeChain(1000)
+	validTx := newTestStakingTx(t, testStakingTag, 90, 1)
+	earlyTx := newTestStakingTx(t, testStakingTag, 90, 2)
+	unbondingTx := newTestTimeLockTx(3)
+	chain.AddTx(validTx, 900)
+	chain.AddTx(earlyTx, 950)
+	chain.AddTx(unbondingTx, 899)
+
+	_, conn, teardown := setupTestServer(t, &TestServerDependency{
+		ConfigOverrides: &config.Config{ExpiryValidation: testExpiryValidationConfig()},
+		MockBtcClient:   chain,
+	})
+	defer teardown()
+
+	valid := model.TimeLockDocument{
+		ID:               primitive.NewObjectID(),
+		StakingTxHashHex: validTx.TxHash().String(),
+		ExpireHeight:     990,
+		TxType:           model.TimeLockTxTypeActive,
+	}
+	// The indexer claims the delegation expires 50 blocks before its timelock does.
+	early := model.TimeLockDocument{
+		ID:               primitive.NewObjectID(),
+		StakingTxHashHex: earlyTx.TxHash().String(),
+		ExpireHeight:     990,
+		TxType:           model.TimeLockTxTypeActive,
+	}
+	unbonding := model.TimeLockDocument{
+		ID:                 primitive.NewObjectID(),
+		StakingTxHashHex:   "unbondedStakingTxHashHex",
+		UnbondingTxHashHex: unbondingTx.TxHash().String(),
+		ExpireHeight:       999,
+		TxType:             model.TimeLockTxTypeUnbonding,
+	}
+	insertTestDelegations(t, []model.TimeLockDocument{valid, early, unbonding})
+
+	require.Eventually(
+		t, func() bool {
+			return len(fetchAllTestDelegations(t)) == 0
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+	count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	quarantined := fetchQuarantinedDelegations(t)
+	require.Len(t, quarantined, 1)
+	require.Equal(t, early.ID, quarantined[0].ID)
+	require.Equal(t, uint64(1040), quarantined[0].ComputedExpireHeight)
+	require.NotEmpty(t, quarantined[0].Reason)
+	require.NotEmpty(t, quarantined[0].InstanceID)
+}
+
+func TestProcessExpiredDelegations_QuarantinesInvalidStakingTx(t *testing.T) {
+	chain := NewFakeChain(1000)
+	zeroTimeTx := newTestStakingTx(t, testStakingTag, 0, 1)
+	chain.AddTx(zeroTimeTx, 900)
+
+	_, conn, teardown := setupTestServer(t, &TestServerDependency{
+		ConfigOverrides: &config.Config{ExpiryValidation: testExpiryValidationConfig()},
+		MockBtcClient:   chain,
+	})
+	defer teardown()
+
+	delegation := model.TimeLockDocument{
+		ID:               primitive.NewObjectID(),
+		StakingTxHashHex: zeroTimeTx.TxHash().String(),
+		ExpireHeight:     990,
+		TxType:           model.TimeLockTxTypeActive,
+	}
+	insertTestDelegations(t, []model.TimeLockDocument{delegation})
+
+	require.Eventually(
+		t, func() bool {
+			return len(fetchQuarantinedDelegations(t)) == 1
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+	require.Empty(t, fetchAllTestDelegations(t))
+	require.Zero(t, fetchQuarantinedDelegations(t)[0].ComputedExpireHeight)
+	count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
+
+func TestProcessExpiredDelegations_RetriesStakingTxWithoutStakingData(t *testing.T) {
+	chain := NewFakeChain(1000)
+	untaggedTx := newTestTimeLockTx(1)
+	chain.AddTx(untaggedTx, 900)
+
+	_, conn, teardown := setupTestServer(t, &TestServerDependency{
+		ConfigOverrides: &config.Config{ExpiryValidation: testExpiryValidationConfig()},
+		MockBtcClient:   chain,
+	})
+	defer teardown()
+
+	// The staking data may be missing only because the configured tag is
+	// not the one of the network, the document is kept for a retry.
+	delegation := model.TimeLockDocument{
+		ID:               primitive.NewObjectID(),
+		StakingTxHashHex: untaggedTx.TxHash().String(),
+		ExpireHeight:     990,
+		TxType:           model.TimeLockTxTypeActive,
+	}
+	insertTestDelegations(t, []model.TimeLockDocument{delegation})
+
+	require.Eventually(
+		t, func() bool {
+			delegations := fetchAllTestDelegations(t)
+			return len(delegations) == 1 && delegations[0].FailureCount > 0
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+	require.Contains(t, fetchAllTestDelegations(t)[0].LastError, staking.ErrNoStakingData.Error())
+	require.Empty(t, fetchQuarantinedDelegations(t))
+	count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
+
+func fetchQuarantinedDelegations(t *testing.T) []model.TimeLockQuarantineDocument {
+	cursor, err := testDatabase(t).Collection(model.TimeLockQuarantineCollection).Find(context.Background(), bson.M{})
+	if err != nil {
+		t.Fatalf("Failed to fetch quarantined delegations: %v", err)
+	}
+	var quarantined []model.TimeLockQuarantineDocument
+	if err := cursor.All(context.Background(), &quarantined); err != nil {
+		t.Fatalf("Failed to decode quarantined delegations: %v", err)
+	}
+	return quarantined
+}
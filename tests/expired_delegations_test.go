@@ -17,7 +17,7 @@ func TestProcessExpiredDelegations_NoErrors(t *testing.T) {
 	// setup mock btc client
 	mockBtc := new(mocks.BtcInterface)
 	expectedBtcTip := int64(1000)
-	mockBtc.On("GetBlockCount").Return(expectedBtcTip, nil)
+	mockBtc.On("GetBlockCount", mock.Anything).Return(expectedBtcTip, nil)
 
 	// assert that db is empty
 	docs := fetchAllTestDelegations(t)
@@ -66,7 +66,7 @@ func TestProcessExpiredDelegations_ErrorGettingBlockCount(t *testing.T) {
 	mockDB := new(mocks.DbInterface)
 	mockBtc := new(mocks.BtcInterface)
 
-	mockBtc.On("GetBlockCount").Return(int64(0), errors.New("failed to get block count"))
+	mockBtc.On("GetBlockCount", mock.Anything).Return(int64(0), errors.New("failed to get block count"))
 
 	_, conn, teardown := setupTestServer(t, &TestServerDependency{
 		MockDbClient:  mockDB,
@@ -88,9 +88,10 @@ func TestProcessExpiredDelegations_ErrorFindingExpiredDelegations(t *testing.T)
 	mockBtc := new(mocks.BtcInterface)
 
 	expectedBtcTip := int64(1000)
-	mockBtc.On("GetBlockCount").Return(expectedBtcTip, nil)
+	mockBtc.On("GetBlockCount", mock.Anything).Return(expectedBtcTip, nil)
 
-	mockDB.On("FindExpiredDelegations", mock.Anything, uint64(expectedBtcTip)).
+	mockDB.On("ArchivePublishedDelegations", mock.Anything, mock.Anything).Return(int64(0), nil)
+	mockDB.On("ClaimExpiredDelegations", mock.Anything, uint64(expectedBtcTip), mock.Anything, mock.Anything, mock.Anything).
 		Return(nil, errors.New("database error"))
 
 	_, conn, teardown := setupTestServer(t, &TestServerDependency{
@@ -108,12 +109,12 @@ func TestProcessExpiredDelegations_ErrorFindingExpiredDelegations(t *testing.T)
 	)
 }
 
-func TestProcessExpiredDelegations_ErrorDeletingExpiredDelegation(t *testing.T) {
+func TestProcessExpiredDelegations_ErrorArchivingExpiredDelegation(t *testing.T) {
 	mockDB := new(mocks.DbInterface)
 	mockBtc := new(mocks.BtcInterface)
 
 	expectedBtcTip := int64(1000)
-	mockBtc.On("GetBlockCount").Return(expectedBtcTip, nil)
+	mockBtc.On("GetBlockCount", mock.Anything).Return(expectedBtcTip, nil)
 
 	// Create an ObjectID for testing purposes
 	testID, _ := primitive.ObjectIDFromHex("507f1f77bcf86cd799439011")
@@ -124,10 +125,17 @@ func TestProcessExpiredDelegations_ErrorDeletingExpiredDelegation(t *testing.T)
 		TxType:           "active",
 	}
 
-	mockDB.On("FindExpiredDelegations", mock.Anything, uint64(expectedBtcTip)).
-		Return([]model.TimeLockDocument{expiredDelegation}, nil)
-	mockDB.On("DeleteExpiredDelegation", mock.Anything, testID).
-		Return(errors.New("delete error"))
+	mockDB.On("ArchivePublishedDelegations", mock.Anything, mock.Anything).Return(int64(0), nil)
+	mockDB.On("IsEventPublished", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+	mockDB.On("ClaimExpiredDelegations", mock.Anything, uint64(expectedBtcTip), mock.Anything, mock.Anything, mock.Anything).
+		Return([]model.TimeLockDocument{expiredDelegation}, nil).Once()
+	// Once published, the document is no longer claimable.
+	mockDB.On("ClaimExpiredDelegations", mock.Anything, uint64(expectedBtcTip), mock.Anything, mock.Anything, mock.Anything).
+		Return([]model.TimeLockDocument{}, nil)
+	mockDB.On("MarkDelegationPublished", mock.Anything, testID, mock.Anything, uint64(expectedBtcTip), true, mock.Anything).
+		Return(nil)
+	mockDB.On("ArchiveExpiredDelegation", mock.Anything, testID, mock.Anything).
+		Return(errors.New("archive error"))
 
 	_, conn, teardown := setupTestServer(t, &TestServerDependency{
 		MockDbClient:  mockDB,
@@ -135,11 +143,53 @@ func TestProcessExpiredDelegations_ErrorDeletingExpiredDelegation(t *testing.T)
 	})
 	defer teardown()
 
-	// Verify the process handles the error as expected
+	// A failed archive does not undo the publish, the event is emitted exactly once.
 	require.Eventually(
 		t, func() bool {
 			expiredQueueMessageCount, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
-			return err == nil && expiredQueueMessageCount == 0
+			return err == nil && expiredQueueMessageCount == 1
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+	mockDB.AssertNumberOfCalls(t, "MarkDelegationPublished", 1)
+}
+
+func TestProcessExpiredDelegations_ResumesOutbox(t *testing.T) {
+	mockBtc := new(mocks.BtcInterface)
+	expectedBtcTip := int64(1000)
+	mockBtc.On("GetBlockCount", mock.Anything).Return(expectedBtcTip, nil)
+
+	_, conn, teardown := setupTestServer(t, &TestServerDependency{
+		MockBtcClient: mockBtc,
+	})
+	defer teardown()
+
+	// Documents left behind by a crashed run, one interrupted while publishing
+	// and one that was published but not archived.
+	insertTestDelegations(t, []model.TimeLockDocument{
+		{
+			ID:               primitive.NewObjectID(),
+			StakingTxHashHex: "mockStakingTxHashHexPublishing",
+			ExpireHeight:     999,
+			TxType:           "active",
+			Status:           model.TimeLockStatusPublishing,
+			LeaseOwner:       "crashedInstance",
+			LeaseExpiresAt:   time.Now().Add(-time.Minute).Unix(),
+		},
+		{
+			ID:               primitive.NewObjectID(),
+			StakingTxHashHex: "mockStakingTxHashHexPublished",
+			ExpireHeight:     999,
+			TxType:           "active",
+			Status:           model.TimeLockStatusPublished,
+			PublishedAt:      time.Now().Unix(),
+		},
+	})
+
+	// Only the interrupted document is published again.
+	require.Eventually(
+		t, func() bool {
+			expiredQueueMessageCount, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+			return err == nil && expiredQueueMessageCount == 1 && len(fetchAllTestDelegations(t)) == 0
 		}, 10*time.Second, 100*time.Millisecond,
 	)
 }
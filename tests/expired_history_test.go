@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/babylonchain/staking-queue-client/client"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/db"
+	"github.com/babylonchain/staking-expiry-checker/internal/db/model"
+	"github.com/babylonchain/staking-expiry-checker/tests/mocks"
+)
+
+func TestProcessExpiredDelegations_ArchivesPublishedDelegations(t *testing.T) {
+	mockBtc := new(mocks.BtcInterface)
+	mockBtc.On("GetBlockCount", mock.Anything).Return(int64(1000), nil)
+
+	_, conn, teardown := setupTestServer(t, &TestServerDependency{
+		MockBtcClient: mockBtc,
+	})
+	defer teardown()
+
+	delegation := model.TimeLockDocument{
+		ID:               primitive.NewObjectID(),
+		StakingTxHashHex: "mockStakingTxHashHex",
+		ExpireHeight:     999,
+		TxType:           "active",
+	}
+	insertTestDelegations(t, []model.TimeLockDocument{delegation})
+
+	require.Eventually(
+		t, func() bool {
+			count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+			return err == nil && count == 1 && len(fetchAllTestDelegations(t)) == 0
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+
+	history := fetchExpiredHistory(t)
+	require.Len(t, history, 1)
+	require.Equal(t, delegation.ID, history[0].TimeLockID)
+	require.Equal(t, delegation.StakingTxHashHex, history[0].StakingTxHashHex)
+	require.Equal(t, delegation.TxType, history[0].TxType)
+	require.Equal(t, delegation.ExpireHeight, history[0].ExpireHeight)
+	require.Equal(t, uint64(1000), history[0].TipHeight)
+	require.NotEmpty(t, history[0].InstanceID)
+	require.NotZero(t, history[0].PublishedAt)
+	require.False(t, history[0].ArchivedAt.IsZero())
+}
+
+func TestExpiredHistory_RetentionIndex(t *testing.T) {
+	cfg, err := config.New("./config-test.yml")
+	require.NoError(t, err)
+	setupTestDB(cfg)
+
+	_, err = db.New(context.Background(), cfg.Db)
+	require.NoError(t, err)
+	require.Equal(t, int32(cfg.Db.HistoryRetention.Seconds()), fetchHistoryTTL(t))
+
+	// A changed retention is applied to the existing index.
+	cfg.Db.HistoryRetention = time.Hour
+	_, err = db.New(context.Background(), cfg.Db)
+	require.NoError(t, err)
+	require.Equal(t, int32(3600), fetchHistoryTTL(t))
+}
+
+func fetchExpiredHistory(t *testing.T) []model.ExpiredHistoryDocument {
+	cursor, err := testDatabase(t).Collection(model.ExpiredHistoryCollection).Find(context.Background(), bson.M{})
+	if err != nil {
+		t.Fatalf("Failed to fetch expired history: %v", err)
+	}
+	var history []model.ExpiredHistoryDocument
+	if err := cursor.All(context.Background(), &history); err != nil {
+		t.Fatalf("Failed to decode expired history: %v", err)
+	}
+	return history
+}
+
+func fetchHistoryTTL(t *testing.T) int32 {
+	cursor, err := testDatabase(t).Collection(model.ExpiredHistoryCollection).Indexes().List(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to list expired history indexes: %v", err)
+	}
+	var indexes []struct {
+		Key                bson.D `bson:"key"`
+		ExpireAfterSeconds *int32 `bson:"expireAfterSeconds"`
+	}
+	if err := cursor.All(context.Background(), &indexes); err != nil {
+		t.Fatalf("Failed to decode expired history indexes: %v", err)
+	}
+	for _, index := range indexes {
+		if len(index.Key) == 1 && index.Key[0].Key == "archived_at" && index.ExpireAfterSeconds != nil {
+			return *index.ExpireAfterSeconds
+		}
+	}
+	t.Fatal("expired history TTL index not found")
+	return 0
+}
@@ -0,0 +1,140 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// defaultFakeBabylonPageLimit is the page size of the main chain when the
+// request does not limit it, as on a Babylon node.
+const defaultFakeBabylonPageLimit = 100
+
+// FakeBabylonNode stands in for the REST API of a Babylon node, serving the
+// tip and the main chain of its BTC light client and the sync state of the node.
+type FakeBabylonNode struct {
+	server *httptest.Server
+
+	mu         sync.Mutex
+	baseHeight uint64
+	chain      []*wire.BlockHeader // headers from the base height on
+	syncing    bool
+	failures   int
+	requests   map[string]int
+}
+
+// NewFakeBabylonNode serves the light client chain, whose first header is at the base height.
+func NewFakeBabylonNode(t *testing.T, baseHeight uint64, chain []*wire.BlockHeader) *FakeBabylonNode {
+	n := &FakeBabylonNode{
+		baseHeight: baseHeight,
+		chain:      chain,
+		requests:   make(map[string]int),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/babylon/btclightclient/v1/tip", n.handle(n.tip))
+	mux.HandleFunc("/babylon/btclightclient/v1/mainchain", n.handle(n.mainChain))
+	mux.HandleFunc("/cosmos/base/tendermint/v1beta1/syncing", n.handle(n.syncStatus))
+	n.server = httptest.NewServer(mux)
+	t.Cleanup(n.server.Close)
+	return n
+}
+
+// URL returns the base URL of the REST API.
+func (n *FakeBabylonNode) URL() string {
+	return n.server.URL
+}
+
+// SetChain replaces the light client chain from the base height on, e.g. to
+// extend it or to reorg it.
+func (n *FakeBabylonNode) SetChain(chain []*wire.BlockHeader) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.chain = chain
+}
+
+// SetSyncing reports the node as catching up with its chain or synced.
+func (n *FakeBabylonNode) SetSyncing(syncing bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.syncing = syncing
+}
+
+// FailNext answers the next requests with a server error.
+func (n *FakeBabylonNode) FailNext(failures int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.failures = failures
+}
+
+// Requests returns how often the path was requested.
+func (n *FakeBabylonNode) Requests(path string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.requests[path]
+}
+
+func (n *FakeBabylonNode) handle(
+	answer func(r *http.Request) interface{},
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		n.requests[r.URL.Path]++
+		if n.failures > 0 {
+			n.failures--
+			http.Error(w, `{"code":14,"message":"node is overloaded"}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(answer(r))
+	}
+}
+
+func (n *FakeBabylonNode) tip(r *http.Request) interface{} {
+	tip := len(n.chain) - 1
+	return map[string]interface{}{"header": n.headerInfo(tip)}
+}
+
+// mainChain serves the headers from the tip down, as a Babylon node does
+// without a pagination key.
+func (n *FakeBabylonNode) mainChain(r *http.Request) interface{} {
+	limit := defaultFakeBabylonPageLimit
+	if raw := r.URL.Query().Get("pagination.limit"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+	headers := make([]interface{}, 0, limit)
+	for i := len(n.chain) - 1; i >= 0 && len(headers) < limit; i-- {
+		headers = append(headers, n.headerInfo(i))
+	}
+	return map[string]interface{}{
+		"headers":    headers,
+		"pagination": map[string]interface{}{"next_key": nil, "total": "0"},
+	}
+}
+
+func (n *FakeBabylonNode) syncStatus(r *http.Request) interface{} {
+	return map[string]interface{}{"syncing": n.syncing}
+}
+
+// headerInfo encodes the header at the index like the REST API does, with
+// 64 bit integers as strings.
+func (n *FakeBabylonNode) headerInfo(index int) map[string]interface{} {
+	header := n.chain[index]
+	var raw bytes.Buffer
+	_ = header.Serialize(&raw)
+	return map[string]interface{}{
+		"header_hex": hex.EncodeToString(raw.Bytes()),
+		"hash_hex":   header.BlockHash().String(),
+		"height":     strconv.FormatUint(n.baseHeight+uint64(index), 10),
+		"work":       "2",
+	}
+}
@@ -0,0 +1,268 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/babylonchain/staking-queue-client/client"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/btcclient"
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/db/model"
+	"github.com/babylonchain/staking-expiry-checker/internal/fakebtc"
+)
+
+// newFakeBitcoindClient creates the real rpc client of the checker for the fake node.
+func newFakeBitcoindClient(t *testing.T, fake *fakebtc.Server) *btcclient.BtcClient {
+	cfg := &config.BtcConfig{NetParams: "regtest"}
+	fake.Configure(cfg)
+	client, err := btcclient.NewBtcClient(cfg)
+	require.NoError(t, err)
+	return client
+}
+
+func TestFakeBitcoind_ScriptedTips(t *testing.T) {
+	initTestMetrics(t)
+	fake := fakebtc.NewServer(100)
+	t.Cleanup(fake.Close)
+	client := newFakeBitcoindClient(t, fake)
+
+	// Scripted tips are answered in order, the last one sticks.
+	fake.ScriptTips(101, 103, 102)
+	for _, expected := range []int64{101, 103, 102, 102} {
+		tip, err := client.GetBlockCount(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, expected, tip)
+	}
+	require.Equal(t, 4, fake.Calls("getblockcount"))
+
+	fake.SetTip(200)
+	tip, err := client.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(200), tip)
+}
+
+func TestFakeBitcoind_AutoMine(t *testing.T) {
+	initTestMetrics(t)
+	fake := fakebtc.NewServer(100)
+	t.Cleanup(fake.Close)
+	client := newFakeBitcoindClient(t, fake)
+
+	fake.AutoMine(10 * time.Millisecond)
+	require.Eventually(t, func() bool {
+		tip, err := client.GetBlockCount(context.Background())
+		return err == nil && tip >= 103
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestFakeBitcoind_FailNext(t *testing.T) {
+	initTestMetrics(t)
+	fake := fakebtc.NewServer(100)
+	t.Cleanup(fake.Close)
+	client := newFakeBitcoindClient(t, fake)
+
+	fake.FailNext("getblockcount", 2, &btcjson.RPCError{
+		Code:    btcjson.ErrRPCInWarmup,
+		Message: "Loading block index...",
+	})
+	for i := 0; i < 2; i++ {
+		_, err := client.GetBlockCount(context.Background())
+		var rpcErr *btcjson.RPCError
+		require.True(t, errors.As(err, &rpcErr))
+		require.Equal(t, btcjson.ErrRPCInWarmup, rpcErr.Code)
+	}
+	tip, err := client.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(100), tip)
+}
+
+func TestFakeBitcoind_RejectAuth(t *testing.T) {
+	initTestMetrics(t)
+	fake := fakebtc.NewServer(100)
+	t.Cleanup(fake.Close)
+	client := newFakeBitcoindClient(t, fake)
+
+	fake.RejectAuth(true)
+	_, err := client.GetBlockCount(context.Background())
+	require.ErrorIs(t, err, btcclient.ErrRpcUnauthorized)
+
+	fake.RejectAuth(false)
+	_, err = client.GetBlockCount(context.Background())
+	require.NoError(t, err)
+}
+
+func TestFakeBitcoind_Transactions(t *testing.T) {
+	initTestMetrics(t)
+	fake := fakebtc.NewServer(1000)
+	t.Cleanup(fake.Close)
+	client := newFakeBitcoindClient(t, fake)
+
+	tx := newTestTimeLockTx(1)
+	txHash := tx.TxHash()
+	fake.AddTx(tx, 900)
+
+	fetched, err := client.GetRawTransaction(context.Background(), &txHash)
+	require.NoError(t, err)
+	require.Equal(t, txHash, fetched.TxHash())
+
+	height, err := client.GetTxBlockHeight(context.Background(), &txHash)
+	require.NoError(t, err)
+	require.Equal(t, int64(900), height)
+
+	out, err := client.GetTxOut(context.Background(), &txHash, 0)
+	require.NoError(t, err)
+	require.NotNil(t, out)
+	require.Equal(t, tx.TxOut[0].Value, out.Value)
+	require.Equal(t, tx.TxOut[0].PkScript, out.PkScript)
+
+	fake.SpendOutput(txHash, 0, 950)
+	out, err = client.GetTxOut(context.Background(), &txHash, 0)
+	require.NoError(t, err)
+	require.Nil(t, out)
+
+	// Unknown transactions are answered like bitcoind does.
+	unknown := chainhash.Hash{0xff}
+	_, err = client.GetRawTransaction(context.Background(), &unknown)
+	var rpcErr *btcjson.RPCError
+	require.True(t, errors.As(err, &rpcErr))
+	require.Equal(t, btcjson.ErrRPCNoTxInfo, rpcErr.Code)
+	out, err = client.GetTxOut(context.Background(), &unknown, 0)
+	require.NoError(t, err)
+	require.Nil(t, out)
+}
+
+func TestBtcClient_GetTxOutSpendHeight(t *testing.T) {
+	initTestMetrics(t)
+	fake := fakebtc.NewServer(1000)
+	t.Cleanup(fake.Close)
+	client := newFakeBitcoindClient(t, fake)
+
+	tx := newTestTimeLockTx(1)
+	tx.AddTxOut(wire.NewTxOut(100000, []byte{0x51}))
+	txHash := tx.TxHash()
+	fake.AddTx(tx, 900)
+
+	// An unspent output has no spend height, without searching any block.
+	_, err := client.GetTxOutSpendHeight(context.Background(), &txHash, 0)
+	require.ErrorIs(t, err, btcclient.ErrTxNotConfirmed)
+	require.Zero(t, fake.Calls("getblock"))
+
+	fake.SpendOutput(txHash, 0, 950)
+	height, err := client.GetTxOutSpendHeight(context.Background(), &txHash, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(950), height)
+	// The blocks following the confirmation are searched up to the spend.
+	require.Equal(t, 50, fake.Calls("getblock"))
+
+	// A spend by a transaction of the block is found just as well.
+	spendingTx := newTestTimeLockTx(2)
+	spendingTx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&txHash, 1), nil, nil))
+	fake.AddTx(spendingTx, 901)
+	height, err = client.GetTxOutSpendHeight(context.Background(), &txHash, 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(901), height)
+
+	// A spend reorged out leaves the output unspent.
+	fake.SetTip(940)
+	_, err = client.GetTxOutSpendHeight(context.Background(), &txHash, 0)
+	require.ErrorIs(t, err, btcclient.ErrTxNotConfirmed)
+}
+
+func TestFakeBitcoind_SyncStatus(t *testing.T) {
+	initTestMetrics(t)
+	fake := fakebtc.NewServer(1000)
+	t.Cleanup(fake.Close)
+	client := newFakeBitcoindClient(t, fake)
+
+	status, err := client.GetSyncStatus(context.Background())
+	require.NoError(t, err)
+	require.False(t, status.IsSyncing())
+
+	fake.SetSyncing(true, 500)
+	status, err = client.GetSyncStatus(context.Background())
+	require.NoError(t, err)
+	require.True(t, status.IsSyncing())
+	require.Equal(t, int64(1000), status.Blocks)
+	require.Equal(t, int64(1500), status.Headers)
+}
+
+func TestProcessExpiredDelegations_FakeBitcoind(t *testing.T) {
+	fake := fakebtc.NewServer(1000)
+	defer fake.Close()
+
+	cfg, err := config.New("./config-test.yml")
+	require.NoError(t, err)
+	btcCfg := cfg.Btc
+	fake.Configure(&btcCfg)
+
+	// No mock, the service talks to the fake node through the real client.
+	_, conn, teardown := setupTestServer(t, &TestServerDependency{
+		ConfigOverrides: &config.Config{Btc: btcCfg},
+	})
+	defer teardown()
+
+	insertTestDelegations(t, []model.TimeLockDocument{
+		{
+			ID:               primitive.NewObjectID(),
+			StakingTxHashHex: newTestTimeLockTx(1).TxHash().String(),
+			ExpireHeight:     999,
+			TxType:           model.TimeLockTxTypeActive,
+		},
+		{
+			ID:               primitive.NewObjectID(),
+			StakingTxHashHex: newTestTimeLockTx(2).TxHash().String(),
+			ExpireHeight:     1001,
+			TxType:           model.TimeLockTxTypeActive,
+		},
+	})
+
+	// Only the delegation expired at the tip of the fake node is published.
+	require.Eventually(
+		t, func() bool {
+			return len(fetchAllTestDelegations(t)) == 1 && len(fetchExpiredHistory(t)) == 1
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+	count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	require.Positive(t, fake.Calls("getblockcount"))
+}
+
+func TestFakeBitcoind_BlockHash(t *testing.T) {
+	initTestMetrics(t)
+	fake := fakebtc.NewServer(1000)
+	t.Cleanup(fake.Close)
+	client := newFakeBitcoindClient(t, fake)
+
+	// The hash of a block is stable and distinct from its neighbours.
+	hash, err := client.GetBlockHash(context.Background(), 1000)
+	require.NoError(t, err)
+	again, err := client.GetBlockHash(context.Background(), 1000)
+	require.NoError(t, err)
+	require.Equal(t, hash, again)
+	parent, err := client.GetBlockHash(context.Background(), 999)
+	require.NoError(t, err)
+	require.NotEqual(t, hash, parent)
+
+	_, err = client.GetBlockHash(context.Background(), 1001)
+	var rpcErr *btcjson.RPCError
+	require.True(t, errors.As(err, &rpcErr))
+
+	// A reorg replaces the blocks from the fork on.
+	fake.Reorg(1000, 1001)
+	reorged, err := client.GetBlockHash(context.Background(), 1000)
+	require.NoError(t, err)
+	require.NotEqual(t, hash, reorged)
+	again, err = client.GetBlockHash(context.Background(), 999)
+	require.NoError(t, err)
+	require.Equal(t, parent, again)
+	_, err = client.GetBlockHash(context.Background(), 1001)
+	require.NoError(t, err)
+}
@@ -0,0 +1,51 @@
+package tests
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"testing"
+
+	"github.com/go-zeromq/zmq4"
+)
+
+// FakeBlockPublisher stands in for the zmqpubhashblock publisher of bitcoind.
+type FakeBlockPublisher struct {
+	socket   zmq4.Socket
+	sequence uint32
+}
+
+func NewFakeBlockPublisher(t *testing.T) *FakeBlockPublisher {
+	socket := zmq4.NewPub(context.Background())
+	if err := socket.Listen("tcp://127.0.0.1:0"); err != nil {
+		t.Fatalf("Failed to start fake block publisher: %v", err)
+	}
+	t.Cleanup(func() {
+		socket.Close()
+	})
+	return &FakeBlockPublisher{socket: socket}
+}
+
+// Endpoint returns the endpoint subscribers connect to.
+func (p *FakeBlockPublisher) Endpoint() string {
+	return "tcp://" + p.socket.Addr().String()
+}
+
+// PublishBlock announces a new block with a random hash.
+func (p *FakeBlockPublisher) PublishBlock(t *testing.T) {
+	hash := make([]byte, 32)
+	if _, err := rand.Read(hash); err != nil {
+		t.Fatalf("Failed to generate block hash: %v", err)
+	}
+	p.publish(t, "hashblock", hash)
+}
+
+func (p *FakeBlockPublisher) publish(t *testing.T, topic string, body []byte) {
+	sequence := make([]byte, 4)
+	binary.LittleEndian.PutUint32(sequence, p.sequence)
+	p.sequence++
+
+	if err := p.socket.SendMulti(zmq4.NewMsgFrom([]byte(topic), body, sequence)); err != nil {
+		t.Fatalf("Failed to publish %s notification: %v", topic, err)
+	}
+}
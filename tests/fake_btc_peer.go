@@ -0,0 +1,196 @@
+package tests
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/peer"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// FakeBtcPeer stands in for a Bitcoin peer on regtest, serving the headers of
+// its chain to the peers connecting to it.
+type FakeBtcPeer struct {
+	listener net.Listener
+
+	mu    sync.Mutex
+	chain []*wire.BlockHeader // headers following the genesis block
+	peers []*peer.Peer
+	// advertisedHeight is sent in the version message instead of the height
+	// of the chain if set.
+	advertisedHeight *int32
+}
+
+func NewFakeBtcPeer(t *testing.T, chain []*wire.BlockHeader) *FakeBtcPeer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start fake btc peer: %v", err)
+	}
+	p := &FakeBtcPeer{listener: listener, chain: chain}
+	t.Cleanup(func() {
+		listener.Close()
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		for _, connected := range p.peers {
+			connected.Disconnect()
+		}
+	})
+	go p.accept()
+	return p
+}
+
+// Address returns the host:port clients connect to.
+func (p *FakeBtcPeer) Address() string {
+	return p.listener.Addr().String()
+}
+
+// SetChain replaces the chain and announces its tip to the connected peers.
+func (p *FakeBtcPeer) SetChain(chain []*wire.BlockHeader) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.chain = chain
+	announcement := wire.NewMsgHeaders()
+	_ = announcement.AddBlockHeader(chain[len(chain)-1])
+	for _, connected := range p.peers {
+		connected.QueueMessage(announcement, nil)
+	}
+}
+
+// AdvertiseHeight makes the peer claim the height in the version message
+// of the peers connecting afterwards, regardless of its chain.
+func (p *FakeBtcPeer) AdvertiseHeight(height int32) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.advertisedHeight = &height
+}
+
+func (p *FakeBtcPeer) accept() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		inbound := peer.NewInboundPeer(&peer.Config{
+			UserAgentName:    "fake-btc-peer",
+			UserAgentVersion: "1.0.0",
+			ChainParams:      &chaincfg.RegressionNetParams,
+			TrickleInterval:  time.Second,
+			// Version nonces are shared within the process, the client would
+			// be mistaken for a connection to ourselves otherwise.
+			AllowSelfConns: true,
+			NewestBlock:    p.newestBlock,
+			Listeners: peer.MessageListeners{
+				OnGetHeaders: p.onGetHeaders,
+			},
+		})
+		inbound.AssociateConnection(conn)
+
+		p.mu.Lock()
+		p.peers = append(p.peers, inbound)
+		p.mu.Unlock()
+	}
+}
+
+// newestBlock returns the tip of the chain, announced to the connecting peers.
+func (p *FakeBtcPeer) newestBlock() (*chainhash.Hash, int32, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	hash := *chaincfg.RegressionNetParams.GenesisHash
+	height := int32(len(p.chain))
+	if len(p.chain) > 0 {
+		hash = p.chain[len(p.chain)-1].BlockHash()
+	}
+	if p.advertisedHeight != nil {
+		height = *p.advertisedHeight
+	}
+	return &hash, height, nil
+}
+
+// onGetHeaders serves the headers following the first locator hash found in the chain.
+func (p *FakeBtcPeer) onGetHeaders(connected *peer.Peer, msg *wire.MsgGetHeaders) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	start := -1
+	for _, hash := range msg.BlockLocatorHashes {
+		if hash.IsEqual(chaincfg.RegressionNetParams.GenesisHash) {
+			start = 0
+			break
+		}
+		if index := p.indexOf(hash); index >= 0 {
+			start = index + 1
+			break
+		}
+	}
+
+	headers := wire.NewMsgHeaders()
+	if start >= 0 {
+		for _, header := range p.chain[start:] {
+			if len(headers.Headers) == wire.MaxBlockHeadersPerMsg {
+				break
+			}
+			_ = headers.AddBlockHeader(header)
+			if header.BlockHash() == msg.HashStop {
+				break
+			}
+		}
+	}
+	connected.QueueMessage(headers, nil)
+}
+
+func (p *FakeBtcPeer) indexOf(hash *chainhash.Hash) int {
+	for i, header := range p.chain {
+		if header.BlockHash() == *hash {
+			return i
+		}
+	}
+	return -1
+}
+
+// mineRegtestHeaders mines count headers on top of parent. The tag makes
+// chains mined on the same parent differ. Headers from invalidFrom onwards
+// have a hash above their target, use -1 for a valid chain.
+func mineRegtestHeaders(
+	parent *wire.BlockHeader, count int, tag string, invalidFrom int,
+) []*wire.BlockHeader {
+	return mineHeaders(parent, count, tag, invalidFrom, chaincfg.RegressionNetParams.PowLimitBits)
+}
+
+func mineHeaders(
+	parent *wire.BlockHeader, count int, tag string, invalidFrom int, bits uint32,
+) []*wire.BlockHeader {
+	headers := make([]*wire.BlockHeader, 0, count)
+	for i := 0; i < count; i++ {
+		header := &wire.BlockHeader{
+			Version:    4,
+			PrevBlock:  parent.BlockHash(),
+			MerkleRoot: chainhash.DoubleHashH([]byte(fmt.Sprintf("%s-%d", tag, i))),
+			Timestamp:  parent.Timestamp.Add(10 * time.Minute),
+			Bits:       bits,
+		}
+		valid := invalidFrom < 0 || i < invalidFrom
+		target := blockchain.CompactToBig(bits)
+		for {
+			hash := header.BlockHash()
+			if (blockchain.HashToBig(&hash).Cmp(target) <= 0) == valid {
+				break
+			}
+			header.Nonce++
+		}
+		headers = append(headers, header)
+		parent = header
+	}
+	return headers
+}
+
+func regtestGenesisHeader() *wire.BlockHeader {
+	return &chaincfg.RegressionNetParams.GenesisBlock.Header
+}
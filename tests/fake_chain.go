@@ -0,0 +1,228 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/btcclient"
+)
+
+// FakeChain is a BtcInterface whose tip height is controlled by the test.
+// The tip can be moved in any direction to simulate block production and reorgs,
+// and the blocks above a height can be replaced by those of another branch.
+// Transactions added to the chain are confirmed, their outputs unspent until
+// spent by the test.
+type FakeChain struct {
+	mu    sync.Mutex
+	tip   int64
+	calls int
+	delay time.Duration
+	err   error
+	txs   map[chainhash.Hash]confirmedTx
+	// spent maps spent outputs to the height of the block spending them.
+	spent map[wire.OutPoint]int64
+	// forks are the heights from which the blocks were replaced.
+	forks []int64
+	// syncing reports the node as in initial block download.
+	syncing bool
+}
+
+type confirmedTx struct {
+	tx     *wire.MsgTx
+	height int64
+}
+
+func NewFakeChain(tip int64) *FakeChain {
+	return &FakeChain{
+		tip:   tip,
+		txs:   make(map[chainhash.Hash]confirmedTx),
+		spent: make(map[wire.OutPoint]int64),
+	}
+}
+
+func (c *FakeChain) GetBlockCount(ctx context.Context) (int64, error) {
+	c.mu.Lock()
+	c.calls++
+	tip, delay, err := c.tip, c.delay, c.err
+	c.mu.Unlock()
+
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+	if err != nil {
+		return 0, err
+	}
+	return tip, nil
+}
+
+func (c *FakeChain) GetRawTransaction(ctx context.Context, txHash *chainhash.Hash) (*wire.MsgTx, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	confirmed, ok := c.txs[*txHash]
+	if !ok {
+		return nil, fmt.Errorf("no such transaction %s", txHash)
+	}
+	return confirmed.tx, nil
+}
+
+func (c *FakeChain) GetTxOut(ctx context.Context, txHash *chainhash.Hash, index uint32) (*wire.TxOut, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	confirmed, ok := c.txs[*txHash]
+	if !ok || int(index) >= len(confirmed.tx.TxOut) {
+		return nil, nil
+	}
+	if _, spent := c.spent[*wire.NewOutPoint(txHash, index)]; spent {
+		return nil, nil
+	}
+	return confirmed.tx.TxOut[index], nil
+}
+
+func (c *FakeChain) GetTxBlockHeight(ctx context.Context, txHash *chainhash.Hash) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	confirmed, ok := c.txs[*txHash]
+	if !ok {
+		return 0, fmt.Errorf("no such transaction %s", txHash)
+	}
+	return confirmed.height, nil
+}
+
+func (c *FakeChain) GetTxOutSpendHeight(ctx context.Context, txHash *chainhash.Hash, index uint32) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	height, spent := c.spent[*wire.NewOutPoint(txHash, index)]
+	if !spent {
+		return 0, btcclient.ErrTxNotConfirmed
+	}
+	return height, nil
+}
+
+func (c *FakeChain) GetBlockHash(ctx context.Context, height int64) (*chainhash.Hash, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if height < 0 || height > c.tip {
+		return nil, fmt.Errorf("block height %d out of range", height)
+	}
+	branch := 0
+	for _, fork := range c.forks {
+		if height >= fork {
+			branch++
+		}
+	}
+	hash := fakeBranchBlockHash(height, branch)
+	return &hash, nil
+}
+
+// fakeBlockHash derives a stable hash of the block at the height, as long as
+// the chain was not reorged below it.
+func fakeBlockHash(height int64) chainhash.Hash {
+	return fakeBranchBlockHash(height, 0)
+}
+
+// fakeBranchBlockHash derives a stable hash of the block at the height after
+// the given number of reorgs at or below it.
+func fakeBranchBlockHash(height int64, branch int) chainhash.Hash {
+	if branch == 0 {
+		return chainhash.DoubleHashH([]byte(fmt.Sprintf("fake-chain-%d", height)))
+	}
+	return chainhash.DoubleHashH([]byte(fmt.Sprintf("fake-chain-%d-branch-%d", height, branch)))
+}
+
+func (c *FakeChain) GetSyncStatus(ctx context.Context) (*btcclient.SyncStatus, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return &btcclient.SyncStatus{
+		InitialBlockDownload: c.syncing,
+		Blocks:               c.tip,
+		Headers:              c.tip,
+	}, nil
+}
+
+// SetSyncing reports the node as in initial block download or synced.
+func (c *FakeChain) SetSyncing(syncing bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.syncing = syncing
+}
+
+// AddTx confirms the transaction on the chain at the given height.
+func (c *FakeChain) AddTx(tx *wire.MsgTx, height int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.txs[tx.TxHash()] = confirmedTx{tx: tx, height: height}
+}
+
+// SpendOutput marks the output of a confirmed transaction as spent by a
+// transaction confirmed at the given height.
+func (c *FakeChain) SpendOutput(txHash chainhash.Hash, index uint32, height int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.spent[*wire.NewOutPoint(&txHash, index)] = height
+}
+
+// SetErr makes every query of the tip fail with the given error, like an
+// unreachable node. A nil error makes the node answer again.
+func (c *FakeChain) SetErr(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+// SetDelay makes every query of the tip take the given time, like a slow node.
+func (c *FakeChain) SetDelay(delay time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.delay = delay
+}
+
+// Calls returns how often the tip has been queried.
+func (c *FakeChain) Calls() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+// SetTip moves the tip of the chain to the given height.
+func (c *FakeChain) SetTip(tip int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tip = tip
+}
+
+// Reorg replaces the blocks from the fork height on by those of another
+// branch, whose tip is at the given height. The confirmed transactions stay
+// confirmed at their heights, as if mined again on the new branch.
+func (c *FakeChain) Reorg(forkHeight, tip int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.forks = append(c.forks, forkHeight)
+	c.tip = tip
+}
+
+// WaitForPolls blocks until the tip has been queried n more times, which
+// guarantees that the poller has fully observed the current tip at least once.
+func (c *FakeChain) WaitForPolls(n int, timeout time.Duration) bool {
+	c.mu.Lock()
+	target := c.calls + n
+	c.mu.Unlock()
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		calls := c.calls
+		c.mu.Unlock()
+		if calls >= target {
+			return true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+)
+
+// FakeElectrumServer stands in for an ElectrumX/Fulcrum server, speaking the
+// line delimited JSON-RPC of the electrum protocol over plain TCP.
+type FakeElectrumServer struct {
+	listener net.Listener
+
+	mu          sync.Mutex
+	tip         int64
+	conns       map[net.Conn]bool // connections, true once subscribed to headers
+	silent      bool
+	subscribers int
+}
+
+type fakeElectrumRequest struct {
+	ID     uint64 `json:"id"`
+	Method string `json:"method"`
+}
+
+func NewFakeElectrumServer(t *testing.T, tip int64) *FakeElectrumServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start fake electrum server: %v", err)
+	}
+	s := &FakeElectrumServer{
+		listener: listener,
+		tip:      tip,
+		conns:    make(map[net.Conn]bool),
+	}
+	t.Cleanup(func() {
+		listener.Close()
+		s.DropConnections()
+	})
+	go s.accept()
+	return s
+}
+
+// Endpoint returns the host:port clients connect to.
+func (s *FakeElectrumServer) Endpoint() string {
+	return s.listener.Addr().String()
+}
+
+// SetTip sets the tip and pushes it to all subscribed clients.
+func (s *FakeElectrumServer) SetTip(tip int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tip = tip
+	for conn, subscribed := range s.conns {
+		if subscribed {
+			s.write(conn, map[string]interface{}{
+				"jsonrpc": "2.0",
+				"method":  "blockchain.headers.subscribe",
+				"params":  []interface{}{s.header()},
+			})
+		}
+	}
+}
+
+// DropConnections closes all client connections, clients have to reconnect.
+func (s *FakeElectrumServer) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+}
+
+// SetSilent makes the server stop answering requests without closing the
+// connections, like a server that hangs.
+func (s *FakeElectrumServer) SetSilent(silent bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.silent = silent
+}
+
+// Subscribers returns the number of header subscriptions made so far.
+func (s *FakeElectrumServer) Subscribers() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subscribers
+}
+
+func (s *FakeElectrumServer) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = false
+		s.mu.Unlock()
+		go s.serve(conn)
+	}
+}
+
+func (s *FakeElectrumServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		var req fakeElectrumRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if !s.silent {
+			var result interface{}
+			switch req.Method {
+			case "server.version":
+				result = []string{"FakeElectrum 1.0", "1.4"}
+			case "blockchain.headers.subscribe":
+				s.conns[conn] = true
+				s.subscribers++
+				result = s.header()
+			}
+			s.write(conn, map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *FakeElectrumServer) header() map[string]interface{} {
+	return map[string]interface{}{"height": s.tip, "hex": "00"}
+}
+
+func (s *FakeElectrumServer) write(conn net.Conn, msg interface{}) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	// A failed write surfaces on the client as a dropped connection.
+	_, _ = conn.Write(append(data, '\n'))
+}
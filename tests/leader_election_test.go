@@ -0,0 +1,274 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/babylonchain/staking-queue-client/client"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/db"
+	"github.com/babylonchain/staking-expiry-checker/internal/db/model"
+	"github.com/babylonchain/staking-expiry-checker/tests/mocks"
+)
+
+func leaderElectionOverrides() *config.Config {
+	return &config.Config{
+		LeaderElection: config.LeaderElectionConfig{
+			Enabled:       true,
+			LeaseDuration: 10 * time.Second,
+			RenewInterval: time.Second,
+		},
+	}
+}
+
+func TestLeaderElection_OnlyLeaderPublishes(t *testing.T) {
+	mockBtc := new(mocks.BtcInterface)
+	mockBtc.On("GetBlockCount", mock.Anything).Return(int64(1000), nil)
+
+	_, conn, teardownFirst := setupTestServer(t, &TestServerDependency{
+		ConfigOverrides: leaderElectionOverrides(),
+		MockBtcClient:   mockBtc,
+	})
+	defer teardownFirst()
+	_, _, teardownSecond := setupTestServer(t, &TestServerDependency{
+		ConfigOverrides: leaderElectionOverrides(),
+		MockBtcClient:   mockBtc,
+	})
+	defer teardownSecond()
+
+	require.Eventually(
+		t, func() bool {
+			lock := fetchLeaderLock(t)
+			return lock != nil && lock.Owner != ""
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+
+	var delegations []model.TimeLockDocument
+	for i := 0; i < 20; i++ {
+		delegations = append(delegations, model.TimeLockDocument{
+			ID:               primitive.NewObjectID(),
+			StakingTxHashHex: fmt.Sprintf("mockStakingTxHashHex%d", i),
+			ExpireHeight:     999,
+			TxType:           "active",
+		})
+	}
+	insertTestDelegations(t, delegations)
+
+	require.Eventually(
+		t, func() bool {
+			return len(fetchAllTestDelegations(t)) == 0
+		}, 20*time.Second, 100*time.Millisecond,
+	)
+	count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+	require.NoError(t, err)
+	require.Equal(t, len(delegations), count)
+
+	// Both replicas competed for the same lock, only one took it.
+	lock := fetchLeaderLock(t)
+	require.Equal(t, int64(1), lock.FencingToken)
+}
+
+func TestLeaderElection_StaleLeaderIsFenced(t *testing.T) {
+	mockBtc := new(mocks.BtcInterface)
+	mockBtc.On("GetBlockCount", mock.Anything).Return(int64(1000), nil)
+
+	_, conn, teardown := setupTestServer(t, &TestServerDependency{
+		ConfigOverrides: leaderElectionOverrides(),
+		MockBtcClient:   mockBtc,
+	})
+	defer teardown()
+
+	require.Eventually(
+		t, func() bool {
+			lock := fetchLeaderLock(t)
+			return lock != nil && lock.Owner != ""
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+
+	// Another instance takes over the leadership behind our back.
+	lock := fetchLeaderLock(t)
+	replaceLeaderLock(t, model.LeaderLockDocument{
+		ID:           model.LeaderLockID,
+		Owner:        "otherInstance",
+		FencingToken: lock.FencingToken + 1,
+		ExpiresAt:    time.Now().Add(time.Hour).Unix(),
+	})
+
+	insertTestDelegations(t, []model.TimeLockDocument{
+		{
+			ID:               primitive.NewObjectID(),
+			StakingTxHashHex: "mockStakingTxHashHex",
+			ExpireHeight:     999,
+			TxType:           "active",
+		},
+	})
+
+	// The stale leader neither publishes nor deletes.
+	time.Sleep(5 * time.Second)
+	count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+	require.NoError(t, err)
+	require.Zero(t, count)
+	require.Len(t, fetchAllTestDelegations(t), 1)
+}
+
+func TestLeaderElection_FencedWritesRejectedAfterTakeover(t *testing.T) {
+	cfg, err := config.New("./config-test.yml")
+	require.NoError(t, err)
+	setupTestDB(cfg)
+	dbClient, err := db.New(context.Background(), cfg.Db)
+	require.NoError(t, err)
+
+	lock, err := dbClient.AcquireLeaderLock(context.Background(), "staleInstance", time.Hour)
+	require.NoError(t, err)
+	fence := &model.LeaderFence{Owner: lock.Owner, FencingToken: lock.FencingToken}
+	require.NoError(t, dbClient.SaveProcessingCheckpoint(context.Background(), 100, "", fence))
+
+	// The stale leader passed its leadership check before the takeover, its
+	// writes must still be rejected afterwards.
+	replaceLeaderLock(t, model.LeaderLockDocument{
+		ID:           model.LeaderLockID,
+		Owner:        "otherInstance",
+		FencingToken: lock.FencingToken + 1,
+		ExpiresAt:    time.Now().Add(time.Hour).Unix(),
+	})
+	id := primitive.NewObjectID()
+	insertTestDelegations(t, []model.TimeLockDocument{{
+		ID:               id,
+		StakingTxHashHex: "mockStakingTxHashHex",
+		ExpireHeight:     999,
+		TxType:           "active",
+		Status:           model.TimeLockStatusPublishing,
+		LeaseOwner:       "staleInstance",
+	}})
+
+	err = dbClient.SaveProcessingCheckpoint(context.Background(), 101, "", fence)
+	require.ErrorIs(t, err, db.ErrFenced)
+	err = dbClient.MarkDelegationPublished(context.Background(), id, "staleInstance", 1000, true, fence)
+	require.ErrorIs(t, err, db.ErrFenced)
+	err = dbClient.ArchiveExpiredDelegation(context.Background(), id, fence)
+	require.ErrorIs(t, err, db.ErrFenced)
+
+	checkpoint, err := dbClient.GetProcessingCheckpoint(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, uint64(100), checkpoint.Height)
+	delegations := fetchAllTestDelegations(t)
+	require.Len(t, delegations, 1)
+	require.Equal(t, model.TimeLockStatusPublishing, delegations[0].Status)
+}
+
+func TestLeaderElection_StaleFenceRejectedOnEveryWrite(t *testing.T) {
+	cfg, err := config.New("./config-test.yml")
+	require.NoError(t, err)
+	setupTestDB(cfg)
+	dbClient, err := db.New(context.Background(), cfg.Db)
+	require.NoError(t, err)
+
+	lock, err := dbClient.AcquireLeaderLock(context.Background(), "staleInstance", time.Hour)
+	require.NoError(t, err)
+	fence := &model.LeaderFence{Owner: lock.Owner, FencingToken: lock.FencingToken}
+	require.NoError(t, dbClient.SaveProcessingCheckpoint(context.Background(), 100, "", fence))
+	require.NoError(t, dbClient.SaveRecentBlocks(context.Background(), []model.RecentBlockDocument{
+		{Height: 100, Hash: "hash100"},
+	}, 0, fence))
+
+	replaceLeaderLock(t, model.LeaderLockDocument{
+		ID:           model.LeaderLockID,
+		Owner:        "otherInstance",
+		FencingToken: lock.FencingToken + 1,
+		ExpiresAt:    time.Now().Add(time.Hour).Unix(),
+	})
+	id := primitive.NewObjectID()
+	insertTestDelegations(t, []model.TimeLockDocument{{
+		ID:               id,
+		StakingTxHashHex: "mockStakingTxHashHex",
+		ExpireHeight:     999,
+		TxType:           "active",
+		Status:           model.TimeLockStatusPublishing,
+		LeaseOwner:       "staleInstance",
+		FailureCount:     9,
+	}})
+	historyID := primitive.NewObjectID()
+	insertRawTestDocument(t, model.ExpiredHistoryCollection, model.ExpiredHistoryDocument{
+		ID:               historyID,
+		TimeLockID:       primitive.NewObjectID(),
+		StakingTxHashHex: "publishedStakingTxHashHex",
+		TxType:           "active",
+		ExpireHeight:     100,
+		Outcome:          model.ExpiredHistoryOutcomePublished,
+	})
+
+	err = dbClient.QuarantineDelegation(context.Background(), id, "staleInstance", "mismatch", 1000, fence)
+	require.ErrorIs(t, err, db.ErrFenced)
+	err = dbClient.ArchiveSpentDelegation(context.Background(), id, "staleInstance", 1000, fence)
+	require.ErrorIs(t, err, db.ErrFenced)
+	// The failure is recorded under the lease, only the dead lettering is fenced.
+	deadLettered, err := dbClient.RecordDelegationFailure(
+		context.Background(), id, "staleInstance", errors.New("queue unavailable"), true, 10, fence,
+	)
+	require.ErrorIs(t, err, db.ErrFenced)
+	require.False(t, deadLettered)
+	err = dbClient.RevertExpiredDelegation(context.Background(), historyID, 100, fence)
+	require.ErrorIs(t, err, db.ErrFenced)
+	err = dbClient.RollbackProcessingCheckpoint(context.Background(), 99, "", fence)
+	require.ErrorIs(t, err, db.ErrFenced)
+	err = dbClient.SaveRecentBlocks(context.Background(), []model.RecentBlockDocument{
+		{Height: 101, Hash: "hash101"},
+	}, 0, fence)
+	require.ErrorIs(t, err, db.ErrFenced)
+	err = dbClient.DeleteRecentBlocks(context.Background(), 100, fence)
+	require.ErrorIs(t, err, db.ErrFenced)
+
+	require.Zero(t, countTestDocuments(t, model.TimeLockQuarantineCollection))
+	require.Zero(t, countTestDocuments(t, model.TimeLockDeadLetterCollection))
+	require.Equal(t, int64(1), countTestDocuments(t, model.TimeLockCollection))
+	history := fetchExpiredHistory(t)
+	require.Len(t, history, 1)
+	require.Equal(t, model.ExpiredHistoryOutcomePublished, history[0].Outcome)
+	checkpoint, err := dbClient.GetProcessingCheckpoint(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, uint64(100), checkpoint.Height)
+	blocks, err := dbClient.ListRecentBlocks(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []model.RecentBlockDocument{{Height: 100, Hash: "hash100"}}, blocks)
+}
+
+func leaderLockCollection(t *testing.T) *mongo.Collection {
+	cfg, err := config.New("./config-test.yml")
+	if err != nil {
+		t.Fatalf("Failed to load test config: %v", err)
+	}
+	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(cfg.Db.Address))
+	if err != nil {
+		t.Fatalf("Failed to connect to db: %v", err)
+	}
+	return client.Database(cfg.Db.DbName).Collection(model.LeaderLockCollection)
+}
+
+func fetchLeaderLock(t *testing.T) *model.LeaderLockDocument {
+	var lock model.LeaderLockDocument
+	err := leaderLockCollection(t).FindOne(context.Background(), bson.M{"_id": model.LeaderLockID}).Decode(&lock)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("Failed to fetch leader lock: %v", err)
+	}
+	return &lock
+}
+
+func replaceLeaderLock(t *testing.T, lock model.LeaderLockDocument) {
+	_, err := leaderLockCollection(t).ReplaceOne(context.Background(), bson.M{"_id": lock.ID}, lock)
+	if err != nil {
+		t.Fatalf("Failed to replace leader lock: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/babylonchain/staking-queue-client/client"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/db/model"
+	"github.com/babylonchain/staking-expiry-checker/tests/mocks"
+)
+
+func TestProcessExpiredDelegations_ReplicasDoNotDoublePublish(t *testing.T) {
+	mockBtc := new(mocks.BtcInterface)
+	mockBtc.On("GetBlockCount", mock.Anything).Return(int64(1000), nil)
+
+	_, conn, teardownFirst := setupTestServer(t, &TestServerDependency{
+		MockBtcClient: mockBtc,
+	})
+	defer teardownFirst()
+	_, _, teardownSecond := setupTestServer(t, &TestServerDependency{
+		MockBtcClient: mockBtc,
+	})
+	defer teardownSecond()
+
+	var delegations []model.TimeLockDocument
+	for i := 0; i < 50; i++ {
+		delegations = append(delegations, model.TimeLockDocument{
+			ID:               primitive.NewObjectID(),
+			StakingTxHashHex: fmt.Sprintf("mockStakingTxHashHex%d", i),
+			ExpireHeight:     999,
+			TxType:           "active",
+		})
+	}
+	insertTestDelegations(t, delegations)
+
+	require.Eventually(
+		t, func() bool {
+			return len(fetchAllTestDelegations(t)) == 0
+		}, 20*time.Second, 100*time.Millisecond,
+	)
+
+	// Give both replicas another poll to make sure nothing is published twice.
+	time.Sleep(3 * time.Second)
+	count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+	require.NoError(t, err)
+	require.Equal(t, len(delegations), count)
+}
+
+func TestProcessExpiredDelegations_LeasesOfOtherInstances(t *testing.T) {
+	mockBtc := new(mocks.BtcInterface)
+	mockBtc.On("GetBlockCount", mock.Anything).Return(int64(1000), nil)
+
+	_, conn, teardown := setupTestServer(t, &TestServerDependency{
+		MockBtcClient: mockBtc,
+	})
+	defer teardown()
+
+	activeLease := model.TimeLockDocument{
+		ID:               primitive.NewObjectID(),
+		StakingTxHashHex: "mockStakingTxHashHexActiveLease",
+		ExpireHeight:     999,
+		TxType:           "active",
+		Status:           model.TimeLockStatusPublishing,
+		LeaseOwner:       "liveInstance",
+		LeaseExpiresAt:   time.Now().Add(time.Hour).Unix(),
+	}
+	expiredLease := model.TimeLockDocument{
+		ID:               primitive.NewObjectID(),
+		StakingTxHashHex: "mockStakingTxHashHexExpiredLease",
+		ExpireHeight:     999,
+		TxType:           "active",
+		Status:           model.TimeLockStatusPublishing,
+		LeaseOwner:       "crashedInstance",
+		LeaseExpiresAt:   time.Now().Add(-time.Minute).Unix(),
+	}
+	insertTestDelegations(t, []model.TimeLockDocument{activeLease, expiredLease})
+
+	// The expired lease is reclaimed and published.
+	require.Eventually(
+		t, func() bool {
+			count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+			return err == nil && count == 1
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+
+	// The document leased by a live instance is left untouched.
+	require.Eventually(
+		t, func() bool {
+			docs := fetchAllTestDelegations(t)
+			return len(docs) == 1 && docs[0].ID == activeLease.ID
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+	docs := fetchAllTestDelegations(t)
+	require.Equal(t, "liveInstance", docs[0].LeaseOwner)
+}
@@ -2,16 +2,26 @@
 
 package mocks
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	btcclient "github.com/babylonchain/staking-expiry-checker/internal/btcclient"
+
+	chainhash "github.com/btcsuite/btcd/chaincfg/chainhash"
+
+	context "context"
+
+	mock "github.com/stretchr/testify/mock"
+
+	wire "github.com/btcsuite/btcd/wire"
+)
 
 // BtcInterface is an autogenerated mock type for the BtcInterface type
 type BtcInterface struct {
 	mock.Mock
 }
 
-// GetBlockCount provides a mock function with given fields:
-func (_m *BtcInterface) GetBlockCount() (int64, error) {
-	ret := _m.Called()
+// GetBlockCount provides a mock function with given fields: ctx
+func (_m *BtcInterface) GetBlockCount(ctx context.Context) (int64, error) {
+	ret := _m.Called(ctx)
 
 	if len(ret) == 0 {
 		panic("no return value specified for GetBlockCount")
@@ -19,17 +29,193 @@ func (_m *BtcInterface) GetBlockCount() (int64, error) {
 
 	var r0 int64
 	var r1 error
-	if rf, ok := ret.Get(0).(func() (int64, error)); ok {
-		return rf()
+	if rf, ok := ret.Get(0).(func(context.Context) (int64, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) int64); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetBlockHash provides a mock function with given fields: ctx, height
+func (_m *BtcInterface) GetBlockHash(ctx context.Context, height int64) (*chainhash.Hash, error) {
+	ret := _m.Called(ctx, height)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetBlockHash")
+	}
+
+	var r0 *chainhash.Hash
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) (*chainhash.Hash, error)); ok {
+		return rf(ctx, height)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) *chainhash.Hash); ok {
+		r0 = rf(ctx, height)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*chainhash.Hash)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, height)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetRawTransaction provides a mock function with given fields: ctx, txHash
+func (_m *BtcInterface) GetRawTransaction(ctx context.Context, txHash *chainhash.Hash) (*wire.MsgTx, error) {
+	ret := _m.Called(ctx, txHash)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetRawTransaction")
+	}
+
+	var r0 *wire.MsgTx
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *chainhash.Hash) (*wire.MsgTx, error)); ok {
+		return rf(ctx, txHash)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *chainhash.Hash) *wire.MsgTx); ok {
+		r0 = rf(ctx, txHash)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*wire.MsgTx)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *chainhash.Hash) error); ok {
+		r1 = rf(ctx, txHash)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSyncStatus provides a mock function with given fields: ctx
+func (_m *BtcInterface) GetSyncStatus(ctx context.Context) (*btcclient.SyncStatus, error) {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetSyncStatus")
+	}
+
+	var r0 *btcclient.SyncStatus
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) (*btcclient.SyncStatus, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) *btcclient.SyncStatus); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*btcclient.SyncStatus)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTxBlockHeight provides a mock function with given fields: ctx, txHash
+func (_m *BtcInterface) GetTxBlockHeight(ctx context.Context, txHash *chainhash.Hash) (int64, error) {
+	ret := _m.Called(ctx, txHash)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetTxBlockHeight")
+	}
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *chainhash.Hash) (int64, error)); ok {
+		return rf(ctx, txHash)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *chainhash.Hash) int64); ok {
+		r0 = rf(ctx, txHash)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *chainhash.Hash) error); ok {
+		r1 = rf(ctx, txHash)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTxOut provides a mock function with given fields: ctx, txHash, index
+func (_m *BtcInterface) GetTxOut(ctx context.Context, txHash *chainhash.Hash, index uint32) (*wire.TxOut, error) {
+	ret := _m.Called(ctx, txHash, index)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetTxOut")
+	}
+
+	var r0 *wire.TxOut
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *chainhash.Hash, uint32) (*wire.TxOut, error)); ok {
+		return rf(ctx, txHash, index)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *chainhash.Hash, uint32) *wire.TxOut); ok {
+		r0 = rf(ctx, txHash, index)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*wire.TxOut)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *chainhash.Hash, uint32) error); ok {
+		r1 = rf(ctx, txHash, index)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTxOutSpendHeight provides a mock function with given fields: ctx, txHash, index
+func (_m *BtcInterface) GetTxOutSpendHeight(ctx context.Context, txHash *chainhash.Hash, index uint32) (int64, error) {
+	ret := _m.Called(ctx, txHash, index)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetTxOutSpendHeight")
+	}
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *chainhash.Hash, uint32) (int64, error)); ok {
+		return rf(ctx, txHash, index)
 	}
-	if rf, ok := ret.Get(0).(func() int64); ok {
-		r0 = rf()
+	if rf, ok := ret.Get(0).(func(context.Context, *chainhash.Hash, uint32) int64); ok {
+		r0 = rf(ctx, txHash, index)
 	} else {
 		r0 = ret.Get(0).(int64)
 	}
 
-	if rf, ok := ret.Get(1).(func() error); ok {
-		r1 = rf()
+	if rf, ok := ret.Get(1).(func(context.Context, *chainhash.Hash, uint32) error); ok {
+		r1 = rf(ctx, txHash, index)
 	} else {
 		r1 = ret.Error(1)
 	}
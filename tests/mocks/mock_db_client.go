@@ -10,6 +10,8 @@ import (
 	model "github.com/babylonchain/staking-expiry-checker/internal/db/model"
 
 	primitive "go.mongodb.org/mongo-driver/bson/primitive"
+
+	time "time"
 )
 
 // DbInterface is an autogenerated mock type for the DbInterface type
@@ -17,17 +19,47 @@ type DbInterface struct {
 	mock.Mock
 }
 
-// DeleteExpiredDelegation provides a mock function with given fields: ctx, id
-func (_m *DbInterface) DeleteExpiredDelegation(ctx context.Context, id primitive.ObjectID) error {
-	ret := _m.Called(ctx, id)
+// AcquireLeaderLock provides a mock function with given fields: ctx, owner, leaseDuration
+func (_m *DbInterface) AcquireLeaderLock(ctx context.Context, owner string, leaseDuration time.Duration) (*model.LeaderLockDocument, error) {
+	ret := _m.Called(ctx, owner, leaseDuration)
+
+	if len(ret) == 0 {
+		panic("no return value specified for AcquireLeaderLock")
+	}
+
+	var r0 *model.LeaderLockDocument
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Duration) (*model.LeaderLockDocument, error)); ok {
+		return rf(ctx, owner, leaseDuration)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Duration) *model.LeaderLockDocument); ok {
+		r0 = rf(ctx, owner, leaseDuration)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.LeaderLockDocument)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Duration) error); ok {
+		r1 = rf(ctx, owner, leaseDuration)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ArchiveExpiredDelegation provides a mock function with given fields: ctx, id, fence
+func (_m *DbInterface) ArchiveExpiredDelegation(ctx context.Context, id primitive.ObjectID, fence *model.LeaderFence) error {
+	ret := _m.Called(ctx, id, fence)
 
 	if len(ret) == 0 {
-		panic("no return value specified for DeleteExpiredDelegation")
+		panic("no return value specified for ArchiveExpiredDelegation")
 	}
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID) error); ok {
-		r0 = rf(ctx, id)
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, *model.LeaderFence) error); ok {
+		r0 = rf(ctx, id, fence)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -35,29 +67,315 @@ func (_m *DbInterface) DeleteExpiredDelegation(ctx context.Context, id primitive
 	return r0
 }
 
-// FindExpiredDelegations provides a mock function with given fields: ctx, btcTipHeight
-func (_m *DbInterface) FindExpiredDelegations(ctx context.Context, btcTipHeight uint64) ([]model.TimeLockDocument, error) {
-	ret := _m.Called(ctx, btcTipHeight)
+// ArchivePublishedDelegations provides a mock function with given fields: ctx, fence
+func (_m *DbInterface) ArchivePublishedDelegations(ctx context.Context, fence *model.LeaderFence) (int64, error) {
+	ret := _m.Called(ctx, fence)
 
 	if len(ret) == 0 {
-		panic("no return value specified for FindExpiredDelegations")
+		panic("no return value specified for ArchivePublishedDelegations")
+	}
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.LeaderFence) (int64, error)); ok {
+		return rf(ctx, fence)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, *model.LeaderFence) int64); ok {
+		r0 = rf(ctx, fence)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, *model.LeaderFence) error); ok {
+		r1 = rf(ctx, fence)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ArchiveSpentDelegation provides a mock function with given fields: ctx, id, owner, tipHeight, fence
+func (_m *DbInterface) ArchiveSpentDelegation(ctx context.Context, id primitive.ObjectID, owner string, tipHeight uint64, fence *model.LeaderFence) error {
+	ret := _m.Called(ctx, id, owner, tipHeight, fence)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ArchiveSpentDelegation")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, string, uint64, *model.LeaderFence) error); ok {
+		r0 = rf(ctx, id, owner, tipHeight, fence)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ClaimExpiredDelegations provides a mock function with given fields: ctx, btcTipHeight, owner, leaseDuration, limit
+func (_m *DbInterface) ClaimExpiredDelegations(ctx context.Context, btcTipHeight uint64, owner string, leaseDuration time.Duration, limit int) ([]model.TimeLockDocument, error) {
+	ret := _m.Called(ctx, btcTipHeight, owner, leaseDuration, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ClaimExpiredDelegations")
 	}
 
 	var r0 []model.TimeLockDocument
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, uint64) ([]model.TimeLockDocument, error)); ok {
-		return rf(ctx, btcTipHeight)
+	if rf, ok := ret.Get(0).(func(context.Context, uint64, string, time.Duration, int) ([]model.TimeLockDocument, error)); ok {
+		return rf(ctx, btcTipHeight, owner, leaseDuration, limit)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, uint64) []model.TimeLockDocument); ok {
-		r0 = rf(ctx, btcTipHeight)
+	if rf, ok := ret.Get(0).(func(context.Context, uint64, string, time.Duration, int) []model.TimeLockDocument); ok {
+		r0 = rf(ctx, btcTipHeight, owner, leaseDuration, limit)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]model.TimeLockDocument)
 		}
 	}
 
+	if rf, ok := ret.Get(1).(func(context.Context, uint64, string, time.Duration, int) error); ok {
+		r1 = rf(ctx, btcTipHeight, owner, leaseDuration, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CountExpiredDelegations provides a mock function with given fields: ctx, height
+func (_m *DbInterface) CountExpiredDelegations(ctx context.Context, height uint64) (int64, error) {
+	ret := _m.Called(ctx, height)
+
+	if len(ret) == 0 {
+		panic("no return value specified for CountExpiredDelegations")
+	}
+
+	var r0 int64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, uint64) (int64, error)); ok {
+		return rf(ctx, height)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, uint64) int64); ok {
+		r0 = rf(ctx, height)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, uint64) error); ok {
+		r1 = rf(ctx, height)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteRecentBlocks provides a mock function with given fields: ctx, fromHeight, fence
+func (_m *DbInterface) DeleteRecentBlocks(ctx context.Context, fromHeight uint64, fence *model.LeaderFence) error {
+	ret := _m.Called(ctx, fromHeight, fence)
+
+	if len(ret) == 0 {
+		panic("no return value specified for DeleteRecentBlocks")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, uint64, *model.LeaderFence) error); ok {
+		r0 = rf(ctx, fromHeight, fence)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// FindPublishedExpiries provides a mock function with given fields: ctx, fromHeight
+func (_m *DbInterface) FindPublishedExpiries(ctx context.Context, fromHeight uint64) ([]model.ExpiredHistoryDocument, error) {
+	ret := _m.Called(ctx, fromHeight)
+
+	if len(ret) == 0 {
+		panic("no return value specified for FindPublishedExpiries")
+	}
+
+	var r0 []model.ExpiredHistoryDocument
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, uint64) ([]model.ExpiredHistoryDocument, error)); ok {
+		return rf(ctx, fromHeight)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, uint64) []model.ExpiredHistoryDocument); ok {
+		r0 = rf(ctx, fromHeight)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.ExpiredHistoryDocument)
+		}
+	}
+
 	if rf, ok := ret.Get(1).(func(context.Context, uint64) error); ok {
-		r1 = rf(ctx, btcTipHeight)
+		r1 = rf(ctx, fromHeight)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetProcessingCheckpoint provides a mock function with given fields: ctx
+func (_m *DbInterface) GetProcessingCheckpoint(ctx context.Context) (*model.ProcessingCheckpointDocument, error) {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetProcessingCheckpoint")
+	}
+
+	var r0 *model.ProcessingCheckpointDocument
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) (*model.ProcessingCheckpointDocument, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) *model.ProcessingCheckpointDocument); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.ProcessingCheckpointDocument)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IsEventPublished provides a mock function with given fields: ctx, stakingTxHashHex, txType
+func (_m *DbInterface) IsEventPublished(ctx context.Context, stakingTxHashHex string, txType string) (bool, error) {
+	ret := _m.Called(ctx, stakingTxHashHex, txType)
+
+	if len(ret) == 0 {
+		panic("no return value specified for IsEventPublished")
+	}
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) (bool, error)); ok {
+		return rf(ctx, stakingTxHashHex, txType)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) bool); ok {
+		r0 = rf(ctx, stakingTxHashHex, txType)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, stakingTxHashHex, txType)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListDeadLetters provides a mock function with given fields: ctx, limit
+func (_m *DbInterface) ListDeadLetters(ctx context.Context, limit int64) ([]model.TimeLockDeadLetterDocument, error) {
+	ret := _m.Called(ctx, limit)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListDeadLetters")
+	}
+
+	var r0 []model.TimeLockDeadLetterDocument
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, int64) ([]model.TimeLockDeadLetterDocument, error)); ok {
+		return rf(ctx, limit)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, int64) []model.TimeLockDeadLetterDocument); ok {
+		r0 = rf(ctx, limit)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.TimeLockDeadLetterDocument)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, int64) error); ok {
+		r1 = rf(ctx, limit)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ListRecentBlocks provides a mock function with given fields: ctx
+func (_m *DbInterface) ListRecentBlocks(ctx context.Context) ([]model.RecentBlockDocument, error) {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ListRecentBlocks")
+	}
+
+	var r0 []model.RecentBlockDocument
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context) ([]model.RecentBlockDocument, error)); ok {
+		return rf(ctx)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context) []model.RecentBlockDocument); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.RecentBlockDocument)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// MarkDelegationPublished provides a mock function with given fields: ctx, id, owner, tipHeight, sent, fence
+func (_m *DbInterface) MarkDelegationPublished(ctx context.Context, id primitive.ObjectID, owner string, tipHeight uint64, sent bool, fence *model.LeaderFence) error {
+	ret := _m.Called(ctx, id, owner, tipHeight, sent, fence)
+
+	if len(ret) == 0 {
+		panic("no return value specified for MarkDelegationPublished")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, string, uint64, bool, *model.LeaderFence) error); ok {
+		r0 = rf(ctx, id, owner, tipHeight, sent, fence)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// NextExpireHeight provides a mock function with given fields: ctx, afterHeight
+func (_m *DbInterface) NextExpireHeight(ctx context.Context, afterHeight uint64) (uint64, error) {
+	ret := _m.Called(ctx, afterHeight)
+
+	if len(ret) == 0 {
+		panic("no return value specified for NextExpireHeight")
+	}
+
+	var r0 uint64
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, uint64) (uint64, error)); ok {
+		return rf(ctx, afterHeight)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, uint64) uint64); ok {
+		r0 = rf(ctx, afterHeight)
+	} else {
+		r0 = ret.Get(0).(uint64)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, uint64) error); ok {
+		r1 = rf(ctx, afterHeight)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -83,6 +401,214 @@ func (_m *DbInterface) Ping(ctx context.Context) error {
 	return r0
 }
 
+// QuarantineDelegation provides a mock function with given fields: ctx, id, owner, reason, computedExpireHeight, fence
+func (_m *DbInterface) QuarantineDelegation(ctx context.Context, id primitive.ObjectID, owner string, reason string, computedExpireHeight uint64, fence *model.LeaderFence) error {
+	ret := _m.Called(ctx, id, owner, reason, computedExpireHeight, fence)
+
+	if len(ret) == 0 {
+		panic("no return value specified for QuarantineDelegation")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, string, string, uint64, *model.LeaderFence) error); ok {
+		r0 = rf(ctx, id, owner, reason, computedExpireHeight, fence)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RecordDelegationFailure provides a mock function with given fields: ctx, id, owner, failure, notPublished, maxFailures, fence
+func (_m *DbInterface) RecordDelegationFailure(ctx context.Context, id primitive.ObjectID, owner string, failure error, notPublished bool, maxFailures int, fence *model.LeaderFence) (bool, error) {
+	ret := _m.Called(ctx, id, owner, failure, notPublished, maxFailures, fence)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RecordDelegationFailure")
+	}
+
+	var r0 bool
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, string, error, bool, int, *model.LeaderFence) (bool, error)); ok {
+		return rf(ctx, id, owner, failure, notPublished, maxFailures, fence)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, string, error, bool, int, *model.LeaderFence) bool); ok {
+		r0 = rf(ctx, id, owner, failure, notPublished, maxFailures, fence)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, primitive.ObjectID, string, error, bool, int, *model.LeaderFence) error); ok {
+		r1 = rf(ctx, id, owner, failure, notPublished, maxFailures, fence)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RecordMaybePublished provides a mock function with given fields: ctx, id, owner, failure
+func (_m *DbInterface) RecordMaybePublished(ctx context.Context, id primitive.ObjectID, owner string, failure error) error {
+	ret := _m.Called(ctx, id, owner, failure)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RecordMaybePublished")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, string, error) error); ok {
+		r0 = rf(ctx, id, owner, failure)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ReleaseDelegation provides a mock function with given fields: ctx, id, owner, status
+func (_m *DbInterface) ReleaseDelegation(ctx context.Context, id primitive.ObjectID, owner string, status model.TimeLockStatus) error {
+	ret := _m.Called(ctx, id, owner, status)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ReleaseDelegation")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, string, model.TimeLockStatus) error); ok {
+		r0 = rf(ctx, id, owner, status)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ReleaseLeaderLock provides a mock function with given fields: ctx, owner
+func (_m *DbInterface) ReleaseLeaderLock(ctx context.Context, owner string) error {
+	ret := _m.Called(ctx, owner)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ReleaseLeaderLock")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, owner)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RequeueDeadLetter provides a mock function with given fields: ctx, id
+func (_m *DbInterface) RequeueDeadLetter(ctx context.Context, id primitive.ObjectID) error {
+	ret := _m.Called(ctx, id)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RequeueDeadLetter")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RevertExpiredDelegation provides a mock function with given fields: ctx, historyID, forkHeight, fence
+func (_m *DbInterface) RevertExpiredDelegation(ctx context.Context, historyID primitive.ObjectID, forkHeight uint64, fence *model.LeaderFence) error {
+	ret := _m.Called(ctx, historyID, forkHeight, fence)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RevertExpiredDelegation")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, primitive.ObjectID, uint64, *model.LeaderFence) error); ok {
+		r0 = rf(ctx, historyID, forkHeight, fence)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RollbackProcessingCheckpoint provides a mock function with given fields: ctx, height, blockHash, fence
+func (_m *DbInterface) RollbackProcessingCheckpoint(ctx context.Context, height uint64, blockHash string, fence *model.LeaderFence) error {
+	ret := _m.Called(ctx, height, blockHash, fence)
+
+	if len(ret) == 0 {
+		panic("no return value specified for RollbackProcessingCheckpoint")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, uint64, string, *model.LeaderFence) error); ok {
+		r0 = rf(ctx, height, blockHash, fence)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveProcessingCheckpoint provides a mock function with given fields: ctx, height, blockHash, fence
+func (_m *DbInterface) SaveProcessingCheckpoint(ctx context.Context, height uint64, blockHash string, fence *model.LeaderFence) error {
+	ret := _m.Called(ctx, height, blockHash, fence)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SaveProcessingCheckpoint")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, uint64, string, *model.LeaderFence) error); ok {
+		r0 = rf(ctx, height, blockHash, fence)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveRecentBlocks provides a mock function with given fields: ctx, blocks, keepFromHeight, fence
+func (_m *DbInterface) SaveRecentBlocks(ctx context.Context, blocks []model.RecentBlockDocument, keepFromHeight uint64, fence *model.LeaderFence) error {
+	ret := _m.Called(ctx, blocks, keepFromHeight, fence)
+
+	if len(ret) == 0 {
+		panic("no return value specified for SaveRecentBlocks")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, []model.RecentBlockDocument, uint64, *model.LeaderFence) error); ok {
+		r0 = rf(ctx, blocks, keepFromHeight, fence)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ValidateLeaderLock provides a mock function with given fields: ctx, owner, fencingToken
+func (_m *DbInterface) ValidateLeaderLock(ctx context.Context, owner string, fencingToken int64) error {
+	ret := _m.Called(ctx, owner, fencingToken)
+
+	if len(ret) == 0 {
+		panic("no return value specified for ValidateLeaderLock")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, int64) error); ok {
+		r0 = rf(ctx, owner, fencingToken)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // NewDbInterface creates a new instance of DbInterface. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
 // The first argument is typically a *testing.T value.
 func NewDbInterface(t interface {
@@ -0,0 +1,296 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/stretchr/testify/require"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/btcclient"
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+)
+
+func testMultiBtcConfig(quorumMode string) *config.BtcConfig {
+	return &config.BtcConfig{
+		NetParams:           "testnet",
+		QuorumMode:          quorumMode,
+		HealthCheckInterval: 200 * time.Millisecond,
+		MaxTipLag:           3,
+	}
+}
+
+func TestMultiBtcClient_FailsOverToNextNode(t *testing.T) {
+	initTestMetrics(t)
+	primary := NewFakeChain(1000)
+	secondary := NewFakeChain(1001)
+	client := btcclient.NewMultiBtcClient([]btcclient.Node{
+		{Name: "primary", Client: primary},
+		{Name: "secondary", Client: secondary},
+	}, testMultiBtcConfig(config.QuorumModeNone))
+
+	tip, err := client.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), tip)
+
+	// The primary goes down, the secondary takes over.
+	primary.SetErr(errors.New("connection refused"))
+	tip, err = client.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(1001), tip)
+
+	// The failed primary is skipped instead of being queried on every call.
+	primaryCalls := primary.Calls()
+	_, err = client.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, primaryCalls, primary.Calls())
+
+	// Once recovered, the primary is used again.
+	primary.SetErr(nil)
+	require.Eventually(
+		t, func() bool {
+			tip, err := client.GetBlockCount(context.Background())
+			return err == nil && tip == 1000
+		}, 5*time.Second, 50*time.Millisecond,
+	)
+}
+
+func TestMultiBtcClient_FailsWhenAllNodesFail(t *testing.T) {
+	initTestMetrics(t)
+	first := NewFakeChain(1000)
+	first.SetErr(errors.New("connection refused"))
+	second := NewFakeChain(1000)
+	second.SetErr(errors.New("connection refused"))
+	client := btcclient.NewMultiBtcClient([]btcclient.Node{
+		{Name: "first", Client: first},
+		{Name: "second", Client: second},
+	}, testMultiBtcConfig(config.QuorumModeNone))
+
+	_, err := client.GetBlockCount(context.Background())
+	require.Error(t, err)
+
+	// With no node available, all of them are tried as a last resort.
+	second.SetErr(nil)
+	tip, err := client.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), tip)
+}
+
+func TestMultiBtcClient_QuorumIgnoresLyingNode(t *testing.T) {
+	initTestMetrics(t)
+	nodes := []btcclient.Node{
+		{Name: "honest1", Client: NewFakeChain(1000)},
+		{Name: "honest2", Client: NewFakeChain(1001)},
+		{Name: "liar", Client: NewFakeChain(5000)},
+	}
+
+	median := btcclient.NewMultiBtcClient(nodes, testMultiBtcConfig(config.QuorumModeMedian))
+	tip, err := median.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(1001), tip)
+
+	minimum := btcclient.NewMultiBtcClient(nodes, testMultiBtcConfig(config.QuorumModeMin))
+	tip, err = minimum.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), tip)
+}
+
+func TestMultiBtcClient_QuorumRequiresEnoughNodes(t *testing.T) {
+	initTestMetrics(t)
+	down1 := NewFakeChain(1000)
+	down1.SetErr(errors.New("connection refused"))
+	down2 := NewFakeChain(1000)
+	down2.SetErr(errors.New("connection refused"))
+	client := btcclient.NewMultiBtcClient([]btcclient.Node{
+		{Name: "up", Client: NewFakeChain(1000)},
+		{Name: "down1", Client: down1},
+		{Name: "down2", Client: down2},
+	}, testMultiBtcConfig(config.QuorumModeMedian))
+
+	// A single node answering is not a majority.
+	_, err := client.GetBlockCount(context.Background())
+	require.Error(t, err)
+
+	down1.SetErr(nil)
+	require.Eventually(
+		t, func() bool {
+			tip, err := client.GetBlockCount(context.Background())
+			return err == nil && tip == 1000
+		}, 5*time.Second, 50*time.Millisecond,
+	)
+}
+
+func TestMultiBtcClient_SkipsLaggingNode(t *testing.T) {
+	initTestMetrics(t)
+	lagging := NewFakeChain(900)
+	client := btcclient.NewMultiBtcClient([]btcclient.Node{
+		{Name: "lagging", Client: lagging},
+		{Name: "synced1", Client: NewFakeChain(1000)},
+		{Name: "synced2", Client: NewFakeChain(1000)},
+	}, testMultiBtcConfig(config.QuorumModeNone))
+
+	tip, err := client.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(900), tip)
+
+	// A health check notices the lag and moves on to the synced node.
+	require.Eventually(
+		t, func() bool {
+			tip, err := client.GetBlockCount(context.Background())
+			return err == nil && tip == 1000
+		}, 5*time.Second, 50*time.Millisecond,
+	)
+
+	// Once caught up, the node is used again.
+	lagging.SetTip(999)
+	require.Eventually(
+		t, func() bool {
+			tip, err := client.GetBlockCount(context.Background())
+			return err == nil && tip == 999
+		}, 5*time.Second, 50*time.Millisecond,
+	)
+}
+
+func TestMultiBtcClient_LagIsMeasuredAgainstMedianTip(t *testing.T) {
+	initTestMetrics(t)
+	client := btcclient.NewMultiBtcClient([]btcclient.Node{
+		{Name: "honest1", Client: NewFakeChain(1000)},
+		{Name: "honest2", Client: NewFakeChain(1000)},
+		{Name: "liar", Client: NewFakeChain(5000)},
+	}, testMultiBtcConfig(config.QuorumModeNone))
+
+	// A single node reporting a tip far ahead does not get the others skipped.
+	require.Never(
+		t, func() bool {
+			tip, err := client.GetBlockCount(context.Background())
+			return err != nil || tip != 1000
+		}, time.Second, 50*time.Millisecond,
+	)
+}
+
+func TestMultiBtcClient_LaggingNodesKeepQuorum(t *testing.T) {
+	initTestMetrics(t)
+	cfg := testMultiBtcConfig(config.QuorumModeMin)
+	cfg.QuorumSize = 3
+	client := btcclient.NewMultiBtcClient([]btcclient.Node{
+		{Name: "ahead", Client: NewFakeChain(1000)},
+		{Name: "median", Client: NewFakeChain(990)},
+		{Name: "lagging", Client: NewFakeChain(980)},
+	}, cfg)
+
+	// Skipping the lagging node would leave too few nodes for the quorum.
+	require.Never(
+		t, func() bool {
+			tip, err := client.GetBlockCount(context.Background())
+			return err != nil || tip != 980
+		}, time.Second, 50*time.Millisecond,
+	)
+}
+
+func TestMultiBtcClient_HealthCheckDoesNotHangOnStuckNode(t *testing.T) {
+	initTestMetrics(t)
+	primary := NewFakeChain(1000)
+	stuck := NewFakeChain(1000)
+	stuck.SetDelay(time.Hour)
+	cfg := testMultiBtcConfig(config.QuorumModeNone)
+	cfg.QuorumSize = 1
+	client := btcclient.NewMultiBtcClient([]btcclient.Node{
+		{Name: "primary", Client: primary},
+		{Name: "secondary1", Client: NewFakeChain(1000)},
+		{Name: "secondary2", Client: NewFakeChain(1000)},
+		{Name: "stuck", Client: stuck},
+	}, cfg)
+
+	tip, err := client.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), tip)
+
+	// The stuck node times out, so later health checks still notice the lag.
+	primary.SetTip(900)
+	require.Eventually(
+		t, func() bool {
+			tip, err := client.GetBlockCount(context.Background())
+			return err == nil && tip == 1000
+		}, 5*time.Second, 50*time.Millisecond,
+	)
+}
+
+func TestMultiBtcClient_QuorumAgreesOnBlockHash(t *testing.T) {
+	initTestMetrics(t)
+	forked := NewFakeChain(1000)
+	forked.Reorg(990, 1000)
+	honest1 := NewFakeChain(1000)
+	honest2 := NewFakeChain(1000)
+	client := btcclient.NewMultiBtcClient([]btcclient.Node{
+		{Name: "forked", Client: forked},
+		{Name: "honest1", Client: honest1},
+		{Name: "honest2", Client: honest2},
+	}, testMultiBtcConfig(config.QuorumModeMedian))
+
+	// The first node is on another branch, the majority decides.
+	hash, err := client.GetBlockHash(context.Background(), 995)
+	require.NoError(t, err)
+	require.Equal(t, fakeBlockHash(995), *hash)
+
+	// Without a majority on any hash there is no answer.
+	honest2.Reorg(990, 1000)
+	honest2.Reorg(992, 1000)
+	_, err = client.GetBlockHash(context.Background(), 995)
+	require.ErrorContains(t, err, "agree on the block hash")
+}
+
+func TestMultiBtcClient_QuorumModeDoesNotFallBackToUnavailableNodes(t *testing.T) {
+	initTestMetrics(t)
+	first := NewFakeChain(1000)
+	first.SetErr(errors.New("connection refused"))
+	second := NewFakeChain(1000)
+	second.SetErr(errors.New("connection refused"))
+	cfg := testMultiBtcConfig(config.QuorumModeMin)
+	cfg.HealthCheckInterval = time.Hour
+	client := btcclient.NewMultiBtcClient([]btcclient.Node{
+		{Name: "first", Client: first},
+		{Name: "second", Client: second},
+	}, cfg)
+
+	_, err := client.GetBlockCount(context.Background())
+	require.Error(t, err)
+
+	// Both nodes failed, they are not asked until they are due for a retry.
+	first.SetErr(nil)
+	second.SetErr(nil)
+	calls := first.Calls()
+	_, err = client.GetBlockCount(context.Background())
+	require.ErrorIs(t, err, btcclient.ErrNoNodeAvailable)
+	require.Equal(t, calls, first.Calls())
+	_, err = client.GetBlockHash(context.Background(), 995)
+	require.ErrorIs(t, err, btcclient.ErrNoNodeAvailable)
+	_, err = client.GetRawTransaction(context.Background(), &chainhash.Hash{})
+	require.ErrorIs(t, err, btcclient.ErrNoNodeAvailable)
+	require.Equal(t, btcclient.ErrorClassTransient, btcclient.ClassOf(err))
+}
+
+func TestMultiBtcConfig_QuorumRequiresEnoughEndpoints(t *testing.T) {
+	endpoint := config.BtcEndpointConfig{Endpoint: "localhost:8332", RpcUser: "rpcuser", RpcPass: "rpcpass"}
+	cfg := config.BtcConfig{
+		NetParams:           "testnet",
+		QuorumMode:          config.QuorumModeMedian,
+		HealthCheckInterval: time.Minute,
+		Endpoints:           []config.BtcEndpointConfig{endpoint, endpoint, endpoint},
+	}
+	require.NoError(t, cfg.Validate())
+
+	// A single node can not make a quorum, it would be used without one.
+	cfg.Endpoints = []config.BtcEndpointConfig{endpoint}
+	require.ErrorContains(t, cfg.Validate(), "requires at least 2 endpoints")
+
+	cfg.Endpoints = []config.BtcEndpointConfig{endpoint, endpoint}
+	cfg.QuorumSize = 3
+	require.Error(t, cfg.Validate())
+
+	cfg.QuorumMode = config.QuorumModeNone
+	cfg.QuorumSize = 0
+	cfg.Endpoints = []config.BtcEndpointConfig{endpoint}
+	require.NoError(t, cfg.Validate())
+}
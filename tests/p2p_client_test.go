@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/require"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/btcclient"
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+)
+
+func startTestP2PClient(t *testing.T, addresses ...string) *btcclient.P2PClient {
+	client := btcclient.NewP2PClient(addresses, &chaincfg.RegressionNetParams, &config.P2PConfig{
+		ConnectTimeout:    5 * time.Second,
+		ReconnectInterval: 100 * time.Millisecond,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		client.Stop()
+		cancel()
+	})
+	go client.Start(ctx)
+	return client
+}
+
+func requireP2PTip(t *testing.T, client *btcclient.P2PClient, expected int64) {
+	require.Eventually(
+		t, func() bool {
+			tip, err := client.GetBlockCount(context.Background())
+			return err == nil && tip == expected
+		}, 30*time.Second, 50*time.Millisecond,
+	)
+}
+
+func TestP2PClient_SyncsHeaders(t *testing.T) {
+	initTestMetrics(t)
+	// More headers than a peer sends in one message.
+	chain := mineRegtestHeaders(regtestGenesisHeader(), 2500, "main", -1)
+	fakePeer := NewFakeBtcPeer(t, chain)
+
+	client := btcclient.NewP2PClient(
+		[]string{fakePeer.Address()}, &chaincfg.RegressionNetParams,
+		&config.P2PConfig{ConnectTimeout: 5 * time.Second, ReconnectInterval: 100 * time.Millisecond},
+	)
+	_, err := client.GetBlockCount(context.Background())
+	require.True(t, errors.Is(err, btcclient.ErrP2PNotSynced))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer client.Stop()
+	go client.Start(ctx)
+
+	requireP2PTip(t, client, 2500)
+	hash, err := client.GetBlockHash(context.Background(), 1234)
+	require.NoError(t, err)
+	require.Equal(t, chain[1233].BlockHash(), *hash)
+	hash, err = client.GetBlockHash(context.Background(), 0)
+	require.NoError(t, err)
+	require.Equal(t, *chaincfg.RegressionNetParams.GenesisHash, *hash)
+	_, err = client.GetBlockHash(context.Background(), 2501)
+	require.Error(t, err)
+}
+
+func TestP2PClient_FollowsChainWithMostWork(t *testing.T) {
+	initTestMetrics(t)
+	chain := mineRegtestHeaders(regtestGenesisHeader(), 100, "main", -1)
+	fakePeer := NewFakeBtcPeer(t, chain)
+	client := startTestP2PClient(t, fakePeer.Address())
+	requireP2PTip(t, client, 100)
+
+	// Drain the notification of the initial sync.
+	select {
+	case <-client.Notifications():
+	default:
+	}
+
+	// A fork from height 90 overtakes the chain, the announced tip does not
+	// connect to a known header until the fork is fetched.
+	fork := mineRegtestHeaders(chain[89], 15, "fork", -1)
+	fakePeer.SetChain(append(append([]*wire.BlockHeader{}, chain[:90]...), fork...))
+	requireP2PTip(t, client, 105)
+
+	select {
+	case <-client.Notifications():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a notification for the new best chain")
+	}
+}
+
+func TestP2PClient_RejectsInvalidHeaders(t *testing.T) {
+	tests := []struct {
+		name  string
+		chain []*wire.BlockHeader
+	}{
+		{
+			name:  "invalid proof of work",
+			chain: mineRegtestHeaders(regtestGenesisHeader(), 200, "liar", 10),
+		},
+		{
+			// Regtest does not retarget, a different difficulty is not allowed
+			// even if the proof of work meets it.
+			name:  "unexpected difficulty",
+			chain: mineHeaders(regtestGenesisHeader(), 200, "liar", -1, 0x1f7fffff),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initTestMetrics(t)
+			honestChain := mineRegtestHeaders(regtestGenesisHeader(), 50, "main", -1)
+			honest := NewFakeBtcPeer(t, honestChain)
+			otherHonest := NewFakeBtcPeer(t, honestChain)
+			liar := NewFakeBtcPeer(t, tt.chain)
+			client := startTestP2PClient(t, honest.Address(), otherHonest.Address(), liar.Address())
+
+			requireP2PTip(t, client, 50)
+			require.Never(
+				t, func() bool {
+					tip, err := client.GetBlockCount(context.Background())
+					return err != nil || tip != 50
+				}, time.Second, 50*time.Millisecond,
+			)
+		})
+	}
+}
+
+func requireP2PNotSynced(t *testing.T, client *btcclient.P2PClient) {
+	require.Never(
+		t, func() bool {
+			_, err := client.GetBlockCount(context.Background())
+			return !errors.Is(err, btcclient.ErrP2PNotSynced)
+		}, 2*time.Second, 50*time.Millisecond,
+	)
+}
+
+func TestP2PClient_WaitsForAdvertisedHeight(t *testing.T) {
+	initTestMetrics(t)
+	chain := mineRegtestHeaders(regtestGenesisHeader(), 200, "main", -1)
+	// The peer claims a height it does not serve the headers for.
+	fakePeer := NewFakeBtcPeer(t, chain[:100])
+	fakePeer.AdvertiseHeight(200)
+	client := startTestP2PClient(t, fakePeer.Address())
+
+	requireP2PNotSynced(t, client)
+	status, err := client.GetSyncStatus(context.Background())
+	require.NoError(t, err)
+	require.True(t, status.InitialBlockDownload)
+	require.Equal(t, int64(100), status.Headers)
+
+	fakePeer.SetChain(chain)
+	requireP2PTip(t, client, 200)
+}
+
+func TestP2PClient_WaitsForSecondPeer(t *testing.T) {
+	initTestMetrics(t)
+	chain := mineRegtestHeaders(regtestGenesisHeader(), 200, "main", -1)
+	synced := NewFakeBtcPeer(t, chain)
+	lagging := NewFakeBtcPeer(t, chain[:100])
+	lagging.AdvertiseHeight(300)
+	client := startTestP2PClient(t, synced.Address(), lagging.Address())
+
+	// A single peer does not decide when the chain is synced.
+	requireP2PNotSynced(t, client)
+
+	extended := append(append([]*wire.BlockHeader{}, chain...), mineRegtestHeaders(chain[199], 100, "main", -1)...)
+	lagging.SetChain(extended)
+	requireP2PTip(t, client, 300)
+}
@@ -0,0 +1,154 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/babylonchain/staking-queue-client/client"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/db/model"
+)
+
+func TestProcessExpiredDelegations_AdvancesCheckpoint(t *testing.T) {
+	chain := NewFakeChain(1000)
+	_, conn, teardown := setupTestServer(t, &TestServerDependency{MockBtcClient: chain})
+	defer teardown()
+
+	insertTestDelegations(t, []model.TimeLockDocument{
+		{ID: primitive.NewObjectID(), StakingTxHashHex: "stakingTxHashHex1", ExpireHeight: 990, TxType: "active"},
+		{ID: primitive.NewObjectID(), StakingTxHashHex: "stakingTxHashHex2", ExpireHeight: 995, TxType: "active"},
+	})
+
+	// Once every delegation is processed the checkpoint is at the tip.
+	require.Eventually(
+		t, func() bool {
+			checkpoint := fetchProcessingCheckpoint(t)
+			return len(fetchAllTestDelegations(t)) == 0 && checkpoint != nil && checkpoint.Height == 1000
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+	checkpoint := fetchProcessingCheckpoint(t)
+	require.Equal(t, fakeBlockHash(1000).String(), checkpoint.BlockHash)
+	count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	// New blocks advance the checkpoint even without expiries.
+	chain.SetTip(1005)
+	require.Eventually(
+		t, func() bool {
+			checkpoint := fetchProcessingCheckpoint(t)
+			return checkpoint != nil && checkpoint.Height == 1005
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+}
+
+func TestProcessExpiredDelegations_ResumesFromCheckpoint(t *testing.T) {
+	chain := NewFakeChain(1000)
+	_, conn, teardown := setupTestServer(t, &TestServerDependency{MockBtcClient: chain})
+	defer teardown()
+
+	saveTestProcessingCheckpoint(t, 990)
+	insertTestDelegations(t, []model.TimeLockDocument{
+		// Added after its height was processed, it is published nonetheless.
+		{ID: primitive.NewObjectID(), StakingTxHashHex: "stakingTxHashHex1", ExpireHeight: 985, TxType: "active"},
+		{ID: primitive.NewObjectID(), StakingTxHashHex: "stakingTxHashHex2", ExpireHeight: 995, TxType: "active"},
+	})
+
+	require.Eventually(
+		t, func() bool {
+			checkpoint := fetchProcessingCheckpoint(t)
+			return len(fetchAllTestDelegations(t)) == 0 && checkpoint != nil && checkpoint.Height == 1000
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+	count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+}
+
+func TestProcessExpiredDelegations_UnfinishedHeightHoldsCheckpoint(t *testing.T) {
+	// The delegations only expire once the tip moves on, so that the
+	// checkpoint cannot have passed them before they were inserted.
+	chain := NewFakeChain(990)
+	healthyTx := newTestTimeLockTx(1)
+	chain.AddTx(healthyTx, 900)
+
+	cfg, err := config.New("./config-test.yml")
+	require.NoError(t, err)
+	pollerCfg := cfg.Poller
+	pollerCfg.VerifyUnspent = true
+
+	_, _, teardown := setupTestServer(t, &TestServerDependency{
+		ConfigOverrides: &config.Config{Poller: pollerCfg},
+		MockBtcClient:   chain,
+	})
+	defer teardown()
+
+	require.True(t, chain.WaitForPolls(2, 10*time.Second))
+	require.Equal(t, uint64(990), fetchProcessingCheckpoint(t).Height)
+
+	// The timelock transaction of the first delegation is unknown, so it
+	// fails and waits for a retry. The later one is processed regardless.
+	outputIndex := uint32(0)
+	insertTestDelegations(t, []model.TimeLockDocument{
+		{
+			ID:                 primitive.NewObjectID(),
+			StakingTxHashHex:   newTestTimeLockTx(2).TxHash().String(),
+			StakingOutputIndex: &outputIndex,
+			ExpireHeight:       995,
+			TxType:             model.TimeLockTxTypeActive,
+		},
+		{
+			ID:                 primitive.NewObjectID(),
+			StakingTxHashHex:   healthyTx.TxHash().String(),
+			StakingOutputIndex: &outputIndex,
+			ExpireHeight:       998,
+			TxType:             model.TimeLockTxTypeActive,
+		},
+	})
+	chain.SetTip(1000)
+
+	require.Eventually(
+		t, func() bool {
+			delegations := fetchAllTestDelegations(t)
+			return len(delegations) == 1 && delegations[0].FailureCount > 0 && len(fetchExpiredHistory(t)) == 1
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+	require.True(t, chain.WaitForPolls(2, 10*time.Second))
+	require.Equal(t, uint64(990), fetchProcessingCheckpoint(t).Height)
+}
+
+func fetchProcessingCheckpoint(t *testing.T) *model.ProcessingCheckpointDocument {
+	var checkpoint model.ProcessingCheckpointDocument
+	err := testDatabase(t).Collection(model.ProcessingCheckpointCollection).
+		FindOne(context.Background(), bson.M{"_id": model.ProcessingCheckpointID}).Decode(&checkpoint)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("Failed to fetch processing checkpoint: %v", err)
+	}
+	return &checkpoint
+}
+
+func saveTestProcessingCheckpoint(t *testing.T, height uint64) {
+	// A poll may have saved a checkpoint already.
+	_, err := testDatabase(t).Collection(model.ProcessingCheckpointCollection).ReplaceOne(
+		context.Background(), bson.M{"_id": model.ProcessingCheckpointID}, model.ProcessingCheckpointDocument{
+			ID:        model.ProcessingCheckpointID,
+			Height:    height,
+			BlockHash: fakeBlockHash(int64(height)).String(),
+			UpdatedAt: time.Now().Unix(),
+		}, options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		t.Fatalf("Failed to save processing checkpoint: %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/babylonchain/staking-queue-client/client"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/db"
+	"github.com/babylonchain/staking-expiry-checker/internal/db/model"
+	"github.com/babylonchain/staking-expiry-checker/tests/mocks"
+)
+
+func TestProcessExpiredDelegations_SuppressesReinsertedDelegation(t *testing.T) {
+	mockBtc := new(mocks.BtcInterface)
+	mockBtc.On("GetBlockCount", mock.Anything).Return(int64(1000), nil)
+
+	_, conn, teardown := setupTestServer(t, &TestServerDependency{
+		MockBtcClient: mockBtc,
+	})
+	defer teardown()
+
+	delegation := model.TimeLockDocument{
+		ID:               primitive.NewObjectID(),
+		StakingTxHashHex: "mockStakingTxHashHex",
+		ExpireHeight:     999,
+		TxType:           "active",
+	}
+	insertTestDelegations(t, []model.TimeLockDocument{delegation})
+	require.Eventually(
+		t, func() bool {
+			count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+			return err == nil && count == 1 && len(fetchAllTestDelegations(t)) == 0
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+	require.Equal(t, int64(1), countTestDocuments(t, model.PublishedEventCollection))
+
+	// The same delegation is inserted again upstream, together with the
+	// expiry of its unbonding which is a different event.
+	delegation.ID = primitive.NewObjectID()
+	unbonding := model.TimeLockDocument{
+		ID:               primitive.NewObjectID(),
+		StakingTxHashHex: delegation.StakingTxHashHex,
+		ExpireHeight:     999,
+		TxType:           "unbonding",
+	}
+	insertTestDelegations(t, []model.TimeLockDocument{delegation, unbonding})
+
+	require.Eventually(
+		t, func() bool {
+			return len(fetchAllTestDelegations(t)) == 0
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+	// Only the unbonding expiry is published, the duplicate is archived without publishing.
+	count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	require.Equal(t, int64(2), countTestDocuments(t, model.PublishedEventCollection))
+	require.Len(t, fetchExpiredHistory(t), 3)
+}
+
+func TestProcessExpiredDelegations_PublishedEventLedgerEntry(t *testing.T) {
+	mockBtc := new(mocks.BtcInterface)
+	mockBtc.On("GetBlockCount", mock.Anything).Return(int64(1000), nil)
+
+	_, _, teardown := setupTestServer(t, &TestServerDependency{
+		MockBtcClient: mockBtc,
+	})
+	defer teardown()
+
+	insertTestDelegations(t, []model.TimeLockDocument{
+		{
+			ID:               primitive.NewObjectID(),
+			StakingTxHashHex: "mockStakingTxHashHex",
+			ExpireHeight:     999,
+			TxType:           "active",
+		},
+	})
+	require.Eventually(
+		t, func() bool {
+			return len(fetchAllTestDelegations(t)) == 0
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+
+	var entry model.PublishedEventDocument
+	err := testDatabase(t).Collection(model.PublishedEventCollection).
+		FindOne(context.Background(), bson.M{"_id": model.PublishedEventKey("mockStakingTxHashHex", "active")}).
+		Decode(&entry)
+	require.NoError(t, err)
+	require.Equal(t, "mockStakingTxHashHex", entry.StakingTxHashHex)
+	require.Equal(t, "active", entry.TxType)
+	require.NotEmpty(t, entry.InstanceID)
+	require.False(t, entry.PublishedAt.IsZero())
+}
+
+func TestProcessExpiredDelegations_DoesNotSendLedgerDuplicates(t *testing.T) {
+	mockDB := new(mocks.DbInterface)
+	mockBtc := new(mocks.BtcInterface)
+	mockBtc.On("GetBlockCount", mock.Anything).Return(int64(1000), nil)
+
+	duplicate := model.TimeLockDocument{
+		ID:               primitive.NewObjectID(),
+		StakingTxHashHex: "mockStakingTxHashHex",
+		ExpireHeight:     999,
+		TxType:           "active",
+	}
+	mockDB.On("ArchivePublishedDelegations", mock.Anything, mock.Anything).Return(int64(0), nil)
+	mockDB.On("ClaimExpiredDelegations", mock.Anything, uint64(1000), mock.Anything, mock.Anything, mock.Anything).
+		Return([]model.TimeLockDocument{duplicate}, nil).Once()
+	mockDB.On("ClaimExpiredDelegations", mock.Anything, uint64(1000), mock.Anything, mock.Anything, mock.Anything).
+		Return([]model.TimeLockDocument{}, nil)
+	mockDB.On("IsEventPublished", mock.Anything, duplicate.StakingTxHashHex, duplicate.TxType).Return(true, nil)
+	mockDB.On("MarkDelegationPublished", mock.Anything, duplicate.ID, mock.Anything, mock.Anything, false, mock.Anything).Return(nil)
+	archived := make(chan struct{}, 1)
+	mockDB.On("ArchiveExpiredDelegation", mock.Anything, duplicate.ID, mock.Anything).Return(nil).
+		Run(func(mock.Arguments) { archived <- struct{}{} })
+
+	_, conn, teardown := setupTestServer(t, &TestServerDependency{
+		MockDbClient:  mockDB,
+		MockBtcClient: mockBtc,
+	})
+	defer teardown()
+
+	select {
+	case <-archived:
+	case <-time.After(10 * time.Second):
+		t.Fatal("duplicate delegation was not archived")
+	}
+	count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
+
+func TestMarkDelegationPublished_RefreshesLedgerEntryOfSentEvents(t *testing.T) {
+	cfg, err := config.New("./config-test.yml")
+	require.NoError(t, err)
+	setupTestDB(cfg)
+	dbClient, err := db.New(context.Background(), cfg.Db)
+	require.NoError(t, err)
+
+	key := model.PublishedEventKey("mockStakingTxHashHex", "active")
+	publishedAt := time.Now().Add(-24 * time.Hour).Truncate(time.Millisecond).UTC()
+	insertRawTestDocument(t, model.PublishedEventCollection, model.PublishedEventDocument{
+		ID:               key,
+		StakingTxHashHex: "mockStakingTxHashHex",
+		TxType:           "active",
+		PublishedAt:      publishedAt,
+		InstanceID:       "otherInstance",
+	})
+	markPublished := func(sent bool) {
+		id := primitive.NewObjectID()
+		insertTestDelegations(t, []model.TimeLockDocument{{
+			ID:               id,
+			StakingTxHashHex: "mockStakingTxHashHex",
+			ExpireHeight:     999,
+			TxType:           "active",
+			Status:           model.TimeLockStatusPublishing,
+			LeaseOwner:       "instance",
+		}})
+		require.NoError(t, dbClient.MarkDelegationPublished(context.Background(), id, "instance", 1000, sent, nil))
+	}
+
+	// A suppressed duplicate does not extend the dedup window.
+	markPublished(false)
+	entry := fetchPublishedEvent(t, key)
+	require.Equal(t, publishedAt, entry.PublishedAt.UTC())
+	require.Equal(t, "otherInstance", entry.InstanceID)
+
+	// An event sent again does.
+	markPublished(true)
+	entry = fetchPublishedEvent(t, key)
+	require.True(t, entry.PublishedAt.After(publishedAt))
+	require.Equal(t, "instance", entry.InstanceID)
+}
+
+func fetchPublishedEvent(t *testing.T, key string) model.PublishedEventDocument {
+	var entry model.PublishedEventDocument
+	err := testDatabase(t).Collection(model.PublishedEventCollection).
+		FindOne(context.Background(), bson.M{"_id": key}).Decode(&entry)
+	if err != nil {
+		t.Fatalf("Failed to fetch published event: %v", err)
+	}
+	return entry
+}
@@ -0,0 +1,331 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/babylonchain/staking-queue-client/client"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/btcclient"
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/db/model"
+	"github.com/babylonchain/staking-expiry-checker/internal/observability/metrics"
+	"github.com/babylonchain/staking-expiry-checker/internal/queue"
+	"github.com/babylonchain/staking-expiry-checker/internal/services"
+	"github.com/babylonchain/staking-expiry-checker/tests/mocks"
+)
+
+// fakeQueueClient fails the first failures sends with sendErr, or a
+// connection error if unset, and succeeds afterwards.
+type fakeQueueClient struct {
+	client.QueueClient
+
+	mu       sync.Mutex
+	failures int
+	sendErr  error
+	sent     int
+	attempts int
+}
+
+func (c *fakeQueueClient) SendMessage(ctx context.Context, messageBody string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.attempts++
+	if c.failures > 0 {
+		c.failures--
+		if c.sendErr != nil {
+			return c.sendErr
+		}
+		return errors.New("connection reset by peer")
+	}
+	c.sent++
+	return nil
+}
+
+func (c *fakeQueueClient) Stop() error {
+	return nil
+}
+
+func (c *fakeQueueClient) setFailures(failures int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures = failures
+}
+
+func (c *fakeQueueClient) counts() (int, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.attempts, c.sent
+}
+
+func testPublisherConfig(t *testing.T) *config.Config {
+	cfg, err := config.New("./config-test.yml")
+	require.NoError(t, err)
+	metrics.Init(cfg.Metrics.GetMetricsPort())
+
+	cfg.Publisher = config.PublisherConfig{
+		MaxRetries:              3,
+		InitialBackoff:          time.Millisecond,
+		MaxBackoff:              5 * time.Millisecond,
+		ConfirmTimeout:          time.Second,
+		BreakerFailureThreshold: 5,
+		BreakerCooldown:         200 * time.Millisecond,
+	}
+	return cfg
+}
+
+func TestSendExpiredStakingEvent_RetriesFailedSends(t *testing.T) {
+	cfg := testPublisherConfig(t)
+	queueClient := &fakeQueueClient{failures: 2}
+	qm := queue.NewQueueManagerWithClient(queueClient, &cfg.Publisher)
+
+	ev := client.NewExpiredStakingEvent("mockStakingTxHashHex", "active")
+	require.NoError(t, qm.SendExpiredStakingEvent(context.Background(), ev))
+
+	attempts, sent := queueClient.counts()
+	require.Equal(t, 3, attempts)
+	require.Equal(t, 1, sent)
+}
+
+func TestSendExpiredStakingEvent_ReturnsSendErrorAfterRetries(t *testing.T) {
+	cfg := testPublisherConfig(t)
+	queueClient := &fakeQueueClient{failures: 100}
+	qm := queue.NewQueueManagerWithClient(queueClient, &cfg.Publisher)
+
+	ev := client.NewExpiredStakingEvent("mockStakingTxHashHex", "active")
+	err := qm.SendExpiredStakingEvent(context.Background(), ev)
+
+	var sendErr *queue.SendError
+	require.ErrorAs(t, err, &sendErr)
+	require.Equal(t, "mockStakingTxHashHex", sendErr.StakingTxHashHex)
+	require.Equal(t, cfg.Publisher.MaxRetries+1, sendErr.Attempts)
+	require.NotErrorIs(t, err, queue.ErrCircuitOpen)
+}
+
+func TestSendExpiredStakingEvent_ConfirmTimeoutMayHavePublished(t *testing.T) {
+	cfg := testPublisherConfig(t)
+	cfg.Publisher.MaxRetries = 1
+	queueClient := &fakeQueueClient{failures: 1, sendErr: queue.ErrConfirmTimeout}
+	qm := queue.NewQueueManagerWithClient(queueClient, &cfg.Publisher)
+	ev := client.NewExpiredStakingEvent("mockStakingTxHashHex", "active")
+
+	// A timed out confirmation is retried like any other failed send.
+	require.NoError(t, qm.SendExpiredStakingEvent(context.Background(), ev))
+
+	// Once retries are exhausted, the caller learns the event may be in the queue.
+	queueClient.setFailures(2)
+	err := qm.SendExpiredStakingEvent(context.Background(), ev)
+	var sendErr *queue.SendError
+	require.ErrorAs(t, err, &sendErr)
+	require.True(t, sendErr.MaybePublished)
+	require.ErrorIs(t, err, queue.ErrConfirmTimeout)
+
+	// A nacked message was refused by the broker and is known to not be published.
+	queueClient.sendErr = queue.ErrPublishNacked
+	queueClient.setFailures(2)
+	err = qm.SendExpiredStakingEvent(context.Background(), ev)
+	require.ErrorAs(t, err, &sendErr)
+	require.False(t, sendErr.MaybePublished)
+	require.ErrorIs(t, err, queue.ErrPublishNacked)
+}
+
+func TestSendExpiredStakingEvent_LostConfirmMayHavePublished(t *testing.T) {
+	cfg := testPublisherConfig(t)
+	cfg.Publisher.MaxRetries = 1
+	queueClient := &fakeQueueClient{failures: 2, sendErr: queue.ErrConfirmLost}
+	qm := queue.NewQueueManagerWithClient(queueClient, &cfg.Publisher)
+	ev := client.NewExpiredStakingEvent("mockStakingTxHashHex", "active")
+
+	// The pending confirmation is nacked when the channel closes, which
+	// says nothing about whether the broker stored the message.
+	err := qm.SendExpiredStakingEvent(context.Background(), ev)
+	var sendErr *queue.SendError
+	require.ErrorAs(t, err, &sendErr)
+	require.True(t, sendErr.MaybePublished)
+	require.ErrorIs(t, err, queue.ErrConfirmLost)
+}
+
+func TestSendExpiryRevertedEvent(t *testing.T) {
+	cfg := testPublisherConfig(t)
+	qm := queue.NewQueueManagerWithClient(&fakeQueueClient{}, &cfg.Publisher)
+	ev := queue.ExpiryRevertedEvent{
+		StakingTxHashHex: "mockStakingTxHashHex",
+		TxType:           "active",
+		ExpireHeight:     995,
+		ForkHeight:       990,
+	}
+
+	// Without a queue the event cannot be published.
+	require.ErrorIs(t, qm.SendExpiryRevertedEvent(context.Background(), ev), queue.ErrNoExpiryRevertedQueue)
+
+	revertedQueue := &fakeQueueClient{failures: 1}
+	qm.SetExpiryRevertedQueue(revertedQueue)
+	require.NoError(t, qm.SendExpiryRevertedEvent(context.Background(), ev))
+	attempts, sent := revertedQueue.counts()
+	require.Equal(t, 2, attempts)
+	require.Equal(t, 1, sent)
+
+	revertedQueue.setFailures(100)
+	var sendErr *queue.SendError
+	require.ErrorAs(t, qm.SendExpiryRevertedEvent(context.Background(), ev), &sendErr)
+	require.Equal(t, "mockStakingTxHashHex", sendErr.StakingTxHashHex)
+}
+
+func TestConfirmingQueueClient_WaitsForBrokerConfirm(t *testing.T) {
+	_, conn, teardown := setupTestServer(t, nil)
+	defer teardown()
+
+	cfg, err := config.New("./config-test.yml")
+	require.NoError(t, err)
+	stakingEventQueue, err := client.NewQueueClient(&cfg.Queue, client.ExpiredStakingQueueName)
+	require.NoError(t, err)
+	confirmingQueue, err := queue.NewConfirmingQueueClient(&cfg.Queue, stakingEventQueue, cfg.Publisher.ConfirmTimeout)
+	require.NoError(t, err)
+	defer confirmingQueue.Stop()
+
+	require.NoError(t, confirmingQueue.SendMessage(context.Background(), "confirmed message"))
+
+	// The broker confirmed the message, so it is stored in the queue.
+	require.Eventually(
+		t, func() bool {
+			count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+			return err == nil && count == 1
+		}, 5*time.Second, 100*time.Millisecond,
+	)
+}
+
+func TestSendExpiredStakingEvent_CircuitBreaker(t *testing.T) {
+	cfg := testPublisherConfig(t)
+	cfg.Publisher.MaxRetries = 0
+	cfg.Publisher.BreakerFailureThreshold = 2
+	queueClient := &fakeQueueClient{failures: 2}
+	qm := queue.NewQueueManagerWithClient(queueClient, &cfg.Publisher)
+	ev := client.NewExpiredStakingEvent("mockStakingTxHashHex", "active")
+
+	// Consecutive failures open the breaker.
+	require.Error(t, qm.SendExpiredStakingEvent(context.Background(), ev))
+	require.False(t, qm.IsCircuitOpen())
+	require.Error(t, qm.SendExpiredStakingEvent(context.Background(), ev))
+	require.True(t, qm.IsCircuitOpen())
+
+	// While open, sends are rejected without reaching the queue.
+	err := qm.SendExpiredStakingEvent(context.Background(), ev)
+	require.ErrorIs(t, err, queue.ErrCircuitOpen)
+	attempts, _ := queueClient.counts()
+	require.Equal(t, 2, attempts)
+
+	// After the cooldown a trial send closes the breaker again.
+	require.Eventually(t, func() bool {
+		return !qm.IsCircuitOpen()
+	}, time.Second, 10*time.Millisecond)
+	require.NoError(t, qm.SendExpiredStakingEvent(context.Background(), ev))
+	require.False(t, qm.IsCircuitOpen())
+	_, sent := queueClient.counts()
+	require.Equal(t, 1, sent)
+}
+
+func TestSendExpiredStakingEvent_FailedTrialReopensBreaker(t *testing.T) {
+	cfg := testPublisherConfig(t)
+	cfg.Publisher.MaxRetries = 0
+	cfg.Publisher.BreakerFailureThreshold = 1
+	queueClient := &fakeQueueClient{failures: 2}
+	qm := queue.NewQueueManagerWithClient(queueClient, &cfg.Publisher)
+	ev := client.NewExpiredStakingEvent("mockStakingTxHashHex", "active")
+
+	require.Error(t, qm.SendExpiredStakingEvent(context.Background(), ev))
+	require.True(t, qm.IsCircuitOpen())
+
+	time.Sleep(cfg.Publisher.BreakerCooldown)
+	require.Error(t, qm.SendExpiredStakingEvent(context.Background(), ev))
+	require.True(t, qm.IsCircuitOpen())
+}
+
+func TestProcessExpiredDelegations_OpenCircuitReleasesDelegations(t *testing.T) {
+	cfg := testPublisherConfig(t)
+	cfg.Publisher.MaxRetries = 0
+	cfg.Publisher.BreakerFailureThreshold = 1
+	cfg.Poller.Workers = 1
+	queueClient := &fakeQueueClient{failures: 100}
+	qm := queue.NewQueueManagerWithClient(queueClient, &cfg.Publisher)
+
+	first := model.TimeLockDocument{
+		ID:               primitive.NewObjectID(),
+		StakingTxHashHex: "mockStakingTxHashHex1",
+		ExpireHeight:     999,
+		TxType:           "active",
+	}
+	second := model.TimeLockDocument{
+		ID:               primitive.NewObjectID(),
+		StakingTxHashHex: "mockStakingTxHashHex2",
+		ExpireHeight:     999,
+		TxType:           "active",
+	}
+
+	mockBtc := new(mocks.BtcInterface)
+	mockBtc.On("GetBlockCount", mock.Anything).Return(int64(1000), nil)
+	mockDB := new(mocks.DbInterface)
+	mockDB.On("ArchivePublishedDelegations", mock.Anything, mock.Anything).Return(int64(0), nil)
+	mockDB.On("IsEventPublished", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+	mockDB.On("ClaimExpiredDelegations", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return([]model.TimeLockDocument{first, second}, nil).Once()
+	mockDB.On("RecordDelegationFailure", mock.Anything, first.ID, mock.Anything, mock.Anything, true, mock.Anything, mock.Anything).
+		Return(false, nil)
+	mockDB.On("ReleaseDelegation", mock.Anything, second.ID, mock.Anything, model.TimeLockStatus("")).
+		Return(nil)
+	mockNoProcessingCheckpoint(mockDB)
+
+	service := services.NewService(cfg, "instance", mockDB, mockBtc, qm, nil)
+
+	// The first send opens the breaker, the second document is handed back
+	// without counting a failure against it.
+	err := service.ProcessExpiredDelegations(context.Background())
+	require.ErrorIs(t, err, queue.ErrCircuitOpen)
+	mockDB.AssertCalled(t, "ReleaseDelegation", mock.Anything, second.ID, mock.Anything, model.TimeLockStatus(""))
+	mockDB.AssertNotCalled(t, "RecordDelegationFailure", mock.Anything, second.ID, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	// While the breaker is open nothing is claimed.
+	err = service.ProcessExpiredDelegations(context.Background())
+	require.ErrorIs(t, err, queue.ErrCircuitOpen)
+	mockDB.AssertNumberOfCalls(t, "ClaimExpiredDelegations", 1)
+}
+
+func TestProcessExpiredDelegations_UnconfirmedSendIsNoFailure(t *testing.T) {
+	cfg := testPublisherConfig(t)
+	cfg.Publisher.MaxRetries = 0
+	queueClient := &fakeQueueClient{failures: 1, sendErr: queue.ErrConfirmTimeout}
+	qm := queue.NewQueueManagerWithClient(queueClient, &cfg.Publisher)
+
+	delegation := model.TimeLockDocument{
+		ID:               primitive.NewObjectID(),
+		StakingTxHashHex: "mockStakingTxHashHex",
+		ExpireHeight:     999,
+		TxType:           "active",
+	}
+
+	mockBtc := new(mocks.BtcInterface)
+	mockBtc.On("GetBlockCount", mock.Anything).Return(int64(1000), nil)
+	mockBtc.On("GetBlockHash", mock.Anything, mock.Anything).Return(nil, btcclient.ErrUnsupported)
+	mockDB := new(mocks.DbInterface)
+	mockDB.On("ArchivePublishedDelegations", mock.Anything, mock.Anything).Return(int64(0), nil)
+	mockDB.On("IsEventPublished", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+	mockDB.On("ClaimExpiredDelegations", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return([]model.TimeLockDocument{delegation}, nil).Once()
+	mockDB.On("ClaimExpiredDelegations", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return([]model.TimeLockDocument{}, nil)
+	mockDB.On("RecordMaybePublished", mock.Anything, delegation.ID, "instance", mock.Anything).Return(nil)
+	mockNoProcessingCheckpoint(mockDB)
+
+	service := services.NewService(cfg, "instance", mockDB, mockBtc, qm, nil)
+
+	// The broker may have stored the event, the document is not at fault and
+	// must not be dead lettered for it.
+	require.NoError(t, service.ProcessExpiredDelegations(context.Background()))
+	mockDB.AssertCalled(t, "RecordMaybePublished", mock.Anything, delegation.ID, "instance", mock.Anything)
+	mockDB.AssertNotCalled(t, "RecordDelegationFailure", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,207 @@
+package tests
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/babylonchain/staking-queue-client/client"
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/db/model"
+	"github.com/babylonchain/staking-expiry-checker/internal/queue"
+)
+
+const testExpiryRevertedQueueName = "expiry_reverted_queue_test"
+
+func testReorgConfig(compensation string) config.ReorgConfig {
+	return config.ReorgConfig{
+		Enabled:        true,
+		Window:         20,
+		Compensation:   compensation,
+		EventQueueName: testExpiryRevertedQueueName,
+	}
+}
+
+// setupReorgTest publishes the expiries of two delegations, one of them
+// above the height the chain is later reorged from.
+func setupReorgTest(t *testing.T, chain *FakeChain, compensation string) (*amqp091.Connection, func()) {
+	return setupReorgTestWithConfig(t, chain, &config.Config{Reorg: testReorgConfig(compensation)})
+}
+
+func setupReorgTestWithConfig(t *testing.T, chain *FakeChain, overrides *config.Config) (*amqp091.Connection, func()) {
+	_, conn, teardown := setupTestServer(t, &TestServerDependency{
+		ConfigOverrides: overrides,
+		MockBtcClient:   chain,
+	})
+
+	insertTestDelegations(t, []model.TimeLockDocument{
+		{ID: primitive.NewObjectID(), StakingTxHashHex: "stakingTxHashHex1", ExpireHeight: 985, TxType: "active"},
+		{ID: primitive.NewObjectID(), StakingTxHashHex: "stakingTxHashHex2", ExpireHeight: 995, TxType: "active"},
+	})
+	require.Eventually(
+		t, func() bool {
+			checkpoint := fetchProcessingCheckpoint(t)
+			return len(fetchExpiredHistory(t)) == 2 && checkpoint != nil && checkpoint.Height == 1000
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+	return conn, teardown
+}
+
+func TestProcessExpiredDelegations_RevertsReorgedExpiries(t *testing.T) {
+	chain := NewFakeChain(1000)
+	conn, teardown := setupReorgTest(t, chain, config.ReorgCompensationEvent)
+	defer teardown()
+
+	// The replacing branch is as long, the delegation expires again on it.
+	chain.Reorg(990, 1000)
+
+	require.Eventually(
+		t, func() bool {
+			count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+			return err == nil && count == 3 && len(fetchExpiredHistory(t)) == 3 && len(fetchAllTestDelegations(t)) == 0
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+
+	reverted := 0
+	for _, history := range fetchExpiredHistory(t) {
+		if history.Outcome != model.ExpiredHistoryOutcomeReverted {
+			continue
+		}
+		reverted++
+		require.Equal(t, "stakingTxHashHex2", history.StakingTxHashHex)
+		require.Equal(t, uint64(990), history.ForkHeight)
+		require.NotZero(t, history.RevertedAt)
+	}
+	require.Equal(t, 1, reverted)
+
+	ev := fetchExpiryRevertedEvent(t, conn)
+	require.Equal(t, queue.ExpiryRevertedEvent{
+		StakingTxHashHex: "stakingTxHashHex2",
+		TxType:           "active",
+		ExpireHeight:     995,
+		ForkHeight:       990,
+	}, ev)
+
+	// The checkpoint follows the new branch once processed again.
+	require.Eventually(
+		t, func() bool {
+			checkpoint := fetchProcessingCheckpoint(t)
+			return checkpoint != nil && checkpoint.BlockHash == fakeBranchBlockHash(1000, 1).String()
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+}
+
+func TestProcessExpiredDelegations_LeaderRevertsReorgedExpiriesUnderItsFence(t *testing.T) {
+	overrides := leaderElectionOverrides()
+	overrides.Reorg = testReorgConfig(config.ReorgCompensationAlert)
+	chain := NewFakeChain(1000)
+	_, teardown := setupReorgTestWithConfig(t, chain, overrides)
+	defer teardown()
+
+	// The revert is rejected by the db unless written under the fence of
+	// the current leadership.
+	chain.Reorg(990, 1000)
+
+	require.Eventually(
+		t, func() bool {
+			for _, history := range fetchExpiredHistory(t) {
+				if history.Outcome == model.ExpiredHistoryOutcomeReverted {
+					return true
+				}
+			}
+			return false
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+	require.Eventually(
+		t, func() bool {
+			checkpoint := fetchProcessingCheckpoint(t)
+			return checkpoint != nil && checkpoint.BlockHash == fakeBranchBlockHash(1000, 1).String()
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+}
+
+func TestProcessExpiredDelegations_AlertsReorgedExpiries(t *testing.T) {
+	chain := NewFakeChain(1000)
+	conn, teardown := setupReorgTest(t, chain, config.ReorgCompensationAlert)
+	defer teardown()
+
+	// The replacing branch is shorter, the delegation is not expired on it.
+	chain.Reorg(990, 992)
+
+	require.Eventually(
+		t, func() bool {
+			delegations := fetchAllTestDelegations(t)
+			return len(delegations) == 1 && delegations[0].StakingTxHashHex == "stakingTxHashHex2"
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+	delegation := fetchAllTestDelegations(t)[0]
+	require.Equal(t, model.TimeLockStatusPending, delegation.Status)
+	require.Equal(t, uint64(995), delegation.ExpireHeight)
+
+	require.Eventually(
+		t, func() bool {
+			checkpoint := fetchProcessingCheckpoint(t)
+			return checkpoint != nil && checkpoint.Height == 992
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+	count, err := inspectQueueMessageCount(t, conn, testExpiryRevertedQueueName)
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
+
+func TestProcessExpiredDelegations_LaggingTipIsNoReorg(t *testing.T) {
+	chain := NewFakeChain(1000)
+	conn, teardown := setupReorgTest(t, chain, config.ReorgCompensationEvent)
+	defer teardown()
+
+	// A node behind the kept blocks still has the same blocks below its tip.
+	chain.SetTip(992)
+	require.True(t, chain.WaitForPolls(2, 10*time.Second))
+
+	require.Empty(t, fetchAllTestDelegations(t))
+	for _, history := range fetchExpiredHistory(t) {
+		require.NotEqual(t, model.ExpiredHistoryOutcomeReverted, history.Outcome)
+	}
+	require.Equal(t, uint64(1000), fetchProcessingCheckpoint(t).Height)
+	count, err := inspectQueueMessageCount(t, conn, testExpiryRevertedQueueName)
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
+
+func TestReorgConfig_Validate(t *testing.T) {
+	disabled := config.ReorgConfig{}
+	require.NoError(t, disabled.Validate())
+
+	event := testReorgConfig(config.ReorgCompensationEvent)
+	require.NoError(t, event.Validate())
+	event.EventQueueName = ""
+	require.Error(t, event.Validate())
+
+	alert := testReorgConfig(config.ReorgCompensationAlert)
+	alert.EventQueueName = ""
+	require.NoError(t, alert.Validate())
+	alert.Window = 0
+	require.Error(t, alert.Validate())
+
+	unknown := testReorgConfig("page")
+	require.Error(t, unknown.Validate())
+}
+
+// fetchExpiryRevertedEvent takes the next message off the expiry reverted queue.
+func fetchExpiryRevertedEvent(t *testing.T, conn *amqp091.Connection) queue.ExpiryRevertedEvent {
+	ch, err := conn.Channel()
+	require.NoError(t, err)
+	defer ch.Close()
+
+	msg, ok, err := ch.Get(testExpiryRevertedQueueName, true)
+	require.NoError(t, err)
+	require.True(t, ok, "no expiry reverted event in the queue")
+
+	var ev queue.ExpiryRevertedEvent
+	require.NoError(t, json.Unmarshal(msg.Body, &ev))
+	return ev
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/mock"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -18,10 +19,13 @@ import (
 	"github.com/babylonchain/staking-expiry-checker/internal/config"
 	"github.com/babylonchain/staking-expiry-checker/internal/db"
 	"github.com/babylonchain/staking-expiry-checker/internal/db/model"
+	"github.com/babylonchain/staking-expiry-checker/internal/leader"
 	"github.com/babylonchain/staking-expiry-checker/internal/observability/metrics"
 	"github.com/babylonchain/staking-expiry-checker/internal/poller"
 	"github.com/babylonchain/staking-expiry-checker/internal/queue"
 	"github.com/babylonchain/staking-expiry-checker/internal/services"
+	"github.com/babylonchain/staking-expiry-checker/internal/utils"
+	"github.com/babylonchain/staking-expiry-checker/tests/mocks"
 	"github.com/babylonchain/staking-queue-client/client"
 
 	queueconfig "github.com/babylonchain/staking-queue-client/config"
@@ -46,10 +50,20 @@ func setupTestServer(t *testing.T, dep *TestServerDependency) (*queue.QueueManag
 		applyConfigOverrides(cfg, dep.ConfigOverrides)
 	}
 
-	qm, conn, err := setUpTestQueue(t, &cfg.Queue)
+	qm, conn, err := setUpTestQueue(t, &cfg.Queue, &cfg.Publisher)
 	if err != nil {
 		t.Fatalf("Failed to setup test queue: %v", err)
 	}
+	if cfg.Reorg.Enabled && cfg.Reorg.Compensation == config.ReorgCompensationEvent {
+		if err := purgeQueues(conn, []string{cfg.Reorg.EventQueueName}); err != nil {
+			t.Fatalf("Failed to purge expiry reverted event queue: %v", err)
+		}
+		revertedQueue, err := queue.NewConfirmingQueue(&cfg.Queue, cfg.Reorg.EventQueueName, cfg.Publisher.ConfirmTimeout)
+		if err != nil {
+			t.Fatalf("Failed to setup expiry reverted event queue: %v", err)
+		}
+		qm.SetExpiryRevertedQueue(revertedQueue)
+	}
 
 	var (
 		dbClient  db.DbInterface
@@ -58,15 +72,28 @@ func setupTestServer(t *testing.T, dep *TestServerDependency) (*queue.QueueManag
 
 	if dep != nil && dep.MockBtcClient != nil {
 		btcClient = dep.MockBtcClient
+		if mockBtc, ok := btcClient.(*mocks.BtcInterface); ok {
+			// Tests mocking the btc client only care about the tip, the
+			// processing checkpoint is saved without a block hash.
+			mockBtc.On("GetBlockHash", mock.Anything, mock.Anything).Return(nil, btcclient.ErrUnsupported).Maybe()
+		}
 	} else {
-		btcClient, err = btcclient.NewBtcClient(&cfg.Btc)
+		btcClient, err = btcclient.New(&cfg.Btc)
 		if err != nil {
 			t.Fatalf("Failed to initialize btc client: %v", err)
 		}
 	}
+	// Backends learning about new blocks by themselves also signal them.
+	backendNotifier, _ := btcClient.(btcclient.BlockNotifier)
+	if cfg.Btc.TipCacheTTL > 0 {
+		btcClient = btcclient.NewCachedBtcClient(btcClient, cfg.Btc.TipCacheTTL)
+	}
 
 	if dep != nil && dep.MockDbClient != nil {
 		dbClient = dep.MockDbClient
+		if mockDB, ok := dbClient.(*mocks.DbInterface); ok {
+			mockNoProcessingCheckpoint(mockDB)
+		}
 	} else {
 		setupTestDB(cfg)
 		dbClient, err = db.New(ctx, cfg.Db)
@@ -76,8 +103,20 @@ func setupTestServer(t *testing.T, dep *TestServerDependency) (*queue.QueueManag
 
 	}
 
-	service := services.NewService(dbClient, btcClient, qm)
-	p, err := poller.NewPoller(cfg.Poller.Interval, service)
+	instanceID := utils.NewInstanceID()
+	var elector *leader.Elector
+	if cfg.LeaderElection.Enabled {
+		elector = leader.NewElector(&cfg.LeaderElection, dbClient, instanceID)
+	}
+
+	service := services.NewService(cfg, instanceID, dbClient, btcClient, qm, elector)
+	var blockNotifier btcclient.BlockNotifier
+	if cfg.Btc.ZmqBlockEndpoint != "" {
+		blockNotifier = btcclient.NewBlockSubscriber(cfg.Btc.ZmqBlockEndpoint)
+	} else if backendNotifier != nil {
+		blockNotifier = backendNotifier
+	}
+	p, err := poller.NewPoller(cfg.Poller.Interval, service, elector, blockNotifier)
 	if err != nil {
 		t.Fatalf("Failed to initialize poller: %v", err)
 	}
@@ -96,6 +135,17 @@ func setupTestServer(t *testing.T, dep *TestServerDependency) (*queue.QueueManag
 	return qm, conn, teardown
 }
 
+// mockNoProcessingCheckpoint makes the mocked db report no processing
+// checkpoint, so that every expired delegation is claimed at once.
+func mockNoProcessingCheckpoint(mockDB *mocks.DbInterface) {
+	mockDB.On("GetProcessingCheckpoint", mock.Anything).
+		Return(nil, &db.NotFoundError{Message: "processing checkpoint not found"}).Maybe()
+	mockDB.On("NextExpireHeight", mock.Anything, mock.Anything).
+		Return(uint64(0), &db.NotFoundError{Message: "no delegation expires after the given height"}).Maybe()
+	mockDB.On("CountExpiredDelegations", mock.Anything, mock.Anything).Return(int64(0), nil).Maybe()
+	mockDB.On("SaveProcessingCheckpoint", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil).Maybe()
+}
+
 // Generic function to apply configuration overrides
 func applyConfigOverrides(defaultCfg *config.Config, overrides *config.Config) {
 	defaultVal := reflect.ValueOf(defaultCfg).Elem()
@@ -145,7 +195,9 @@ func setupTestDB(cfg *config.Config) {
 	}
 }
 
-func setUpTestQueue(t *testing.T, cfg *queueconfig.QueueConfig) (*queue.QueueManager, *amqp091.Connection, error) {
+func setUpTestQueue(
+	t *testing.T, cfg *queueconfig.QueueConfig, publisherCfg *config.PublisherConfig,
+) (*queue.QueueManager, *amqp091.Connection, error) {
 	amqpURI := fmt.Sprintf("amqp://%s:%s@%s", cfg.QueueUser, cfg.QueuePassword, cfg.Url)
 	conn, err := amqp091.Dial(amqpURI)
 	if err != nil {
@@ -161,7 +213,7 @@ func setUpTestQueue(t *testing.T, cfg *queueconfig.QueueConfig) (*queue.QueueMan
 		return nil, nil, err
 	}
 
-	qm, err := queue.NewQueueManager(cfg)
+	qm, err := queue.NewQueueManager(cfg, publisherCfg)
 	if err != nil {
 		t.Fatalf("failed to setup queue manager in test: %v", err)
 	}
@@ -0,0 +1,182 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/babylonchain/staking-queue-client/client"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/btcclient"
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/db/model"
+	"github.com/babylonchain/staking-expiry-checker/internal/queue"
+	"github.com/babylonchain/staking-expiry-checker/internal/services"
+	"github.com/babylonchain/staking-expiry-checker/tests/mocks"
+)
+
+// newTestTimeLockTx creates a transaction with a single output, made unique by the tag.
+func newTestTimeLockTx(tag byte) *wire.MsgTx {
+	tx := wire.NewMsgTx(wire.TxVersion)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(&chainhash.Hash{tag}, 0), nil, nil))
+	tx.AddTxOut(wire.NewTxOut(100000, []byte{0x51}))
+	return tx
+}
+
+func TestProcessExpiredDelegations_ArchivesSpentDelegations(t *testing.T) {
+	chain := NewFakeChain(1000)
+	spentTx := newTestTimeLockTx(1)
+	unspentTx := newTestTimeLockTx(2)
+	chain.AddTx(spentTx, 900)
+	chain.AddTx(unspentTx, 900)
+	chain.SpendOutput(spentTx.TxHash(), 0, 950)
+
+	cfg, err := config.New("./config-test.yml")
+	require.NoError(t, err)
+	pollerCfg := cfg.Poller
+	pollerCfg.VerifyUnspent = true
+
+	_, conn, teardown := setupTestServer(t, &TestServerDependency{
+		ConfigOverrides: &config.Config{Poller: pollerCfg},
+		MockBtcClient:   chain,
+	})
+	defer teardown()
+
+	outputIndex := uint32(0)
+	spent := model.TimeLockDocument{
+		ID:                 primitive.NewObjectID(),
+		StakingTxHashHex:   spentTx.TxHash().String(),
+		StakingOutputIndex: &outputIndex,
+		ExpireHeight:       999,
+		TxType:             model.TimeLockTxTypeActive,
+	}
+	unspent := model.TimeLockDocument{
+		ID:                 primitive.NewObjectID(),
+		StakingTxHashHex:   "unbondedStakingTxHashHex",
+		UnbondingTxHashHex: unspentTx.TxHash().String(),
+		ExpireHeight:       999,
+		TxType:             model.TimeLockTxTypeUnbonding,
+	}
+	insertTestDelegations(t, []model.TimeLockDocument{spent, unspent})
+
+	// Only the expiry of the unspent output is published, both are archived.
+	require.Eventually(
+		t, func() bool {
+			return len(fetchAllTestDelegations(t)) == 0 && len(fetchExpiredHistory(t)) == 2
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+	count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	outcomes := make(map[primitive.ObjectID]model.ExpiredHistoryOutcome)
+	for _, history := range fetchExpiredHistory(t) {
+		outcomes[history.TimeLockID] = history.Outcome
+	}
+	require.Equal(t, model.ExpiredHistoryOutcomeSpent, outcomes[spent.ID])
+	require.Equal(t, model.ExpiredHistoryOutcomePublished, outcomes[unspent.ID])
+}
+
+func TestProcessExpiredDelegations_RetriesUnknownTimeLockTx(t *testing.T) {
+	chain := NewFakeChain(1000)
+
+	cfg, err := config.New("./config-test.yml")
+	require.NoError(t, err)
+	pollerCfg := cfg.Poller
+	pollerCfg.VerifyUnspent = true
+
+	_, conn, teardown := setupTestServer(t, &TestServerDependency{
+		ConfigOverrides: &config.Config{Poller: pollerCfg},
+		MockBtcClient:   chain,
+	})
+	defer teardown()
+
+	// The output is neither unspent nor known to be spent, so the expiry
+	// is neither published nor skipped.
+	outputIndex := uint32(0)
+	unknown := model.TimeLockDocument{
+		ID:                 primitive.NewObjectID(),
+		StakingTxHashHex:   newTestTimeLockTx(3).TxHash().String(),
+		StakingOutputIndex: &outputIndex,
+		ExpireHeight:       999,
+		TxType:             model.TimeLockTxTypeActive,
+	}
+	insertTestDelegations(t, []model.TimeLockDocument{unknown})
+
+	require.Eventually(
+		t, func() bool {
+			delegations := fetchAllTestDelegations(t)
+			return len(delegations) == 1 && delegations[0].FailureCount > 0
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+	count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+	require.NoError(t, err)
+	require.Zero(t, count)
+	require.Empty(t, fetchExpiredHistory(t))
+}
+
+func TestProcessExpiredDelegations_OnlySkipsSpendsBeforeExpiry(t *testing.T) {
+	tx := newTestTimeLockTx(1)
+	txHash := tx.TxHash()
+	outputIndex := uint32(0)
+	delegation := model.TimeLockDocument{
+		ID:                 primitive.NewObjectID(),
+		StakingTxHashHex:   txHash.String(),
+		StakingOutputIndex: &outputIndex,
+		ExpireHeight:       999,
+		TxType:             model.TimeLockTxTypeActive,
+	}
+
+	for name, tc := range map[string]struct {
+		spendHeight int64
+		spendErr    error
+		skipped     bool
+	}{
+		"spent before the expiry":   {spendHeight: 950, skipped: true},
+		"spent at the expiry":       {spendHeight: 999},
+		"spent after the expiry":    {spendHeight: 1000},
+		"spent only in the mempool": {spendErr: btcclient.ErrTxNotConfirmed},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := testPublisherConfig(t)
+			cfg.Poller.VerifyUnspent = true
+			queueClient := &fakeQueueClient{}
+			qm := queue.NewQueueManagerWithClient(queueClient, &cfg.Publisher)
+
+			mockBtc := new(mocks.BtcInterface)
+			mockBtc.On("GetBlockCount", mock.Anything).Return(int64(1000), nil)
+			mockBtc.On("GetBlockHash", mock.Anything, mock.Anything).Return(nil, btcclient.ErrUnsupported)
+			mockBtc.On("GetTxOut", mock.Anything, &txHash, outputIndex).Return(nil, nil)
+			mockBtc.On("GetRawTransaction", mock.Anything, &txHash).Return(tx, nil)
+			mockBtc.On("GetTxOutSpendHeight", mock.Anything, &txHash, outputIndex).Return(tc.spendHeight, tc.spendErr)
+			mockDB := new(mocks.DbInterface)
+			mockDB.On("ArchivePublishedDelegations", mock.Anything, mock.Anything).Return(int64(0), nil)
+			mockDB.On("ClaimExpiredDelegations", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+				Return([]model.TimeLockDocument{delegation}, nil).Once()
+			mockDB.On("ClaimExpiredDelegations", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+				Return([]model.TimeLockDocument{}, nil)
+			mockDB.On("ArchiveSpentDelegation", mock.Anything, delegation.ID, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			mockDB.On("IsEventPublished", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+			mockDB.On("MarkDelegationPublished", mock.Anything, delegation.ID, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+				Return(nil)
+			mockDB.On("ArchiveExpiredDelegation", mock.Anything, delegation.ID, mock.Anything).Return(nil)
+			mockNoProcessingCheckpoint(mockDB)
+
+			service := services.NewService(cfg, "instance", mockDB, mockBtc, qm, nil)
+			require.NoError(t, service.ProcessExpiredDelegations(context.Background()))
+
+			if tc.skipped {
+				mockDB.AssertCalled(t, "ArchiveSpentDelegation", mock.Anything, delegation.ID, mock.Anything, mock.Anything, mock.Anything)
+				require.Zero(t, queueClient.sent)
+			} else {
+				mockDB.AssertNotCalled(t, "ArchiveSpentDelegation", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				require.Equal(t, 1, queueClient.sent)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/babylonchain/staking-queue-client/client"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/btcclient"
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/db/model"
+	"github.com/babylonchain/staking-expiry-checker/internal/observability/metrics"
+)
+
+func TestSyncStatus_IsSyncing(t *testing.T) {
+	require.False(t, (&btcclient.SyncStatus{Blocks: 100, Headers: 100}).IsSyncing())
+	// The newest block may still be downloading after its header arrived.
+	require.False(t, (&btcclient.SyncStatus{Blocks: 100, Headers: 101}).IsSyncing())
+	require.True(t, (&btcclient.SyncStatus{Blocks: 100, Headers: 110}).IsSyncing())
+	require.True(t, (&btcclient.SyncStatus{InitialBlockDownload: true, Blocks: 100, Headers: 100}).IsSyncing())
+}
+
+func TestSyncMonitor_RefusesSyncingNode(t *testing.T) {
+	initTestMetrics(t)
+	chain := NewFakeChain(1000)
+	chain.SetSyncing(true)
+	monitor := btcclient.NewSyncMonitor(chain, &config.BtcConfig{RequireSynced: true})
+
+	require.ErrorIs(t, monitor.Check(context.Background(), 1000), btcclient.ErrNodeSyncing)
+	require.False(t, fetchHealth(t).Stalled)
+	require.True(t, fetchHealth(t).Syncing)
+
+	chain.SetSyncing(false)
+	require.NoError(t, monitor.Check(context.Background(), 1000))
+	require.False(t, fetchHealth(t).Syncing)
+}
+
+func TestSyncMonitor_IgnoresSyncStatusUnlessRequired(t *testing.T) {
+	initTestMetrics(t)
+	chain := NewFakeChain(1000)
+	chain.SetSyncing(true)
+	monitor := btcclient.NewSyncMonitor(chain, &config.BtcConfig{})
+
+	require.NoError(t, monitor.Check(context.Background(), 1000))
+}
+
+func TestSyncMonitor_AcceptsBackendsWithoutSyncStatus(t *testing.T) {
+	initTestMetrics(t)
+	esplora := btcclient.NewEsploraClient("http://localhost:1/api", testEsploraConfig())
+	monitor := btcclient.NewSyncMonitor(esplora, &config.BtcConfig{RequireSynced: true})
+
+	require.NoError(t, monitor.Check(context.Background(), 1000))
+}
+
+func TestSyncMonitor_ReportsStalledTip(t *testing.T) {
+	initTestMetrics(t)
+	chain := NewFakeChain(1000)
+	monitor := btcclient.NewSyncMonitor(chain, &config.BtcConfig{StallThreshold: 200 * time.Millisecond})
+
+	require.NoError(t, monitor.Check(context.Background(), 1000))
+	require.False(t, fetchHealth(t).Stalled)
+
+	// A stalled tip is reported but does not refuse processing.
+	time.Sleep(300 * time.Millisecond)
+	require.NoError(t, monitor.Check(context.Background(), 1000))
+	require.True(t, fetchHealth(t).Stalled)
+
+	require.NoError(t, monitor.Check(context.Background(), 1001))
+	require.False(t, fetchHealth(t).Stalled)
+}
+
+// fetchHealth queries the health endpoint of the metrics server, checking
+// that its status code matches the reported state.
+func fetchHealth(t *testing.T) metrics.BtcSyncState {
+	cfg, err := config.New("./config-test.yml")
+	require.NoError(t, err)
+
+	var (
+		state metrics.BtcSyncState
+		resp  *http.Response
+	)
+	// The metrics server is started in the background.
+	require.Eventually(t, func() bool {
+		resp, err = http.Get(fmt.Sprintf("http://localhost:%d/health", cfg.Metrics.GetMetricsPort()))
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+	defer resp.Body.Close()
+
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&state))
+	if state.Syncing || state.Stalled {
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	} else {
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	return state
+}
+
+func TestProcessExpiredDelegations_WaitsForNodeSync(t *testing.T) {
+	chain := NewFakeChain(1000)
+	chain.SetSyncing(true)
+
+	btcCfg := testBtcConfigWithConfirmationDepth(1)
+	btcCfg.RequireSynced = true
+	_, conn, teardown := setupTestServer(t, &TestServerDependency{
+		ConfigOverrides: &config.Config{Btc: btcCfg},
+		MockBtcClient:   chain,
+	})
+	defer teardown()
+
+	delegation := model.TimeLockDocument{
+		ID:               primitive.NewObjectID(),
+		StakingTxHashHex: "mockStakingTxHashHex",
+		ExpireHeight:     990,
+		TxType:           model.TimeLockTxTypeActive,
+	}
+	insertTestDelegations(t, []model.TimeLockDocument{delegation})
+
+	// Nothing is processed while the node is in initial block download.
+	require.True(t, chain.WaitForPolls(2, 10*time.Second))
+	count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+	require.NoError(t, err)
+	require.Zero(t, count)
+	require.Len(t, fetchAllTestDelegations(t), 1)
+
+	chain.SetSyncing(false)
+	require.Eventually(
+		t, func() bool {
+			count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+			return err == nil && count == 1
+		}, 10*time.Second, 100*time.Millisecond,
+	)
+}
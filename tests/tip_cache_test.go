@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/btcclient"
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/observability/metrics"
+	"github.com/babylonchain/staking-expiry-checker/tests/mocks"
+)
+
+func initTestMetrics(t *testing.T) {
+	cfg, err := config.New("./config-test.yml")
+	require.NoError(t, err)
+	metrics.Init(cfg.Metrics.GetMetricsPort())
+}
+
+func TestCachedBtcClient_ServesTipWithinTTL(t *testing.T) {
+	initTestMetrics(t)
+	chain := NewFakeChain(1000)
+	cached := btcclient.NewCachedBtcClient(chain, 200*time.Millisecond)
+
+	tip, err := cached.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), tip)
+
+	// A new block within the TTL is not visible yet.
+	chain.SetTip(1001)
+	tip, err = cached.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), tip)
+	require.Equal(t, 1, chain.Calls())
+
+	// Once the TTL passed, the node is queried again.
+	time.Sleep(200 * time.Millisecond)
+	tip, err = cached.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(1001), tip)
+	require.Equal(t, 2, chain.Calls())
+}
+
+func TestCachedBtcClient_DeduplicatesConcurrentQueries(t *testing.T) {
+	initTestMetrics(t)
+	chain := NewFakeChain(1000)
+	chain.SetDelay(200 * time.Millisecond)
+	cached := btcclient.NewCachedBtcClient(chain, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tip, err := cached.GetBlockCount(context.Background())
+			require.NoError(t, err)
+			require.Equal(t, int64(1000), tip)
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, 1, chain.Calls())
+}
+
+func TestCachedBtcClient_DoesNotCacheErrors(t *testing.T) {
+	initTestMetrics(t)
+	mockBtc := new(mocks.BtcInterface)
+	mockBtc.On("GetBlockCount", mock.Anything).Return(int64(0), errors.New("node unavailable")).Once()
+	mockBtc.On("GetBlockCount", mock.Anything).Return(int64(1000), nil).Once()
+	cached := btcclient.NewCachedBtcClient(mockBtc, time.Minute)
+
+	_, err := cached.GetBlockCount(context.Background())
+	require.Error(t, err)
+
+	tip, err := cached.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), tip)
+	mockBtc.AssertNumberOfCalls(t, "GetBlockCount", 2)
+}
+
+func TestCachedBtcClient_InvalidateOnNewBlock(t *testing.T) {
+	initTestMetrics(t)
+	chain := NewFakeChain(1000)
+	cached := btcclient.NewCachedBtcClient(chain, time.Minute)
+
+	tip, err := cached.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), tip)
+
+	// A notified block is visible right away, without waiting for the TTL.
+	chain.SetTip(1001)
+	cached.Invalidate()
+	tip, err = cached.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(1001), tip)
+	require.Equal(t, 2, chain.Calls())
+
+	// The refreshed tip is cached again.
+	tip, err = cached.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(1001), tip)
+	require.Equal(t, 2, chain.Calls())
+}
+
+func TestCachedBtcClient_InvalidateDiscardsQueryInFlight(t *testing.T) {
+	initTestMetrics(t)
+	started, release := make(chan struct{}), make(chan struct{})
+	mockBtc := new(mocks.BtcInterface)
+	mockBtc.On("GetBlockCount", mock.Anything).Run(func(mock.Arguments) {
+		close(started)
+		<-release
+	}).Return(int64(1000), nil).Once()
+	mockBtc.On("GetBlockCount", mock.Anything).Return(int64(1001), nil)
+	cached := btcclient.NewCachedBtcClient(mockBtc, time.Minute)
+
+	// A query started before the block was notified returns the old tip.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		tip, err := cached.GetBlockCount(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, int64(1000), tip)
+	}()
+	<-started
+
+	cached.Invalidate()
+	close(release)
+	wg.Wait()
+
+	// The old tip was not cached, the next call queries the node.
+	tip, err := cached.GetBlockCount(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, int64(1001), tip)
+	mockBtc.AssertNumberOfCalls(t, "GetBlockCount", 2)
+}
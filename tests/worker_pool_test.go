@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/babylonchain/staking-queue-client/client"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/babylonchain/staking-expiry-checker/internal/config"
+	"github.com/babylonchain/staking-expiry-checker/internal/db"
+	"github.com/babylonchain/staking-expiry-checker/internal/db/model"
+	"github.com/babylonchain/staking-expiry-checker/internal/services"
+	"github.com/babylonchain/staking-expiry-checker/internal/utils"
+	"github.com/babylonchain/staking-expiry-checker/tests/mocks"
+)
+
+func insertExpiredTestDelegations(t *testing.T, count int) []model.TimeLockDocument {
+	var delegations []model.TimeLockDocument
+	for i := 0; i < count; i++ {
+		delegations = append(delegations, model.TimeLockDocument{
+			ID:               primitive.NewObjectID(),
+			StakingTxHashHex: fmt.Sprintf("mockStakingTxHashHex%d", i),
+			ExpireHeight:     999,
+			TxType:           "active",
+		})
+	}
+	insertTestDelegations(t, delegations)
+	return delegations
+}
+
+func TestProcessExpiredDelegations_DrainsInBatches(t *testing.T) {
+	mockBtc := new(mocks.BtcInterface)
+	mockBtc.On("GetBlockCount", mock.Anything).Return(int64(1000), nil)
+
+	cfg, err := config.New("./config-test.yml")
+	require.NoError(t, err)
+	pollerCfg := cfg.Poller
+	pollerCfg.BatchSize = 25
+	pollerCfg.Workers = 4
+
+	_, conn, teardown := setupTestServer(t, &TestServerDependency{
+		ConfigOverrides: &config.Config{Poller: pollerCfg},
+		MockBtcClient:   mockBtc,
+	})
+	defer teardown()
+
+	delegations := insertExpiredTestDelegations(t, 230)
+
+	require.Eventually(
+		t, func() bool {
+			return len(fetchAllTestDelegations(t)) == 0
+		}, 20*time.Second, 100*time.Millisecond,
+	)
+	count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+	require.NoError(t, err)
+	require.Equal(t, len(delegations), count)
+}
+
+func TestProcessExpiredDelegations_StopsOnContextCancellation(t *testing.T) {
+	// The poller started by the test server never sees anything expired,
+	// the service under test is driven directly instead.
+	mockBtc := new(mocks.BtcInterface)
+	mockBtc.On("GetBlockCount", mock.Anything).Return(int64(0), nil)
+
+	qm, conn, teardown := setupTestServer(t, &TestServerDependency{
+		MockBtcClient: mockBtc,
+	})
+	defer teardown()
+
+	cfg, err := config.New("./config-test.yml")
+	require.NoError(t, err)
+	// Short leases let a later run reclaim what the interrupted one claimed.
+	cfg.Poller.LeaseDuration = time.Second
+	dbClient, err := db.New(context.Background(), cfg.Db)
+	require.NoError(t, err)
+	chain := NewFakeChain(1000)
+	service := services.NewService(cfg, utils.NewInstanceID(), dbClient, chain, qm, nil)
+
+	delegations := insertExpiredTestDelegations(t, 500)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- service.ProcessExpiredDelegations(ctx)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	// Whether the run ends with an error depends on where it was interrupted,
+	// it must however return promptly.
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("processing did not stop after the context was cancelled")
+	}
+
+	// Leases of the interrupted run expire, after which a new run drains the rest.
+	require.Eventually(
+		t, func() bool {
+			_ = service.ProcessExpiredDelegations(context.Background())
+			return len(fetchAllTestDelegations(t)) == 0
+		}, 20*time.Second, time.Second,
+	)
+	count, err := inspectQueueMessageCount(t, conn, client.ExpiredStakingQueueName)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, count, len(delegations))
+}